@@ -1,20 +1,25 @@
 package main
 
 import (
-	"log"
+	"log/slog"
+	"os"
 
 	"github.com/szks-repo/event-store-adapter-go/pkg"
 	"github.com/szks-repo/event-store-adapter-go/web"
 )
 
 func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
 	// make http server
 	srv := web.NewServer(
-		pkg.NewUserAccountRepository(pkg.NewEventStoreOnMemory()),
+		pkg.NewUserAccountRepository(pkg.NewEventStoreOnMemory(), pkg.WithUserAccountRepositoryLogger(logger)),
+		logger,
 	)
 
-	log.Printf("Server is running on %s\n", srv.Addr)
+	logger.Info("server is running", slog.String("addr", srv.Addr))
 	if err := srv.ListenAndServe(); err != nil {
-		log.Fatal(err)
+		logger.Error("server stopped", slog.Any("error", err))
+		os.Exit(1)
 	}
 }
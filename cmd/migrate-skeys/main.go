@@ -0,0 +1,61 @@
+// Command migrate-skeys rewrites the skeys of journal and snapshot tables written with the DefaultKeyResolver
+// to those of the SortableKeyResolver.
+//
+//	migrate-skeys -tables journal,snapshot -dry-run
+//	migrate-skeys -tables journal,snapshot
+//
+// Stop the writers before migrating, and restart them with pkg.WithSortableKeyResolver afterwards.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+func main() {
+	tables := flag.String("tables", "", "comma-separated names of the journal and snapshot tables to migrate")
+	dryRun := flag.Bool("dry-run", false, "only count the items to migrate")
+	endpoint := flag.String("endpoint", "", "the DynamoDB endpoint, if not the default")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	if *tables == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		logger.Error("failed to load the AWS config", slog.Any("error", err))
+		os.Exit(1)
+	}
+	client := dynamodb.NewFromConfig(awsConfig, func(o *dynamodb.Options) {
+		if *endpoint != "" {
+			o.BaseEndpoint = aws.String(*endpoint)
+		}
+	})
+
+	for _, tableName := range strings.Split(*tables, ",") {
+		result, err := pkg.MigrateToSortableSkeys(ctx, client, tableName, *dryRun, logger)
+		if err != nil {
+			logger.Error("failed to migrate the table", slog.String("table", tableName), slog.Any("error", err))
+			os.Exit(1)
+		}
+		logger.Info("migrated the table",
+			slog.String("table", tableName),
+			slog.Bool("dry_run", *dryRun),
+			slog.Int("scanned", result.Scanned),
+			slog.Int("migrated", result.Migrated),
+			slog.Int("skipped", result.Skipped),
+			slog.Int("conflicts", result.Conflicts))
+	}
+}
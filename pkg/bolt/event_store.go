@@ -0,0 +1,420 @@
+// Package bolt provides the event store on a bbolt database file.
+//
+// It links go.etcd.io/bbolt, so it is a separate package from pkg.
+//
+//	eventStore, err := bolt.NewEventStore("event_store.db", 4, eventConverter, snapshotConverter)
+//	if err != nil {
+//		return err
+//	}
+//	defer eventStore.Close()
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	journalBucketName  = []byte("journal")
+	snapshotBucketName = []byte("snapshot")
+)
+
+// boltItem is the value of a journal or snapshot key, mirroring the attributes of the DynamoDB items.
+type boltItem struct {
+	Aid        string `json:"aid"`
+	SeqNr      uint64 `json:"seq_nr"`
+	TypeName   string `json:"type_name,omitempty"`
+	OccurredAt uint64 `json:"occurred_at,omitempty"`
+	Version    uint64 `json:"version,omitempty"`
+	Ttl        int64  `json:"ttl,omitempty"`
+	Payload    []byte `json:"payload"`
+}
+
+// EventStore is pkg.EventStore for a bbolt database file.
+//
+// The journal and snapshot buckets contain a nested bucket per pkey, keyed by skey, as resolved by the KeyResolver.
+// The events of an aggregate are read by a range scan over the skey prefix shared by its seqNrs.
+// Events and snapshots are written in a single transaction.
+type EventStore struct {
+	settings          pkg.EventStoreSettings
+	db                *bbolt.DB
+	shardCount        uint64
+	eventConverter    pkg.EventConverter
+	snapshotConverter pkg.AggregateConverter
+}
+
+// NewEventStore opens the database file and returns a new EventStore.
+//
+// # Parameters
+// - path is the path of the database file, which is created if it does not exist.
+// - shardCount is a shard count used to resolve pkey.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStore, which must be closed
+// - an error
+func NewEventStore(
+	path string,
+	shardCount uint64,
+	eventConverter pkg.EventConverter,
+	snapshotConverter pkg.AggregateConverter,
+	options ...pkg.EventStoreOption,
+) (*EventStore, error) {
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+	if shardCount == 0 {
+		return nil, errors.New("shardCount is zero")
+	}
+	settings, err := pkg.NewEventStoreSettings(options...)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to open the database", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{journalBucketName, snapshotBucketName} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, pkg.NewIOError("Failed to create the buckets", err)
+	}
+
+	return &EventStore{
+		settings:          settings,
+		db:                db,
+		shardCount:        shardCount,
+		eventConverter:    eventConverter,
+		snapshotConverter: snapshotConverter,
+	}, nil
+}
+
+// Close closes the database.
+func (es *EventStore) Close() error {
+	return es.db.Close()
+}
+
+func (es *EventStore) GetLatestSnapshotById(_ context.Context, aggregateId pkg.AggregateId) (*pkg.AggregateResult, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+	var item *boltItem
+	err := es.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		item, err = es.getItem(tx, snapshotBucketName, aggregateId, 0)
+		return err
+	})
+	if err != nil {
+		return nil, pkg.WrapIOError("Failed to GetLatestSnapshotById get", err)
+	}
+	if item == nil {
+		return pkg.NewAggregateResult(nil), nil
+	}
+
+	var aggregateMap map[string]any
+	if err := es.settings.SnapshotSerializer.Deserialize(item.Payload, &aggregateMap); err != nil {
+		return nil, err
+	}
+	aggregate, err := es.snapshotConverter(aggregateMap)
+	if err != nil {
+		return nil, pkg.NewDeserializationError("Failed to convert the snapshot", err)
+	}
+	return pkg.NewAggregateResult(aggregate.WithVersion(item.Version)), nil
+}
+
+func (es *EventStore) GetEventsByIdSinceSeqNr(_ context.Context, aggregateId pkg.AggregateId, seqNr uint64) ([]pkg.Event, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+	var items []boltItem
+	err := es.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		items, err = es.scanItems(tx, journalBucketName, aggregateId)
+		return err
+	})
+	if err != nil {
+		return nil, pkg.WrapIOError("Failed to GetEventsByIdSinceSeqNr scan", err)
+	}
+
+	events := make([]pkg.Event, 0, len(items))
+	for _, item := range items {
+		if item.SeqNr < seqNr {
+			continue
+		}
+		var eventMap map[string]any
+		if err := es.settings.EventSerializer.Deserialize(item.Payload, &eventMap); err != nil {
+			return nil, err
+		}
+		event, err := es.eventConverter(eventMap)
+		if err != nil {
+			return nil, pkg.NewDeserializationError("Failed to convert the event", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name whose occurred at is within [from, to].
+//
+// There is no index by type name, so the whole journal is scanned.
+func (es *EventStore) GetEventsByTypeNameAndOccurredAt(_ context.Context, typeName string, from uint64, to uint64) ([]pkg.Event, error) {
+	var items []boltItem
+	err := es.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(journalBucketName).ForEachBucket(func(pkey []byte) error {
+			return tx.Bucket(journalBucketName).Bucket(pkey).ForEach(func(_ []byte, value []byte) error {
+				var item boltItem
+				if err := json.Unmarshal(value, &item); err != nil {
+					return pkg.NewDeserializationError("Failed to decode the item", err)
+				}
+				if item.TypeName == typeName && item.OccurredAt >= from && item.OccurredAt <= to {
+					items = append(items, item)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, pkg.WrapIOError("Failed to GetEventsByTypeNameAndOccurredAt scan", err)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].OccurredAt < items[j].OccurredAt })
+
+	events := make([]pkg.Event, 0, len(items))
+	for _, item := range items {
+		var eventMap map[string]any
+		if err := es.settings.EventSerializer.Deserialize(item.Payload, &eventMap); err != nil {
+			return nil, err
+		}
+		event, err := es.eventConverter(eventMap)
+		if err != nil {
+			return nil, pkg.NewDeserializationError("Failed to convert the event", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (es *EventStore) PersistEvent(_ context.Context, event pkg.Event, version uint64) error {
+	if event.IsCreated() {
+		panic("event is created")
+	}
+	return es.update(event, version, nil)
+}
+
+func (es *EventStore) PersistEventAndSnapshot(_ context.Context, event pkg.Event, aggregate pkg.Aggregate) error {
+	if aggregate == nil {
+		return errors.New("aggregate is nil")
+	}
+	return es.update(event, aggregate.GetVersion(), aggregate)
+}
+
+// update writes the event and the snapshot in a transaction.
+//
+// # Parameters
+// - event is an event to store.
+// - version is the expected version of the aggregate, ignored if the event is created.
+// - aggregate is an aggregate to store, or nil.
+// # Returns
+// - an error, which is an OptimisticLockError if the version or the seqNr conflicts
+func (es *EventStore) update(event pkg.Event, version uint64, aggregate pkg.Aggregate) error {
+	if event == nil {
+		panic("event is nil")
+	}
+	eventPayload, err := es.settings.EventSerializer.Serialize(event)
+	if err != nil {
+		return err
+	}
+	var snapshotPayload []byte
+	if aggregate != nil {
+		if snapshotPayload, err = es.settings.SnapshotSerializer.Serialize(aggregate); err != nil {
+			return err
+		}
+	}
+	aggregateId := event.GetAggregateId()
+	aid := aggregateId.AsString()
+
+	err = es.db.Update(func(tx *bbolt.Tx) error {
+		latest, err := es.getItem(tx, snapshotBucketName, aggregateId, 0)
+		if err != nil {
+			return err
+		}
+		if event.IsCreated() {
+			if latest != nil {
+				return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+			}
+			latest = &boltItem{Aid: aid, Payload: snapshotPayload}
+		} else {
+			if latest == nil || latest.Version != version {
+				return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+			}
+			if snapshotPayload != nil {
+				latest.Payload = snapshotPayload
+			}
+		}
+		latest.Version++
+
+		journal, err := es.getItem(tx, journalBucketName, aggregateId, event.GetSeqNr())
+		if err != nil {
+			return err
+		}
+		if journal != nil {
+			return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+		}
+		err = es.putItem(tx, journalBucketName, aggregateId, event.GetSeqNr(), &boltItem{
+			Aid:        aid,
+			SeqNr:      event.GetSeqNr(),
+			TypeName:   event.GetTypeName(),
+			OccurredAt: event.GetOccurredAt(),
+			Payload:    eventPayload,
+		})
+		if err != nil {
+			return err
+		}
+		if err := es.putItem(tx, snapshotBucketName, aggregateId, 0, latest); err != nil {
+			return err
+		}
+		if es.settings.KeepSnapshot && aggregate != nil {
+			kept, err := es.getItem(tx, snapshotBucketName, aggregateId, aggregate.GetSeqNr())
+			if err != nil {
+				return err
+			}
+			if kept != nil {
+				return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+			}
+			item := &boltItem{Aid: aid, SeqNr: aggregate.GetSeqNr(), Version: latest.Version, Payload: snapshotPayload}
+			if err := es.putItem(tx, snapshotBucketName, aggregateId, aggregate.GetSeqNr(), item); err != nil {
+				return err
+			}
+			return es.purgeExcessSnapshots(tx, aggregateId)
+		}
+		return nil
+	})
+	return pkg.WrapIOError("Failed to write the event and the snapshot", err)
+}
+
+// purgeExcessSnapshots purges the snapshots of the aggregate exceeding keepSnapshotCount.
+//
+// When deleteTtl is set, the ttl of excess snapshots is set and expired snapshots are deleted,
+// emulating the TTL of DynamoDB.
+func (es *EventStore) purgeExcessSnapshots(tx *bbolt.Tx, aggregateId pkg.AggregateId) error {
+	if es.settings.KeepSnapshotCount == 0 {
+		return nil
+	}
+	items, err := es.scanItems(tx, snapshotBucketName, aggregateId)
+	if err != nil {
+		return err
+	}
+	var kept []boltItem
+	for _, item := range items {
+		if item.SeqNr > 0 {
+			kept = append(kept, item)
+		}
+	}
+	if uint64(len(kept)) <= uint64(es.settings.KeepSnapshotCount) {
+		return nil
+	}
+	now := time.Now()
+	for _, item := range kept[:uint64(len(kept))-uint64(es.settings.KeepSnapshotCount)] {
+		if es.settings.DeleteTtl < math.MaxInt64 {
+			if item.Ttl == 0 {
+				item.Ttl = now.Add(es.settings.DeleteTtl).Unix()
+				if err := es.putItem(tx, snapshotBucketName, aggregateId, item.SeqNr, &item); err != nil {
+					return err
+				}
+			}
+			if item.Ttl > now.Unix() {
+				continue
+			}
+		}
+		bucket := tx.Bucket(snapshotBucketName).Bucket([]byte(es.settings.KeyResolver.ResolvePkey(aggregateId, es.shardCount)))
+		if err := bucket.Delete([]byte(es.settings.KeyResolver.ResolveSkey(aggregateId, item.SeqNr))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getItem returns the item of the aggregate and the seqNr in the bucket, or nil if it does not exist.
+func (es *EventStore) getItem(tx *bbolt.Tx, bucketName []byte, aggregateId pkg.AggregateId, seqNr uint64) (*boltItem, error) {
+	bucket := tx.Bucket(bucketName).Bucket([]byte(es.settings.KeyResolver.ResolvePkey(aggregateId, es.shardCount)))
+	if bucket == nil {
+		return nil, nil
+	}
+	value := bucket.Get([]byte(es.settings.KeyResolver.ResolveSkey(aggregateId, seqNr)))
+	if value == nil {
+		return nil, nil
+	}
+	var item boltItem
+	if err := json.Unmarshal(value, &item); err != nil {
+		return nil, pkg.NewDeserializationError("Failed to decode the item", err)
+	}
+	return &item, nil
+}
+
+// putItem puts the item of the aggregate and the seqNr into the bucket.
+func (es *EventStore) putItem(tx *bbolt.Tx, bucketName []byte, aggregateId pkg.AggregateId, seqNr uint64, item *boltItem) error {
+	bucket, err := tx.Bucket(bucketName).CreateBucketIfNotExists([]byte(es.settings.KeyResolver.ResolvePkey(aggregateId, es.shardCount)))
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(item)
+	if err != nil {
+		return pkg.NewSerializationError("Failed to encode the item", err)
+	}
+	return bucket.Put([]byte(es.settings.KeyResolver.ResolveSkey(aggregateId, seqNr)), value)
+}
+
+// scanItems returns the items of the aggregate in the bucket, ordered by seqNr.
+//
+// The range scanned is the longest prefix shared by the skeys of the smallest and largest seqNrs,
+// and items of other aggregates sharing the prefix are skipped.
+func (es *EventStore) scanItems(tx *bbolt.Tx, bucketName []byte, aggregateId pkg.AggregateId) ([]boltItem, error) {
+	bucket := tx.Bucket(bucketName).Bucket([]byte(es.settings.KeyResolver.ResolvePkey(aggregateId, es.shardCount)))
+	if bucket == nil {
+		return nil, nil
+	}
+	prefix := commonPrefix(
+		es.settings.KeyResolver.ResolveSkey(aggregateId, 0),
+		es.settings.KeyResolver.ResolveSkey(aggregateId, math.MaxUint64),
+	)
+	aid := aggregateId.AsString()
+	var items []boltItem
+	cursor := bucket.Cursor()
+	for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+		var item boltItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			return nil, pkg.NewDeserializationError("Failed to decode the item", err)
+		}
+		if item.Aid == aid {
+			items = append(items, item)
+		}
+	}
+	// The skeys of the DefaultKeyResolver are not ordered by seqNr.
+	sort.Slice(items, func(i, j int) bool { return items[i].SeqNr < items[j].SeqNr })
+	return items, nil
+}
+
+// commonPrefix returns the longest common prefix of the strings.
+func commonPrefix(a string, b string) []byte {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return []byte(a[:i])
+}
@@ -0,0 +1,17 @@
+package pkg
+
+import (
+	"context"
+)
+
+// CheckpointStore is the interface for persisting the read positions of consumers.
+type CheckpointStore interface {
+	// GetCheckpoint returns the checkpoint of the specified id.
+	//
+	// An empty string is returned if the checkpoint does not exist.
+	GetCheckpoint(ctx context.Context, id string) (string, error)
+	// SaveCheckpoint saves the checkpoint of the specified id.
+	SaveCheckpoint(ctx context.Context, id string, checkpoint string) error
+	// DeleteCheckpoint deletes the checkpoint of the specified id.
+	DeleteCheckpoint(ctx context.Context, id string) error
+}
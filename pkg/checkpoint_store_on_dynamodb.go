@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CheckpointStoreOnDynamoDB is CheckpointStore for DynamoDB.
+//
+// The table has a string partition key named id.
+type CheckpointStoreOnDynamoDB struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// NewCheckpointStoreOnDynamoDB returns a new CheckpointStoreOnDynamoDB.
+//
+// # Parameters
+// - client is a DynamoDB client.
+// - tableName is a checkpoint table name.
+//
+// # Returns
+// - a CheckpointStoreOnDynamoDB
+// - an error
+func NewCheckpointStoreOnDynamoDB(client *dynamodb.Client, tableName string) (*CheckpointStoreOnDynamoDB, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if tableName == "" {
+		return nil, errors.New("tableName is empty")
+	}
+	return &CheckpointStoreOnDynamoDB{client: client, tableName: tableName}, nil
+}
+
+func (cs *CheckpointStoreOnDynamoDB) GetCheckpoint(ctx context.Context, id string) (string, error) {
+	response, err := cs.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(cs.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", NewIOError("Failed to GetCheckpoint getItem", err)
+	}
+	checkpoint, ok := response.Item["checkpoint"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", nil
+	}
+	return checkpoint.Value, nil
+}
+
+func (cs *CheckpointStoreOnDynamoDB) SaveCheckpoint(ctx context.Context, id string, checkpoint string) error {
+	_, err := cs.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(cs.tableName),
+		Item: map[string]types.AttributeValue{
+			"id":         &types.AttributeValueMemberS{Value: id},
+			"checkpoint": &types.AttributeValueMemberS{Value: checkpoint},
+		},
+	})
+	if err != nil {
+		return NewIOError("Failed to SaveCheckpoint putItem", err)
+	}
+	return nil
+}
+
+func (cs *CheckpointStoreOnDynamoDB) DeleteCheckpoint(ctx context.Context, id string) error {
+	_, err := cs.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(cs.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return NewIOError("Failed to DeleteCheckpoint deleteItem", err)
+	}
+	return nil
+}
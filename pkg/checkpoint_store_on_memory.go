@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+)
+
+// CheckpointStoreOnMemory is the memory implementation of CheckpointStore.
+type CheckpointStoreOnMemory struct {
+	mu          sync.RWMutex
+	checkpoints map[string]string
+}
+
+// NewCheckpointStoreOnMemory is the constructor of CheckpointStoreOnMemory.
+func NewCheckpointStoreOnMemory() *CheckpointStoreOnMemory {
+	return &CheckpointStoreOnMemory{checkpoints: make(map[string]string)}
+}
+
+func (cs *CheckpointStoreOnMemory) GetCheckpoint(_ context.Context, id string) (string, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.checkpoints[id], nil
+}
+
+func (cs *CheckpointStoreOnMemory) SaveCheckpoint(_ context.Context, id string, checkpoint string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.checkpoints[id] = checkpoint
+	return nil
+}
+
+func (cs *CheckpointStoreOnMemory) DeleteCheckpoint(_ context.Context, id string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.checkpoints, id)
+	return nil
+}
@@ -16,7 +16,57 @@ import (
 )
 
 func CreateJournalTable(t *testing.T, ctx context.Context, client *dynamodb.Client, tableName string, gsiName string) error {
-	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+	_, err := client.CreateTable(ctx, journalTableInput(tableName, gsiName))
+	if err != nil {
+		return err
+	}
+	t.Log("created journal table")
+	return nil
+}
+
+// CreateJournalTableWithTypeIndex creates the journal table with an additional GSI keyed by type_name and occurred_at.
+func CreateJournalTableWithTypeIndex(t *testing.T, ctx context.Context, client *dynamodb.Client, tableName string, gsiName string, typeGsiName string) error {
+	input := journalTableInput(tableName, gsiName)
+	input.AttributeDefinitions = append(input.AttributeDefinitions,
+		types.AttributeDefinition{
+			AttributeName: aws.String("type_name"),
+			AttributeType: types.ScalarAttributeTypeS,
+		},
+		types.AttributeDefinition{
+			AttributeName: aws.String("occurred_at"),
+			AttributeType: types.ScalarAttributeTypeN,
+		},
+	)
+	input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+		IndexName: aws.String(typeGsiName),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("type_name"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("occurred_at"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(10),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	})
+	_, err := client.CreateTable(ctx, input)
+	if err != nil {
+		return err
+	}
+	t.Log("created journal table with type index")
+	return nil
+}
+
+func journalTableInput(tableName string, gsiName string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
 		TableName: aws.String(tableName),
 		AttributeDefinitions: []types.AttributeDefinition{
 			{
@@ -72,12 +122,7 @@ func CreateJournalTable(t *testing.T, ctx context.Context, client *dynamodb.Clie
 				},
 			},
 		},
-	})
-	if err != nil {
-		return err
 	}
-	t.Log("created journal table")
-	return nil
 }
 
 func CreateSnapshotTable(t *testing.T, ctx context.Context, client *dynamodb.Client, tableName string, gsiName string) error {
@@ -153,6 +198,92 @@ func CreateSnapshotTable(t *testing.T, ctx context.Context, client *dynamodb.Cli
 	return nil
 }
 
+// CreateOutboxTable creates the outbox table with a GSI keyed by status and next_attempt_at.
+func CreateOutboxTable(t *testing.T, ctx context.Context, client *dynamodb.Client, tableName string, gsiName string) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("id"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("status"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("next_attempt_at"),
+				AttributeType: types.ScalarAttributeTypeN,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("id"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(10),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(gsiName),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("status"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("next_attempt_at"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(10),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	t.Log("created outbox table")
+	return nil
+}
+
+// CreateCheckpointTable creates the checkpoint table used by CheckpointStoreOnDynamoDB.
+func CreateCheckpointTable(t *testing.T, ctx context.Context, client *dynamodb.Client, tableName string) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("id"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("id"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(10),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	t.Log("created checkpoint table")
+	return nil
+}
+
 func CreateDynamoDBClient(t *testing.T, ctx context.Context, l *localstack.LocalStackContainer) (*dynamodb.Client, error) {
 	mappedPort, err := l.MappedPort(ctx, nat.Port("4566/tcp"))
 	if err != nil {
@@ -0,0 +1,18 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg/postgres"
+)
+
+// CreatePostgresTables creates the journal and snapshot tables used by postgres.EventStore.
+func CreatePostgresTables(t *testing.T, ctx context.Context, db *sql.DB, journalTableName string, snapshotTableName string) error {
+	if err := postgres.Migrate(ctx, db, journalTableName, snapshotTableName); err != nil {
+		return err
+	}
+	t.Log("created postgres tables")
+	return nil
+}
@@ -0,0 +1,359 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// EventSubscriber is the function type that handles a persisted event.
+type EventSubscriber func(ctx context.Context, event Event) error
+
+// EventFilter is the function type that reports whether a subscriber receives the event.
+type EventFilter func(event Event) bool
+
+// FilterByAggregateTypeName returns an EventFilter that accepts the events of the aggregate type names.
+func FilterByAggregateTypeName(typeNames ...string) EventFilter {
+	return func(event Event) bool {
+		return slices.Contains(typeNames, event.GetAggregateId().GetTypeName())
+	}
+}
+
+// FilterByEventTypeName returns an EventFilter that accepts the events of the event type names.
+func FilterByEventTypeName(typeNames ...string) EventFilter {
+	return func(event Event) bool {
+		return slices.Contains(typeNames, event.GetTypeName())
+	}
+}
+
+// PublishErrorPolicy decides what happens when a synchronous subscriber fails.
+type PublishErrorPolicy int
+
+const (
+	// PublishErrorPolicyReport passes the error to the error handler of the EventBus and continues.
+	PublishErrorPolicyReport PublishErrorPolicy = iota
+	// PublishErrorPolicyReturn stops the dispatch and returns a PublishError to the caller.
+	PublishErrorPolicyReturn
+)
+
+// EventBus dispatches persisted events to in-process subscribers.
+type EventBus struct {
+	mu            sync.RWMutex
+	subscriptions []*EventSubscription
+	errorHandler  func(ctx context.Context, event Event, err error)
+}
+
+// EventBusOption is an option for EventBus.
+type EventBusOption func(*EventBus) error
+
+// WithEventBusErrorHandler sets the handler of subscriber errors that are not returned to the caller.
+//
+// - The errors of asynchronous subscribers and of subscribers with PublishErrorPolicyReport are passed to it.
+// - The default discards the errors.
+//
+// # Parameters
+// - errorHandler is an error handler.
+//
+// # Returns
+// - an EventBusOption.
+func WithEventBusErrorHandler(errorHandler func(ctx context.Context, event Event, err error)) EventBusOption {
+	return func(b *EventBus) error {
+		if errorHandler == nil {
+			return errors.New("errorHandler is nil")
+		}
+		b.errorHandler = errorHandler
+		return nil
+	}
+}
+
+// NewEventBus returns a new EventBus.
+func NewEventBus(options ...EventBusOption) (*EventBus, error) {
+	b := &EventBus{
+		errorHandler: func(context.Context, Event, error) {},
+	}
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// EventSubscription is a subscriber registered to an EventBus.
+type EventSubscription struct {
+	bus         *EventBus
+	subscriber  EventSubscriber
+	filter      EventFilter
+	errorPolicy PublishErrorPolicy
+	bufferSize  int
+	queue       chan publishedEvent
+	done        chan struct{}
+	workerId    atomic.Uint64
+	mu          sync.RWMutex
+	stopped     bool
+}
+
+// publishedEvent is an event queued for an asynchronous subscriber.
+type publishedEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// SubscribeOption is an option for EventBus.Subscribe.
+type SubscribeOption func(*EventSubscription) error
+
+// WithEventFilter sets the filter of the subscriber.
+//
+// - The default accepts all events.
+func WithEventFilter(filter EventFilter) SubscribeOption {
+	return func(s *EventSubscription) error {
+		if filter == nil {
+			return errors.New("filter is nil")
+		}
+		s.filter = filter
+		return nil
+	}
+}
+
+// WithAsync makes the subscriber asynchronous with a buffer of the specified size.
+//
+// - Publish blocks while the buffer is full.
+// - The default is synchronous.
+func WithAsync(bufferSize int) SubscribeOption {
+	return func(s *EventSubscription) error {
+		if bufferSize <= 0 {
+			return errors.New("bufferSize is not positive")
+		}
+		s.bufferSize = bufferSize
+		return nil
+	}
+}
+
+// WithPublishErrorPolicy sets the policy applied when the synchronous subscriber fails.
+//
+// - The default is PublishErrorPolicyReport.
+func WithPublishErrorPolicy(errorPolicy PublishErrorPolicy) SubscribeOption {
+	return func(s *EventSubscription) error {
+		s.errorPolicy = errorPolicy
+		return nil
+	}
+}
+
+// Subscribe registers the subscriber.
+//
+// # Parameters
+// - subscriber is an event subscriber.
+// - options is a SubscribeOption.
+//
+// # Returns
+// - an EventSubscription
+// - an error
+func (b *EventBus) Subscribe(subscriber EventSubscriber, options ...SubscribeOption) (*EventSubscription, error) {
+	if subscriber == nil {
+		return nil, errors.New("subscriber is nil")
+	}
+	s := &EventSubscription{
+		bus:         b,
+		subscriber:  subscriber,
+		filter:      func(Event) bool { return true },
+		errorPolicy: PublishErrorPolicyReport,
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.bufferSize > 0 {
+		s.queue = make(chan publishedEvent, s.bufferSize)
+		s.done = make(chan struct{})
+		go s.run()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, s)
+	return s, nil
+}
+
+// Publish dispatches the event to the subscribers whose filter accepts it.
+//
+// Synchronous subscribers are called in the order of registration before Publish returns.
+// A PublishError is returned if a subscriber with PublishErrorPolicyReturn fails,
+// or if the context is done while the buffer of an asynchronous subscriber is full.
+// The subscribers are those registered when Publish is called, so a subscriber may
+// Subscribe or Unsubscribe while it handles the event.
+func (b *EventBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	subscriptions := slices.Clone(b.subscriptions)
+	b.mu.RUnlock()
+	for _, s := range subscriptions {
+		if !s.filter(event) {
+			continue
+		}
+		if s.queue != nil {
+			if err := s.enqueue(ctx, event); err != nil {
+				return NewPublishError("Failed to enqueue the event for an asynchronous subscriber", err)
+			}
+			continue
+		}
+		if err := s.subscriber(ctx, event); err != nil {
+			if s.errorPolicy == PublishErrorPolicyReturn {
+				return NewPublishError("Failed to publish the event to a subscriber", err)
+			}
+			b.errorHandler(ctx, event, err)
+		}
+	}
+	return nil
+}
+
+// Close unsubscribes all subscribers, waiting for the asynchronous ones to drain their buffers.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	subscriptions := b.subscriptions
+	b.subscriptions = nil
+	b.mu.Unlock()
+	for _, s := range subscriptions {
+		s.stop()
+	}
+}
+
+// Unsubscribe removes the subscriber from the EventBus.
+//
+// For an asynchronous subscriber, it waits until the buffered events are handled,
+// unless it is called by the subscriber itself, in which case they are handled after the subscriber returns.
+func (s *EventSubscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	s.bus.subscriptions = slices.DeleteFunc(s.bus.subscriptions, func(other *EventSubscription) bool {
+		return other == s
+	})
+	s.bus.mu.Unlock()
+	s.stop()
+}
+
+// enqueue puts the event into the buffer of an asynchronous subscriber.
+//
+// The event is dropped if the subscriber has been unsubscribed.
+func (s *EventSubscription) enqueue(ctx context.Context, event Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return nil
+	}
+	select {
+	case s.queue <- publishedEvent{ctx: context.WithoutCancel(ctx), event: event}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop closes the buffer of an asynchronous subscriber and waits for the worker.
+func (s *EventSubscription) stop() {
+	if s.queue == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	// The worker would wait for itself.
+	if workerId := s.workerId.Load(); workerId != 0 && workerId == currentGoroutineId() {
+		return
+	}
+	<-s.done
+}
+
+// run handles the buffered events of an asynchronous subscriber.
+func (s *EventSubscription) run() {
+	defer close(s.done)
+	s.workerId.Store(currentGoroutineId())
+	for published := range s.queue {
+		if err := s.subscriber(published.ctx, published.event); err != nil {
+			s.bus.errorHandler(published.ctx, published.event, err)
+		}
+	}
+}
+
+// currentGoroutineId returns the id of the calling goroutine, parsed from the header of its stack trace.
+func currentGoroutineId() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// The header is "goroutine <id> [<status>]:".
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
+	}
+	id, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// PublishingEventStore is an EventStore that publishes events to an EventBus after they are persisted.
+type PublishingEventStore struct {
+	eventStore EventStore
+	eventBus   *EventBus
+}
+
+// NewPublishingEventStore returns an EventStore that publishes persisted events to the EventBus.
+//
+// # Parameters
+// - eventStore is the EventStore to decorate.
+// - eventBus is the EventBus to publish to.
+//
+// # Returns
+// - an EventStore
+func NewPublishingEventStore(eventStore EventStore, eventBus *EventBus) EventStore {
+	return &PublishingEventStore{eventStore: eventStore, eventBus: eventBus}
+}
+
+func (es *PublishingEventStore) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	return es.eventStore.GetLatestSnapshotById(ctx, aggregateId)
+}
+
+func (es *PublishingEventStore) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	return es.eventStore.GetEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+}
+
+// GetEventsByIdSinceSeqNrWithLimit delegates to the underlying EventStore,
+// applying the limit in the query if it is a LimitedEventReader.
+func (es *PublishingEventStore) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error) {
+	return getEventsByIdSinceSeqNrWithLimit(ctx, es.eventStore, aggregateId, seqNr, limit)
+}
+
+// GetLatestSnapshotsByIds delegates to the underlying EventStore,
+// loading the aggregates one by one if it is not a BatchAggregateReader.
+func (es *PublishingEventStore) GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) ([]AggregateLoadResult, error) {
+	return getLatestSnapshotsByIds(ctx, es.eventStore, aggregateIds)
+}
+
+// GetEventsByTypeNameAndOccurredAt delegates to the underlying EventStore if it is an EventTypeReader.
+func (es *PublishingEventStore) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	reader, ok := es.eventStore.(EventTypeReader)
+	if !ok {
+		return nil, errors.New("the underlying EventStore is not an EventTypeReader")
+	}
+	return reader.GetEventsByTypeNameAndOccurredAt(ctx, typeName, from, to)
+}
+
+func (es *PublishingEventStore) PersistEvent(ctx context.Context, event Event, version uint64) error {
+	if err := es.eventStore.PersistEvent(ctx, event, version); err != nil {
+		return err
+	}
+	return es.eventBus.Publish(ctx, event)
+}
+
+func (es *PublishingEventStore) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
+	if err := es.eventStore.PersistEventAndSnapshot(ctx, event, aggregate); err != nil {
+		return err
+	}
+	return es.eventBus.Publish(ctx, event)
+}
@@ -16,6 +16,120 @@ type EventStore interface {
 	PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error
 }
 
+// EventTypeReader is the interface for reading events across aggregates by the type name of the event.
+//
+// It is implemented by EventStoreOnDynamoDB (when the type name index is configured) and the other event stores of this package.
+type EventTypeReader interface {
+	// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name
+	// whose occurred at is within [from, to], ordered by occurred at.
+	GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]Event, error)
+}
+
+// LimitedEventReader is the interface for reading a bounded number of the events of an aggregate.
+//
+// It is implemented by EventStoreOnDynamoDB, EventStoreOnMemory and the SQL event stores.
+type LimitedEventReader interface {
+	// GetEventsByIdSinceSeqNrWithLimit returns up to limit events of the aggregate since the specified sequence number.
+	GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error)
+}
+
+// getEventsByIdSinceSeqNrWithLimit returns up to limit events of the aggregate since the specified sequence number.
+//
+// The limit is applied in the query if the EventStore is a LimitedEventReader,
+// and to all the events since the sequence number otherwise.
+func getEventsByIdSinceSeqNrWithLimit(ctx context.Context, eventStore EventStore, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error) {
+	if reader, ok := eventStore.(LimitedEventReader); ok {
+		return reader.GetEventsByIdSinceSeqNrWithLimit(ctx, aggregateId, seqNr, limit)
+	}
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// BatchAggregateReader is the interface for loading many aggregates at once.
+//
+// It is implemented by EventStoreOnDynamoDB, and by the decorators of this package,
+// which load the aggregates one by one if the underlying EventStore is not a BatchAggregateReader.
+type BatchAggregateReader interface {
+	// GetLatestSnapshotsByIds returns the latest snapshots of the aggregates and the events after them,
+	// in the order of the aggregate ids.
+	GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) ([]AggregateLoadResult, error)
+}
+
+// getLatestSnapshotsByIds returns the latest snapshots of the aggregates and the events after them,
+// in the order of the aggregate ids.
+//
+// The aggregates are loaded at once if the EventStore is a BatchAggregateReader, and one by one otherwise.
+func getLatestSnapshotsByIds(ctx context.Context, eventStore EventStore, aggregateIds []AggregateId) ([]AggregateLoadResult, error) {
+	if reader, ok := eventStore.(BatchAggregateReader); ok {
+		return reader.GetLatestSnapshotsByIds(ctx, aggregateIds)
+	}
+	uniqueIds, indexes := uniqueAggregateIds(aggregateIds)
+	results := make([]AggregateLoadResult, len(uniqueIds))
+	for i, aggregateId := range uniqueIds {
+		results[i] = loadAggregateById(ctx, eventStore, aggregateId)
+	}
+	return fanOutLoadResults(aggregateIds, results, indexes), nil
+}
+
+// loadAggregateById returns the latest snapshot of the aggregate and the events after it, or the error.
+func loadAggregateById(ctx context.Context, eventStore EventStore, aggregateId AggregateId) AggregateLoadResult {
+	snapshot, err := eventStore.GetLatestSnapshotById(ctx, aggregateId)
+	if err != nil {
+		return AggregateLoadResult{AggregateId: aggregateId, Err: err}
+	}
+	if snapshot.Empty() {
+		return AggregateLoadResult{AggregateId: aggregateId, Snapshot: snapshot}
+	}
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, aggregateId, snapshot.Aggregate().GetSeqNr()+1)
+	if err != nil {
+		return AggregateLoadResult{AggregateId: aggregateId, Err: err}
+	}
+	return AggregateLoadResult{AggregateId: aggregateId, Snapshot: snapshot, Events: events}
+}
+
+// uniqueAggregateIds returns the aggregate ids without duplicates,
+// and the index of each of the given aggregate ids in them.
+func uniqueAggregateIds(aggregateIds []AggregateId) ([]AggregateId, []int) {
+	var uniqueIds []AggregateId
+	indexes := make([]int, len(aggregateIds))
+	seen := make(map[string]int, len(aggregateIds))
+	for i, aggregateId := range aggregateIds {
+		index, ok := seen[aggregateId.AsString()]
+		if !ok {
+			index = len(uniqueIds)
+			seen[aggregateId.AsString()] = index
+			uniqueIds = append(uniqueIds, aggregateId)
+		}
+		indexes[i] = index
+	}
+	return uniqueIds, indexes
+}
+
+// fanOutLoadResults returns the results of the unique aggregate ids in the order of the aggregate ids,
+// by the indexes returned by uniqueAggregateIds.
+func fanOutLoadResults(aggregateIds []AggregateId, uniqueResults []AggregateLoadResult, indexes []int) []AggregateLoadResult {
+	results := make([]AggregateLoadResult, len(aggregateIds))
+	for i, index := range indexes {
+		results[i] = uniqueResults[index]
+		results[i].AggregateId = aggregateIds[i]
+	}
+	return results
+}
+
+// HashChainVerifier is the interface for verifying the hash chain of the journal of an aggregate.
+//
+// It is implemented by EventStoreOnDynamoDB.
+type HashChainVerifier interface {
+	// VerifyHashChain walks the events of the aggregate and reports the first broken link of their hash chain.
+	VerifyHashChain(ctx context.Context, aggregateId AggregateId) (*HashChainVerification, error)
+}
+
 // AggregateId is the interface that represents the aggregate id of DDD.
 type AggregateId interface {
 	String() string
@@ -0,0 +1,243 @@
+package pkg
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CachingEventStore is an EventStore that caches the recently loaded aggregates of the underlying EventStore.
+//
+// An entry holds the latest snapshot of an aggregate with its version and, once they are read, the events after it.
+// A successful write updates the entry when its version matches, and any failed write, such as
+// an OptimisticLockError, invalidates it, so the next load reads through to the underlying EventStore.
+//
+// The entries are bounded by an LRU of the capacity and expire after the ttl,
+// which bounds how long writes by other instances can go unnoticed by reads.
+type CachingEventStore struct {
+	eventStore EventStore
+	capacity   int
+	ttl        time.Duration
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+// cacheEntry is an entry of CachingEventStore.
+type cacheEntry struct {
+	aid      string
+	snapshot Aggregate
+	// events are the events after the snapshot, valid if eventsLoaded is true.
+	events       []Event
+	eventsLoaded bool
+	expireAt     time.Time
+}
+
+// NewCachingEventStore returns a new CachingEventStore.
+//
+// # Parameters
+// - eventStore is the EventStore to cache.
+// - capacity is the maximum number of cached aggregates.
+// - ttl is the time after which an entry expires. If 0, entries do not expire.
+//
+// # Returns
+// - a CachingEventStore
+// - an error
+func NewCachingEventStore(eventStore EventStore, capacity int, ttl time.Duration) (*CachingEventStore, error) {
+	if eventStore == nil {
+		return nil, errors.New("eventStore is nil")
+	}
+	if capacity <= 0 {
+		return nil, errors.New("capacity is not positive")
+	}
+	if ttl < 0 {
+		return nil, errors.New("ttl is negative")
+	}
+	return &CachingEventStore{
+		eventStore: eventStore,
+		capacity:   capacity,
+		ttl:        ttl,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}, nil
+}
+
+func (es *CachingEventStore) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	if entry := es.get(aggregateId.AsString()); entry != nil {
+		// Return a copy so that the caller can not modify the cached snapshot.
+		return &AggregateResult{aggregate: entry.snapshot.WithVersion(entry.snapshot.GetVersion())}, nil
+	}
+
+	result, err := es.eventStore.GetLatestSnapshotById(ctx, aggregateId)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Empty() {
+		es.put(&cacheEntry{aid: aggregateId.AsString(), snapshot: result.Aggregate()})
+	}
+	return result, nil
+}
+
+func (es *CachingEventStore) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	aid := aggregateId.AsString()
+	entry := es.get(aid)
+	if entry != nil && entry.eventsLoaded && seqNr > entry.snapshot.GetSeqNr() {
+		return eventsSince(entry.events, seqNr), nil
+	}
+
+	events, err := es.eventStore.GetEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && !entry.eventsLoaded && seqNr <= entry.snapshot.GetSeqNr()+1 {
+		es.update(aid, entry.snapshot.GetVersion(), func(e *cacheEntry) {
+			e.events = eventsSince(events, e.snapshot.GetSeqNr()+1)
+			e.eventsLoaded = true
+		})
+	}
+	return events, nil
+}
+
+// GetEventsByIdSinceSeqNrWithLimit delegates to the underlying EventStore without caching,
+// applying the limit in the query if it is a LimitedEventReader.
+func (es *CachingEventStore) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error) {
+	return getEventsByIdSinceSeqNrWithLimit(ctx, es.eventStore, aggregateId, seqNr, limit)
+}
+
+// GetLatestSnapshotsByIds delegates to the underlying EventStore without caching,
+// loading the aggregates one by one if it is not a BatchAggregateReader.
+func (es *CachingEventStore) GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) ([]AggregateLoadResult, error) {
+	return getLatestSnapshotsByIds(ctx, es.eventStore, aggregateIds)
+}
+
+// GetEventsByTypeNameAndOccurredAt delegates to the underlying EventStore if it is an EventTypeReader, without caching.
+func (es *CachingEventStore) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	reader, ok := es.eventStore.(EventTypeReader)
+	if !ok {
+		return nil, errors.New("the underlying EventStore is not an EventTypeReader")
+	}
+	return reader.GetEventsByTypeNameAndOccurredAt(ctx, typeName, from, to)
+}
+
+func (es *CachingEventStore) PersistEvent(ctx context.Context, event Event, version uint64) error {
+	aid := event.GetAggregateId().AsString()
+	if err := es.eventStore.PersistEvent(ctx, event, version); err != nil {
+		es.invalidate(aid)
+		return err
+	}
+	es.update(aid, version, func(e *cacheEntry) {
+		e.snapshot = e.snapshot.WithVersion(version + 1)
+		if e.eventsLoaded {
+			e.events = append(e.events[:len(e.events):len(e.events)], event)
+		}
+	})
+	return nil
+}
+
+func (es *CachingEventStore) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
+	aid := event.GetAggregateId().AsString()
+	if err := es.eventStore.PersistEventAndSnapshot(ctx, event, aggregate); err != nil {
+		es.invalidate(aid)
+		return err
+	}
+	version := initialVersion
+	if !event.IsCreated() {
+		version = aggregate.GetVersion() + 1
+	}
+	es.put(&cacheEntry{aid: aid, snapshot: aggregate.WithVersion(version), events: []Event{}, eventsLoaded: true})
+	return nil
+}
+
+// Invalidate removes the aggregate from the cache.
+func (es *CachingEventStore) Invalidate(aggregateId AggregateId) {
+	es.invalidate(aggregateId.AsString())
+}
+
+// Len returns the number of cached aggregates, including expired ones not yet evicted.
+func (es *CachingEventStore) Len() int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.lru.Len()
+}
+
+// get returns a copy of the unexpired entry of the aid, or nil.
+func (es *CachingEventStore) get(aid string) *cacheEntry {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	element, ok := es.entries[aid]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if es.ttl > 0 && !time.Now().Before(entry.expireAt) {
+		es.removeElement(element)
+		return nil
+	}
+	es.lru.MoveToFront(element)
+	result := *entry
+	return &result
+}
+
+// put stores the entry unless a newer version is cached, evicting the least recently used one if the capacity is exceeded.
+func (es *CachingEventStore) put(entry *cacheEntry) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	entry.expireAt = time.Now().Add(es.ttl)
+	if element, ok := es.entries[entry.aid]; ok {
+		// A read racing with a write may put an older snapshot than the one cached by the write.
+		if element.Value.(*cacheEntry).snapshot.GetVersion() > entry.snapshot.GetVersion() {
+			return
+		}
+		element.Value = entry
+		es.lru.MoveToFront(element)
+		return
+	}
+	es.entries[entry.aid] = es.lru.PushFront(entry)
+	if es.lru.Len() > es.capacity {
+		es.removeElement(es.lru.Back())
+	}
+}
+
+// update applies the function to a copy of the entry of the aid if its version matches, or invalidates the entry otherwise.
+func (es *CachingEventStore) update(aid string, version uint64, f func(*cacheEntry)) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	element, ok := es.entries[aid]
+	if !ok {
+		return
+	}
+	entry := element.Value.(*cacheEntry)
+	if entry.snapshot.GetVersion() != version {
+		es.removeElement(element)
+		return
+	}
+	updated := *entry
+	f(&updated)
+	element.Value = &updated
+}
+
+func (es *CachingEventStore) invalidate(aid string) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if element, ok := es.entries[aid]; ok {
+		es.removeElement(element)
+	}
+}
+
+func (es *CachingEventStore) removeElement(element *list.Element) {
+	es.lru.Remove(element)
+	delete(es.entries, element.Value.(*cacheEntry).aid)
+}
+
+// eventsSince returns a copy of the events whose seqNr is at least seqNr.
+func eventsSince(events []Event, seqNr uint64) []Event {
+	result := make([]Event, 0, len(events))
+	for _, event := range events {
+		if event.GetSeqNr() >= seqNr {
+			result = append(result, event)
+		}
+	}
+	return result
+}
@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventStoreMiddleware wraps an EventStore to add behaviour to its operations.
+type EventStoreMiddleware func(next EventStore) EventStore
+
+// ChainEventStore wraps the EventStore in the middlewares.
+//
+// The first middleware is the outermost, so it sees each operation first and its result last.
+//
+// # Parameters
+// - eventStore is the EventStore to wrap.
+// - middlewares are the middlewares to wrap it in.
+//
+// # Returns
+// - an EventStore
+func ChainEventStore(eventStore EventStore, middlewares ...EventStoreMiddleware) EventStore {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		eventStore = middlewares[i](eventStore)
+	}
+	return eventStore
+}
+
+// TracingMiddleware returns the middleware that wraps the EventStore in a TracingEventStore.
+func TracingMiddleware(tracerProvider trace.TracerProvider) EventStoreMiddleware {
+	return func(next EventStore) EventStore {
+		return NewTracingEventStore(next, tracerProvider)
+	}
+}
+
+// EventStoreHooks are the functions called before and after the operations of an EventStore.
+//
+// Each hook is optional. An error returned by a before hook vetoes the operation, which is not
+// passed to the EventStore, and the error is returned to the caller. An after hook receives the
+// result of the operation and returns the error to return to the caller, which is usually the
+// given error.
+type EventStoreHooks struct {
+	// BeforeRead is called before GetLatestSnapshotById, GetEventsByIdSinceSeqNr and GetEventsByIdSinceSeqNrWithLimit,
+	// and for each aggregate of GetLatestSnapshotsByIds.
+	BeforeRead func(ctx context.Context, aggregateId AggregateId) error
+
+	// AfterGetLatestSnapshotById is called with the result of GetLatestSnapshotById,
+	// and with the snapshot of each aggregate of GetLatestSnapshotsByIds.
+	AfterGetLatestSnapshotById func(ctx context.Context, aggregateId AggregateId, result *AggregateResult, err error) error
+
+	// AfterGetEventsByIdSinceSeqNr is called with the result of GetEventsByIdSinceSeqNr and GetEventsByIdSinceSeqNrWithLimit,
+	// and with the events of each aggregate of GetLatestSnapshotsByIds.
+	AfterGetEventsByIdSinceSeqNr func(ctx context.Context, aggregateId AggregateId, events []Event, err error) error
+
+	// BeforeReadByTypeName is called before GetEventsByTypeNameAndOccurredAt.
+	BeforeReadByTypeName func(ctx context.Context, typeName string, from uint64, to uint64) error
+
+	// AfterGetEventsByTypeNameAndOccurredAt is called with the result of GetEventsByTypeNameAndOccurredAt.
+	AfterGetEventsByTypeNameAndOccurredAt func(ctx context.Context, typeName string, events []Event, err error) error
+
+	// BeforeWrite is called before PersistEvent and PersistEventAndSnapshot.
+	// The aggregate is nil for PersistEvent, and version is the version of the aggregate before the write.
+	BeforeWrite func(ctx context.Context, event Event, aggregate Aggregate, version uint64) error
+
+	// AfterWrite is called with the result of PersistEvent and PersistEventAndSnapshot.
+	AfterWrite func(ctx context.Context, event Event, aggregate Aggregate, err error) error
+}
+
+// HooksMiddleware returns the middleware that calls the hooks around the operations of the EventStore.
+//
+// GetEventsByTypeNameAndOccurredAt is supported if the EventStore is an EventTypeReader.
+func HooksMiddleware(hooks EventStoreHooks) EventStoreMiddleware {
+	return func(next EventStore) EventStore {
+		return &hookedEventStore{next: next, hooks: hooks}
+	}
+}
+
+// hookedEventStore is the EventStore returned by HooksMiddleware.
+type hookedEventStore struct {
+	next  EventStore
+	hooks EventStoreHooks
+}
+
+func (es *hookedEventStore) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	if es.hooks.BeforeRead != nil {
+		if err := es.hooks.BeforeRead(ctx, aggregateId); err != nil {
+			return nil, err
+		}
+	}
+	result, err := es.next.GetLatestSnapshotById(ctx, aggregateId)
+	if es.hooks.AfterGetLatestSnapshotById != nil {
+		err = es.hooks.AfterGetLatestSnapshotById(ctx, aggregateId, result, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (es *hookedEventStore) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	return es.readEvents(ctx, aggregateId, func() ([]Event, error) {
+		return es.next.GetEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+	})
+}
+
+func (es *hookedEventStore) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error) {
+	return es.readEvents(ctx, aggregateId, func() ([]Event, error) {
+		return getEventsByIdSinceSeqNrWithLimit(ctx, es.next, aggregateId, seqNr, limit)
+	})
+}
+
+// readEvents calls the read hooks around read, which reads the events of the aggregate.
+func (es *hookedEventStore) readEvents(ctx context.Context, aggregateId AggregateId, read func() ([]Event, error)) ([]Event, error) {
+	if es.hooks.BeforeRead != nil {
+		if err := es.hooks.BeforeRead(ctx, aggregateId); err != nil {
+			return nil, err
+		}
+	}
+	events, err := read()
+	if es.hooks.AfterGetEventsByIdSinceSeqNr != nil {
+		err = es.hooks.AfterGetEventsByIdSinceSeqNr(ctx, aggregateId, events, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetLatestSnapshotsByIds calls the read hooks for each aggregate. An aggregate whose read is vetoed
+// is not loaded, and the error is set to its result.
+func (es *hookedEventStore) GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) ([]AggregateLoadResult, error) {
+	results := make([]AggregateLoadResult, len(aggregateIds))
+	var allowedIds []AggregateId
+	var allowed []int
+	for i, aggregateId := range aggregateIds {
+		results[i].AggregateId = aggregateId
+		if es.hooks.BeforeRead != nil {
+			if err := es.hooks.BeforeRead(ctx, aggregateId); err != nil {
+				results[i].Err = err
+				continue
+			}
+		}
+		allowedIds = append(allowedIds, aggregateId)
+		allowed = append(allowed, i)
+	}
+	if len(allowedIds) == 0 {
+		return results, nil
+	}
+	loaded, err := getLatestSnapshotsByIds(ctx, es.next, allowedIds)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range allowed {
+		results[i] = es.afterLoad(ctx, loaded[j])
+	}
+	return results, nil
+}
+
+// afterLoad calls the after hooks of the reads with the loaded aggregate, and returns the result to return to the caller.
+func (es *hookedEventStore) afterLoad(ctx context.Context, result AggregateLoadResult) AggregateLoadResult {
+	err := result.Err
+	if es.hooks.AfterGetLatestSnapshotById != nil {
+		err = es.hooks.AfterGetLatestSnapshotById(ctx, result.AggregateId, result.Snapshot, err)
+	}
+	if err == nil && result.Err == nil && es.hooks.AfterGetEventsByIdSinceSeqNr != nil {
+		err = es.hooks.AfterGetEventsByIdSinceSeqNr(ctx, result.AggregateId, result.Events, nil)
+	}
+	if err != nil {
+		return AggregateLoadResult{AggregateId: result.AggregateId, Err: err}
+	}
+	return result
+}
+
+func (es *hookedEventStore) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	reader, ok := es.next.(EventTypeReader)
+	if !ok {
+		return nil, errors.New("the underlying EventStore is not an EventTypeReader")
+	}
+	if es.hooks.BeforeReadByTypeName != nil {
+		if err := es.hooks.BeforeReadByTypeName(ctx, typeName, from, to); err != nil {
+			return nil, err
+		}
+	}
+	events, err := reader.GetEventsByTypeNameAndOccurredAt(ctx, typeName, from, to)
+	if es.hooks.AfterGetEventsByTypeNameAndOccurredAt != nil {
+		err = es.hooks.AfterGetEventsByTypeNameAndOccurredAt(ctx, typeName, events, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (es *hookedEventStore) PersistEvent(ctx context.Context, event Event, version uint64) error {
+	if es.hooks.BeforeWrite != nil {
+		if err := es.hooks.BeforeWrite(ctx, event, nil, version); err != nil {
+			return err
+		}
+	}
+	err := es.next.PersistEvent(ctx, event, version)
+	if es.hooks.AfterWrite != nil {
+		err = es.hooks.AfterWrite(ctx, event, nil, err)
+	}
+	return err
+}
+
+func (es *hookedEventStore) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
+	if es.hooks.BeforeWrite != nil {
+		if err := es.hooks.BeforeWrite(ctx, event, aggregate, aggregate.GetVersion()); err != nil {
+			return err
+		}
+	}
+	err := es.next.PersistEventAndSnapshot(ctx, event, aggregate)
+	if es.hooks.AfterWrite != nil {
+		err = es.hooks.AfterWrite(ctx, event, aggregate, err)
+	}
+	return err
+}
@@ -3,139 +3,141 @@ package pkg
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"math"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EventStoreOnDynamoDB is EventStore for DynamoDB.
 type EventStoreOnDynamoDB struct {
+	eventStoreConfig
 	client               *dynamodb.Client
 	journalTableName     string
 	snapshotTableName    string
 	journalAidIndexName  string
 	snapshotAidIndexName string
 	shardCount           uint64
-	eventConverter       EventConverter
-	snapshotConverter    AggregateConverter
-	keepSnapshot         bool
-	keepSnapshotCount    uint32
-	deleteTtl            time.Duration
-	keyResolver          KeyResolver
-	eventSerializer      EventSerializer
-	snapshotSerializer   SnapshotSerializer
+	// nextShardCount is the shard count the items are being resharded to, or 0.
+	nextShardCount    uint64
+	eventConverter    EventConverter
+	snapshotConverter AggregateConverter
 }
 
-// EventStoreOption is an option for EventStore.
-type EventStoreOption func(*EventStoreOnDynamoDB) error
-
-// WithKeepSnapshot sets whether or not to keep snapshots.
+// WithJournalTypeIndexName sets the name of the journal index keyed by type_name and occurred_at.
 //
-// - If you want to keep snapshots, specify true.
-// - If you do not want to keep snapshots, specify false.
-// - The default is false.
+// - If you want to query events by type name, specify the index name.
+// - The default is empty, and GetEventsByTypeNameAndOccurredAt returns an error.
 //
 // # Parameters
-// - keepSnapshot is whether or not to keep snapshots.
+// - journalTypeIndexName is a journal type name index name.
 //
 // # Returns
 // - an EventStoreOption.
-func WithKeepSnapshot(keepSnapshot bool) EventStoreOption {
-	return func(es *EventStoreOnDynamoDB) error {
-		es.keepSnapshot = keepSnapshot
+func WithJournalTypeIndexName(journalTypeIndexName string) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if journalTypeIndexName == "" {
+			return errors.New("journalTypeIndexName is empty")
+		}
+		c.journalTypeIndexName = journalTypeIndexName
 		return nil
 	}
 }
 
-// WithDeleteTtl sets the ttl for deletion snapshots.
+// WithOutboxTableName sets the name of the outbox table.
 //
-// - If you want to delete snapshots, specify a time.Duration.
-// - If you do not want to delete snapshots, specify math.MaxInt64.
-// - The default is math.MaxInt64.
+// - If you want to relay events to external brokers, specify the outbox table name.
+// - An outbox item is written in the same transaction as each event, and OutboxRelay publishes it.
+// - The default is empty, and no outbox items are written.
+// - Only EventStoreOnDynamoDB supports it, and the other event stores return an error.
 //
 // # Parameters
-// - deleteTtl is the time to live for deletion snapshots.
+// - outboxTableName is an outbox table name.
 //
 // # Returns
 // - an EventStoreOption.
-func WithDeleteTtl(deleteTtl time.Duration) EventStoreOption {
-	return func(es *EventStoreOnDynamoDB) error {
-		es.deleteTtl = deleteTtl
+func WithOutboxTableName(outboxTableName string) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if outboxTableName == "" {
+			return errors.New("outboxTableName is empty")
+		}
+		c.outboxTableName = outboxTableName
+		c.dynamoDBOnlyOptions = append(c.dynamoDBOnlyOptions, "WithOutboxTableName")
 		return nil
 	}
 }
 
-// WithKeepSnapshotCount sets a keep snapshot count.
+// WithTracerProvider sets the TracerProvider of the spans created for each operation.
 //
-// - If you want to keep snapshots, specify a keep snapshot count.
-// - If you do not want to keep snapshots, specify math.MaxInt64.
-// - The default is math.MaxInt64.
+// - The spans are created by EventStoreOnDynamoDB; wrap other EventStores with NewTracingEventStore.
+// - The context of the span is passed to the DynamoDB client, so instrumented clients create child spans.
+// - The default is a no-op TracerProvider, and no spans are created.
 //
 // # Parameters
-// - keepSnapshotCount is a keep snapshot count.
+// - tracerProvider is a TracerProvider.
 //
 // # Returns
 // - an EventStoreOption.
-func WithKeepSnapshotCount(keepSnapshotCount uint32) EventStoreOption {
-	return func(es *EventStoreOnDynamoDB) error {
-		es.keepSnapshotCount = keepSnapshotCount
+func WithTracerProvider(tracerProvider trace.TracerProvider) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if tracerProvider == nil {
+			return errors.New("tracerProvider is nil")
+		}
+		c.tracer = tracerProvider.Tracer(tracerName)
 		return nil
 	}
 }
 
-// WithKeyResolver sets a key resolver.
+// WithConsistentRead sets whether to read snapshots and events with strongly consistent reads.
 //
-// - If you want to change the key resolver, specify a KeyResolver.
-// - The default is DefaultKeyResolver.
+// - The aid indexes are only eventually consistent, so a read right after a write may miss it.
+// - Consistent reads get the snapshot by its primary key and query the events by pkey, which costs more when a shard holds many aggregates.
+// - Use ContextWithConsistentRead to choose per call.
+// - The default is false.
+// - Only EventStoreOnDynamoDB supports it, and the other event stores return an error.
 //
 // # Parameters
-// - keyResolver is a key resolver.
+// - consistentRead is whether to read with strongly consistent reads.
 //
 // # Returns
 // - an EventStoreOption.
-func WithKeyResolver(keyResolver KeyResolver) EventStoreOption {
-	return func(es *EventStoreOnDynamoDB) error {
-		es.keyResolver = keyResolver
+func WithConsistentRead(consistentRead bool) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.consistentRead = consistentRead
+		c.dynamoDBOnlyOptions = append(c.dynamoDBOnlyOptions, "WithConsistentRead")
 		return nil
 	}
 }
 
-// WithEventSerializer sets an event serializer.
-//
-// - If you want to change the event serializer, specify an EventSerializer.
-// - The default is DefaultEventSerializer.
+type consistentReadKey struct{}
+
+// ContextWithConsistentRead returns a context that overrides, for the reads made with it,
+// whether EventStoreOnDynamoDB reads with strongly consistent reads, as set by WithConsistentRead.
 //
 // # Parameters
-// - eventSerializer is an event serializer.
+// - ctx is the parent context.
+// - consistentRead is whether to read with strongly consistent reads.
 //
 // # Returns
-// - an EventStoreOption.
-func WithEventSerializer(eventSerializer EventSerializer) EventStoreOption {
-	return func(es *EventStoreOnDynamoDB) error {
-		es.eventSerializer = eventSerializer
-		return nil
-	}
+// - a context
+func ContextWithConsistentRead(ctx context.Context, consistentRead bool) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, consistentRead)
 }
 
-// WithSnapshotSerializer sets a snapshot serializer.
-//
-// - If you want to change the snapshot serializer, specify a SnapshotSerializer.
-// - The default is DefaultSnapshotSerializer.
-//
-// # Parameters
-// - snapshotSerializer is a snapshot serializer.
-//
-// # Returns
-// - an EventStoreOption.
-func WithSnapshotSerializer(snapshotSerializer SnapshotSerializer) EventStoreOption {
-	return func(es *EventStoreOnDynamoDB) error {
-		es.snapshotSerializer = snapshotSerializer
-		return nil
+// isConsistentRead returns whether to read with strongly consistent reads for the context.
+func (es *EventStoreOnDynamoDB) isConsistentRead(ctx context.Context) bool {
+	if consistentRead, ok := ctx.Value(consistentReadKey{}).(bool); ok {
+		return consistentRead
 	}
+	return es.consistentRead
 }
 
 // NewEventStoreOnDynamoDB returns a new EventStore.
@@ -183,7 +185,12 @@ func NewEventStoreOnDynamoDB(
 	if shardCount == 0 {
 		return nil, errors.New("shardCount is zero")
 	}
+	config, err := newEventStoreConfig(options...)
+	if err != nil {
+		return nil, err
+	}
 	es := &EventStoreOnDynamoDB{
+		eventStoreConfig:     config,
 		client:               client,
 		journalTableName:     journalTableName,
 		snapshotTableName:    snapshotTableName,
@@ -192,15 +199,9 @@ func NewEventStoreOnDynamoDB(
 		shardCount:           shardCount,
 		eventConverter:       eventConverter,
 		snapshotConverter:    snapshotConverter,
-		keepSnapshot:         false,
-		keepSnapshotCount:    1,
-		deleteTtl:            math.MaxInt64,
-		keyResolver:          &DefaultKeyResolver{},
-		eventSerializer:      &DefaultEventSerializer{},
-		snapshotSerializer:   &DefaultSnapshotSerializer{},
-	}
-	for _, option := range options {
-		if err := option(es); err != nil {
+	}
+	if config.shardLayoutCheckContext != nil {
+		if err := es.checkShardLayout(config.shardLayoutCheckContext); err != nil {
 			return nil, err
 		}
 	}
@@ -208,12 +209,30 @@ func NewEventStoreOnDynamoDB(
 	return es, nil
 }
 
-func (es *EventStoreOnDynamoDB) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+func (es *EventStoreOnDynamoDB) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (result *AggregateResult, err error) {
+	ctx, span := startGetLatestSnapshotByIdSpan(ctx, es.tracer, aggregateId)
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endGetLatestSnapshotByIdSpan(span, result, err)
+		es.metrics.ObserveRead("GetLatestSnapshotById", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "GetLatestSnapshotById", aggregateId, duration)
+	}(time.Now())
+	return es.getLatestSnapshotById(ctx, aggregateId)
+}
+
+func (es *EventStoreOnDynamoDB) getLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
 	if aggregateId == nil {
 		panic("aggregateId is nil")
 	}
+	if es.resharding() {
+		return es.getLatestSnapshotByIdResharding(ctx, aggregateId)
+	}
+	if es.isConsistentRead(ctx) {
+		return es.getLatestSnapshotByIdConsistently(ctx, aggregateId)
+	}
 
 	request := &dynamodb.QueryInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
 		TableName:              aws.String(es.snapshotTableName),
 		IndexName:              aws.String(es.snapshotAidIndexName),
 		KeyConditionExpression: aws.String("#aid = :aid AND #seq_nr = :seq_nr"),
@@ -231,19 +250,147 @@ func (es *EventStoreOnDynamoDB) GetLatestSnapshotById(ctx context.Context, aggre
 	result, err := es.client.Query(ctx, request)
 	if err != nil {
 		return nil, NewIOError("Failed to GetLatestSnapshotById query", err)
-	} else if len(result.Items) == 0 {
+	}
+	es.recordQuery(result)
+	if len(result.Items) == 0 {
 		return &AggregateResult{}, nil
 	} else if len(result.Items) > 1 {
 		panic("len(result.Items) > 1")
 	}
 
-	version, err := strconv.ParseUint(result.Items[0]["version"].(*types.AttributeValueMemberN).Value, 10, 64)
+	aggregate, err := es.snapshotFromItem(result.Items[0])
+	if err != nil {
+		return nil, err
+	}
+	return &AggregateResult{aggregate}, nil
+}
+
+// getLatestSnapshotByIdConsistently gets the snapshot item of seqNr 0 by its primary key with a strongly consistent read.
+func (es *EventStoreOnDynamoDB) getLatestSnapshotByIdConsistently(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	item, err := es.getSnapshotItem(ctx, aggregateId, es.keyResolver.ResolvePkey(aggregateId, es.shardCount))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return &AggregateResult{}, nil
+	}
+
+	aggregate, err := es.snapshotFromItem(item)
+	if err != nil {
+		return nil, err
+	}
+	return &AggregateResult{aggregate}, nil
+}
+
+// getSnapshotItem gets the snapshot item of seqNr 0 under the pkey with a strongly consistent read, or nil if it does not exist.
+func (es *EventStoreOnDynamoDB) getSnapshotItem(ctx context.Context, aggregateId AggregateId, pkey string) (map[string]types.AttributeValue, error) {
+	request := &dynamodb.GetItemInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		TableName:              aws.String(es.snapshotTableName),
+		Key: map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: pkey},
+			"skey": &types.AttributeValueMemberS{Value: es.keyResolver.ResolveSkey(aggregateId, 0)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	result, err := es.client.GetItem(ctx, request)
+	if err != nil {
+		return nil, NewIOError("Failed to GetLatestSnapshotById getItem", err)
+	}
+	es.recordGetItem(result)
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+	return result.Item, nil
+}
+
+// getEventsByIdSinceSeqNrConsistently queries the events from the journal table by pkey with strongly consistent reads.
+//
+// The query is narrowed by the skey range if the KeyResolver is a SortableKeyResolver,
+// or by the skey prefix if it is a SkeyPrefixResolver, and the other aggregates of the shard are filtered out.
+func (es *EventStoreOnDynamoDB) getEventsByIdSinceSeqNrConsistently(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	return es.queryEventsByPkey(ctx, aggregateId, seqNr, es.keyResolver.ResolvePkey(aggregateId, es.shardCount))
+}
+
+// queryEventsByPkey queries the events of the aggregate since the seqNr under the pkey with strongly consistent reads.
+func (es *EventStoreOnDynamoDB) queryEventsByPkey(ctx context.Context, aggregateId AggregateId, seqNr uint64, pkey string) ([]Event, error) {
+	request, sortable := es.journalQueryByPkey(aggregateId, seqNr, pkey)
+	events := make([]Event, 0)
+	for {
+		result, err := es.client.Query(ctx, request)
+		if err != nil {
+			return nil, NewIOError("Failed to GetEventsByIdSinceSeqNr query", err)
+		}
+		es.recordQuery(result)
+		for _, item := range result.Items {
+			event, err := es.eventFromItem(item)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		request.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	if !sortable {
+		// The skeys are not necessarily ordered by seqNr.
+		sort.Slice(events, func(i, j int) bool { return events[i].GetSeqNr() < events[j].GetSeqNr() })
+	}
+	return events, nil
+}
+
+// journalQueryByPkey returns the consistent query of the journal items of the aggregate since the seqNr under the pkey.
+//
+// The query is narrowed to the skeys of the aggregate if the KeyResolver is the SortableKeyResolver or a SkeyPrefixResolver,
+// and filters the other aggregates of the shard otherwise.
+//
+// # Returns
+// - the query
+// - whether the items are ordered by seqNr
+func (es *EventStoreOnDynamoDB) journalQueryByPkey(aggregateId AggregateId, seqNr uint64, pkey string) (*dynamodb.QueryInput, bool) {
+	request := &dynamodb.QueryInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		TableName:              aws.String(es.journalTableName),
+		KeyConditionExpression: aws.String("#pkey = :pkey"),
+		FilterExpression:       aws.String("#aid = :aid AND #seq_nr >= :seq_nr"),
+		ExpressionAttributeNames: map[string]string{
+			"#pkey":   "pkey",
+			"#aid":    "aid",
+			"#seq_nr": "seq_nr",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pkey":   &types.AttributeValueMemberS{Value: pkey},
+			":aid":    &types.AttributeValueMemberS{Value: aggregateId.AsString()},
+			":seq_nr": &types.AttributeValueMemberN{Value: strconv.FormatUint(seqNr, 10)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	_, sortable := es.keyResolver.(*SortableKeyResolver)
+	if sortable {
+		request.KeyConditionExpression = aws.String("#pkey = :pkey AND #skey BETWEEN :from_skey AND :to_skey")
+		request.ExpressionAttributeNames["#skey"] = "skey"
+		request.ExpressionAttributeValues[":from_skey"] = &types.AttributeValueMemberS{Value: es.keyResolver.ResolveSkey(aggregateId, seqNr)}
+		request.ExpressionAttributeValues[":to_skey"] = &types.AttributeValueMemberS{Value: es.keyResolver.ResolveSkey(aggregateId, math.MaxUint64)}
+	} else if prefixResolver, ok := es.keyResolver.(SkeyPrefixResolver); ok {
+		request.KeyConditionExpression = aws.String("#pkey = :pkey AND begins_with(#skey, :skey_prefix)")
+		request.ExpressionAttributeNames["#skey"] = "skey"
+		request.ExpressionAttributeValues[":skey_prefix"] = &types.AttributeValueMemberS{Value: prefixResolver.ResolveSkeyPrefix(aggregateId)}
+	}
+	return request, sortable
+}
+
+// snapshotFromItem returns the aggregate of a snapshot item with the version of the item.
+func (es *EventStoreOnDynamoDB) snapshotFromItem(item map[string]types.AttributeValue) (Aggregate, error) {
+	version, err := strconv.ParseUint(item["version"].(*types.AttributeValueMemberN).Value, 10, 64)
 	if err != nil {
 		return nil, NewDeserializationError("Failed to parse the version", err)
 	}
 
 	var aggregateMap map[string]any
-	if err := es.snapshotSerializer.Deserialize(result.Items[0]["payload"].(*types.AttributeValueMemberB).Value, &aggregateMap); err != nil {
+	if err := es.snapshotSerializer.Deserialize(item["payload"].(*types.AttributeValueMemberB).Value, &aggregateMap); err != nil {
 		return nil, err
 	}
 
@@ -251,14 +398,88 @@ func (es *EventStoreOnDynamoDB) GetLatestSnapshotById(ctx context.Context, aggre
 	if err != nil {
 		return nil, NewDeserializationError("Failed to convert the snapshot", err)
 	}
-	return &AggregateResult{aggregate.WithVersion(version)}, nil
+	return aggregate.WithVersion(version), nil
 }
 
-func (es *EventStoreOnDynamoDB) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+// eventFromItem returns the event of a journal item.
+func (es *EventStoreOnDynamoDB) eventFromItem(item map[string]types.AttributeValue) (Event, error) {
+	var eventMap map[string]any
+	if err := es.eventSerializer.Deserialize(item["payload"].(*types.AttributeValueMemberB).Value, &eventMap); err != nil {
+		return nil, err
+	}
+
+	event, err := es.eventConverter(eventMap)
+	if err != nil {
+		return nil, NewDeserializationError("Failed to convert the event", err)
+	}
+	return event, nil
+}
+
+func (es *EventStoreOnDynamoDB) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) (events []Event, err error) {
+	ctx, span := startGetEventsByIdSinceSeqNrSpan(ctx, es.tracer, aggregateId, seqNr)
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpanWithItemCount(span, len(events), err)
+		es.metrics.ObserveRead("GetEventsByIdSinceSeqNr", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "GetEventsByIdSinceSeqNr", aggregateId, duration)
+		if err == nil {
+			es.metrics.ObserveEventsReplayed(len(events))
+		}
+	}(time.Now())
+	return es.getEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+}
+
+// GetEventsByIdSinceSeqNrWithLimit returns up to limit events of the aggregate since the specified sequence number.
+//
+// The limit is applied to the query on the aid index. Consistent reads and reads while resharding
+// query by pkey with a filter, and are truncated to the limit instead.
+func (es *EventStoreOnDynamoDB) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) (events []Event, err error) {
+	ctx, span := startGetEventsByIdSinceSeqNrSpan(ctx, es.tracer, aggregateId, seqNr)
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpanWithItemCount(span, len(events), err)
+		es.metrics.ObserveRead("GetEventsByIdSinceSeqNrWithLimit", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "GetEventsByIdSinceSeqNrWithLimit", aggregateId, duration)
+		if err == nil {
+			es.metrics.ObserveEventsReplayed(len(events))
+		}
+	}(time.Now())
+	if limit <= 0 {
+		return nil, errors.New("limit is not positive")
+	}
+	events, err = es.getEventsByIdSinceSeqNrWithLimit(ctx, aggregateId, seqNr, int32(min(limit, math.MaxInt32)))
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (es *EventStoreOnDynamoDB) getEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	return es.getEventsByIdSinceSeqNrWithLimit(ctx, aggregateId, seqNr, 0)
+}
+
+// getEventsByIdSinceSeqNrWithLimit returns the events of the aggregate since the seqNr.
+//
+// # Parameters
+// - limit is the limit of the query on the aid index, or 0 for no limit.
+// # Returns
+// - a list of events
+// - an error
+func (es *EventStoreOnDynamoDB) getEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int32) ([]Event, error) {
 	if aggregateId == nil {
 		panic("aggregateId is nil")
 	}
+	if es.resharding() {
+		return es.getEventsByIdSinceSeqNrResharding(ctx, aggregateId, seqNr)
+	}
+	if es.isConsistentRead(ctx) {
+		return es.getEventsByIdSinceSeqNrConsistently(ctx, aggregateId, seqNr)
+	}
 	request := &dynamodb.QueryInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
 		TableName:              aws.String(es.journalTableName),
 		IndexName:              aws.String(es.journalAidIndexName),
 		KeyConditionExpression: aws.String("#aid = :aid AND #seq_nr >= :seq_nr"),
@@ -271,32 +492,108 @@ func (es *EventStoreOnDynamoDB) GetEventsByIdSinceSeqNr(ctx context.Context, agg
 			":seq_nr": &types.AttributeValueMemberN{Value: strconv.FormatUint(seqNr, 10)},
 		},
 	}
-	result, err := es.client.Query(context.Background(), request)
+	if limit > 0 {
+		request.Limit = aws.Int32(limit)
+	}
+	result, err := es.client.Query(ctx, request)
 	if err != nil {
 		return nil, NewIOError("Failed to GetEventsByIdSinceSeqNr query", err)
 	}
+	es.recordQuery(result)
 
 	events := make([]Event, 0, len(result.Items))
 	for _, item := range result.Items {
-		var eventMap map[string]any
-		if err := es.eventSerializer.Deserialize(item["payload"].(*types.AttributeValueMemberB).Value, &eventMap); err != nil {
+		event, err := es.eventFromItem(item)
+		if err != nil {
 			return nil, err
 		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
 
-		event, err := es.eventConverter(eventMap)
+// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name whose occurred at is within [from, to].
+//
+// The journal type name index must be configured with WithJournalTypeIndexName.
+func (es *EventStoreOnDynamoDB) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) (events []Event, err error) {
+	ctx, span := es.tracer.Start(ctx, "EventStore.GetEventsByTypeNameAndOccurredAt",
+		trace.WithAttributes(eventTypeAttributeKey.String(typeName)))
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpanWithItemCount(span, len(events), err)
+		es.metrics.ObserveRead("GetEventsByTypeNameAndOccurredAt", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "GetEventsByTypeNameAndOccurredAt", nil, duration)
+	}(time.Now())
+	return es.getEventsByTypeNameAndOccurredAt(ctx, typeName, from, to)
+}
+
+func (es *EventStoreOnDynamoDB) getEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	if es.journalTypeIndexName == "" {
+		return nil, errors.New("journalTypeIndexName is not configured")
+	}
+	request := &dynamodb.QueryInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		TableName:              aws.String(es.journalTableName),
+		IndexName:              aws.String(es.journalTypeIndexName),
+		KeyConditionExpression: aws.String("#type_name = :type_name AND #occurred_at BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]string{
+			"#type_name":   "type_name",
+			"#occurred_at": "occurred_at",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":type_name": &types.AttributeValueMemberS{Value: typeName},
+			":from":      &types.AttributeValueMemberN{Value: strconv.FormatUint(from, 10)},
+			":to":        &types.AttributeValueMemberN{Value: strconv.FormatUint(to, 10)},
+		},
+	}
+
+	events := make([]Event, 0)
+	for {
+		result, err := es.client.Query(ctx, request)
 		if err != nil {
-			return nil, NewDeserializationError("Failed to convert the event", err)
+			return nil, NewIOError("Failed to GetEventsByTypeNameAndOccurredAt query", err)
 		}
-		events = append(events, event)
+		es.recordQuery(result)
+		for _, item := range result.Items {
+			event, err := es.eventFromItem(item)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		request.ExclusiveStartKey = result.LastEvaluatedKey
 	}
 
+	if es.resharding() {
+		return distinctEvents(events), nil
+	}
 	return events, nil
 }
 
-func (es *EventStoreOnDynamoDB) PersistEvent(ctx context.Context, event Event, version uint64) error {
+func (es *EventStoreOnDynamoDB) PersistEvent(ctx context.Context, event Event, version uint64) (err error) {
+	ctx, span := startPersistEventSpan(ctx, es.tracer, event, version)
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpan(span, err)
+		es.metrics.ObserveAppend("PersistEvent", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "PersistEvent", event.GetAggregateId(), duration)
+	}(time.Now())
+	return es.persistEvent(ctx, event, version)
+}
+
+func (es *EventStoreOnDynamoDB) persistEvent(ctx context.Context, event Event, version uint64) error {
 	if event.IsCreated() {
 		panic("event is created")
 	}
+	if es.resharding() {
+		if err := es.ensureResharded(ctx, event.GetAggregateId()); err != nil {
+			return err
+		}
+	}
 	if err := es.updateEventAndSnapshotOpt(ctx, event, version, nil); err != nil {
 		return err
 	}
@@ -307,7 +604,24 @@ func (es *EventStoreOnDynamoDB) PersistEvent(ctx context.Context, event Event, v
 	return nil
 }
 
-func (es *EventStoreOnDynamoDB) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
+func (es *EventStoreOnDynamoDB) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) (err error) {
+	ctx, span := startPersistEventAndSnapshotSpan(ctx, es.tracer, event, aggregate)
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpan(span, err)
+		es.metrics.ObserveAppend("PersistEventAndSnapshot", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "PersistEventAndSnapshot", event.GetAggregateId(), duration)
+	}(time.Now())
+	return es.persistEventAndSnapshot(ctx, event, aggregate)
+}
+
+func (es *EventStoreOnDynamoDB) persistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
+	if es.resharding() {
+		// A created aggregate is copied too, so that creating it again conflicts.
+		if err := es.ensureResharded(ctx, event.GetAggregateId()); err != nil {
+			return err
+		}
+	}
 	if event.IsCreated() {
 		if err := es.createEventAndSnapshot(ctx, event, aggregate); err != nil {
 			return err
@@ -341,12 +655,13 @@ func (es *EventStoreOnDynamoDB) putSnapshot(event Event, seqNr uint64, aggregate
 		return nil, errors.New("aggregate is nil")
 	}
 
-	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount)
+	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.writeShardCount())
 	skey := es.keyResolver.ResolveSkey(event.GetAggregateId(), seqNr)
 	payload, err := es.snapshotSerializer.Serialize(aggregate)
 	if err != nil {
 		return nil, err
 	}
+	es.metrics.ObservePayloadSize(PayloadKindSnapshot, len(payload))
 
 	input := types.Put{
 		TableName: aws.String(es.snapshotTableName),
@@ -382,7 +697,7 @@ func (es *EventStoreOnDynamoDB) updateSnapshot(event Event, seqNr uint64, versio
 		return nil, errors.New("event is nil")
 	}
 
-	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount)
+	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.writeShardCount())
 	skey := es.keyResolver.ResolveSkey(event.GetAggregateId(), seqNr)
 	update := types.Update{
 		TableName:        aws.String(es.snapshotTableName),
@@ -405,6 +720,7 @@ func (es *EventStoreOnDynamoDB) updateSnapshot(event Event, seqNr uint64, versio
 		if err != nil {
 			return nil, err
 		}
+		es.metrics.ObservePayloadSize(PayloadKindSnapshot, len(payload))
 		update.UpdateExpression = aws.String("SET #payload=:payload, #seq_nr=:seq_nr, #version=:after_version")
 		update.ExpressionAttributeNames["#seq_nr"] = "seq_nr"
 		update.ExpressionAttributeNames["#payload"] = "payload"
@@ -428,12 +744,13 @@ func (es *EventStoreOnDynamoDB) putJournal(event Event) (*types.Put, error) {
 		return nil, errors.New("event is nil")
 	}
 
-	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount)
+	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.writeShardCount())
 	skey := es.keyResolver.ResolveSkey(event.GetAggregateId(), event.GetSeqNr())
 	payload, err := es.eventSerializer.Serialize(event)
 	if err != nil {
 		return nil, err
 	}
+	es.metrics.ObservePayloadSize(PayloadKindEvent, len(payload))
 
 	input := types.Put{
 		TableName: aws.String(es.journalTableName),
@@ -443,6 +760,7 @@ func (es *EventStoreOnDynamoDB) putJournal(event Event) (*types.Put, error) {
 			"aid":         &types.AttributeValueMemberS{Value: event.GetAggregateId().AsString()},
 			"seq_nr":      &types.AttributeValueMemberN{Value: strconv.FormatUint(event.GetSeqNr(), 10)},
 			"payload":     &types.AttributeValueMemberB{Value: payload},
+			"type_name":   &types.AttributeValueMemberS{Value: event.GetTypeName()},
 			"occurred_at": &types.AttributeValueMemberN{Value: strconv.FormatUint(event.GetOccurredAt(), 10)},
 		},
 		ConditionExpression: aws.String("attribute_not_exists(pkey) AND attribute_not_exists(skey)"),
@@ -451,6 +769,45 @@ func (es *EventStoreOnDynamoDB) putJournal(event Event) (*types.Put, error) {
 	return &input, nil
 }
 
+// putOutbox returns a PutInput for outbox.
+//
+// # Parameters
+// - event is an event to relay.
+//
+// # Returns
+// - a PutInput
+// - an error
+func (es *EventStoreOnDynamoDB) putOutbox(event Event) (*types.Put, error) {
+	if event == nil {
+		return nil, errors.New("event is nil")
+	}
+
+	payload, err := es.eventSerializer.Serialize(event)
+	if err != nil {
+		return nil, err
+	}
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	input := types.Put{
+		TableName: aws.String(es.outboxTableName),
+		Item: map[string]types.AttributeValue{
+			"id":              &types.AttributeValueMemberS{Value: event.GetId()},
+			"aid":             &types.AttributeValueMemberS{Value: event.GetAggregateId().AsString()},
+			"seq_nr":          &types.AttributeValueMemberN{Value: strconv.FormatUint(event.GetSeqNr(), 10)},
+			"type_name":       &types.AttributeValueMemberS{Value: event.GetTypeName()},
+			"payload":         &types.AttributeValueMemberB{Value: payload},
+			"occurred_at":     &types.AttributeValueMemberN{Value: strconv.FormatUint(event.GetOccurredAt(), 10)},
+			"status":          &types.AttributeValueMemberS{Value: OutboxStatusPending},
+			"attempts":        &types.AttributeValueMemberN{Value: "0"},
+			"created_at":      &types.AttributeValueMemberN{Value: now},
+			"next_attempt_at": &types.AttributeValueMemberN{Value: now},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}
+
+	return &input, nil
+}
+
 // tryPurgeExcessSnapshots tries to purge excess snapshots.
 //
 // # Parameters
@@ -492,6 +849,15 @@ func (es *EventStoreOnDynamoDB) updateEventAndSnapshotOpt(ctx context.Context, e
 	if err != nil {
 		return err
 	}
+	if es.hashChain {
+		prevHash, err := es.lastHash(ctx, event, version)
+		if err != nil {
+			return err
+		}
+		updateSnapshot.UpdateExpression = aws.String(*updateSnapshot.UpdateExpression + ", #last_hash=:last_hash")
+		updateSnapshot.ExpressionAttributeNames["#last_hash"] = "last_hash"
+		updateSnapshot.ExpressionAttributeValues[":last_hash"] = &types.AttributeValueMemberS{Value: linkHashChain(putJournal, prevHash)}
+	}
 
 	transactItems := []types.TransactWriteItem{
 		{Update: updateSnapshot},
@@ -504,20 +870,23 @@ func (es *EventStoreOnDynamoDB) updateEventAndSnapshotOpt(ctx context.Context, e
 		}
 		transactItems = append(transactItems, types.TransactWriteItem{Put: putSnapshot2})
 	}
-	if _, err := es.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems}); err != nil {
-		var t *types.TransactionCanceledException
-		switch {
-		case errors.As(err, &t):
-			for _, reason := range t.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
-					return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", err)
-				}
-			}
-			return NewIOError("Failed to transact write items due to non-conditional check failure", err)
-		default:
-			return NewIOError("Failed to transact write items", err)
+	if es.outboxTableName != "" {
+		putOutbox, err := es.putOutbox(event)
+		if err != nil {
+			return err
 		}
+		transactItems = append(transactItems, types.TransactWriteItem{Put: putOutbox})
 	}
+	// The shard layout is checked last, so that toTransactWriteError finds its cancellation reason.
+	transactItems = append(transactItems, types.TransactWriteItem{ConditionCheck: es.shardLayoutConditionCheck()})
+	result, err := es.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems:          transactItems,
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	if err != nil {
+		return es.toTransactWriteError(ctx, event, err)
+	}
+	es.recordTransactWriteItems(result)
 
 	return nil
 }
@@ -541,6 +910,9 @@ func (es *EventStoreOnDynamoDB) createEventAndSnapshot(ctx context.Context, even
 	if err != nil {
 		return err
 	}
+	if es.hashChain {
+		putSnapshot.Item["last_hash"] = &types.AttributeValueMemberS{Value: linkHashChain(putJournal, "")}
+	}
 
 	transactItems := []types.TransactWriteItem{
 		{Put: putSnapshot},
@@ -553,25 +925,74 @@ func (es *EventStoreOnDynamoDB) createEventAndSnapshot(ctx context.Context, even
 		}
 		transactItems = append(transactItems, types.TransactWriteItem{Put: putSnapshot2})
 	}
-
-	if _, err = es.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems}); err != nil {
-		var t *types.TransactionCanceledException
-		switch {
-		case errors.As(err, &t):
-			for _, reason := range t.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
-					return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", err)
-				}
-			}
-			return NewIOError("Failed to transact write items due to non-conditional check failure", err)
-		default:
-			return NewIOError("Failed to transact write items", err)
+	if es.outboxTableName != "" {
+		putOutbox, err := es.putOutbox(event)
+		if err != nil {
+			return err
 		}
+		transactItems = append(transactItems, types.TransactWriteItem{Put: putOutbox})
+	}
+	// The shard layout is checked last, so that toTransactWriteError finds its cancellation reason.
+	transactItems = append(transactItems, types.TransactWriteItem{ConditionCheck: es.shardLayoutConditionCheck()})
+
+	result, err := es.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems:          transactItems,
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	if err != nil {
+		return es.toTransactWriteError(ctx, event, err)
 	}
+	es.recordTransactWriteItems(result)
 
 	return nil
 }
 
+// toTransactWriteError returns the error of a failed TransactWriteItems of the event, logging the cancellation reasons.
+//
+// # Parameters
+// - event is the event of the transaction.
+// - err is the error of TransactWriteItems.
+// # Returns
+// - an IOError if the shard layout was changed, an OptimisticLockError if another condition check failed, otherwise an IOError
+func (es *EventStoreOnDynamoDB) toTransactWriteError(ctx context.Context, event Event, err error) error {
+	var t *types.TransactionCanceledException
+	if !errors.As(err, &t) {
+		return NewIOError("Failed to transact write items", err)
+	}
+
+	conditionalCheckFailed := false
+	shardLayoutChanged := false
+	reasons := make([]string, 0, len(t.CancellationReasons))
+	for i, reason := range t.CancellationReasons {
+		code := aws.ToString(reason.Code)
+		if code == "ConditionalCheckFailed" {
+			conditionalCheckFailed = true
+			// The last item is the ConditionCheck of the shard layout.
+			shardLayoutChanged = shardLayoutChanged || i == len(t.CancellationReasons)-1
+		}
+		if message := aws.ToString(reason.Message); message != "" {
+			code += ": " + message
+		}
+		reasons = append(reasons, code)
+	}
+	level := slog.LevelWarn
+	if conditionalCheckFailed {
+		level = slog.LevelInfo
+	}
+	es.logger.LogAttrs(ctx, level, "transaction canceled",
+		slog.String("aid", event.GetAggregateId().AsString()),
+		slog.Uint64("seq_nr", event.GetSeqNr()),
+		slog.Any("reasons", reasons))
+
+	if shardLayoutChanged {
+		return NewIOError("Transaction write was canceled because the shard layout was changed; restart the store with the recorded shard layout", err)
+	}
+	if conditionalCheckFailed {
+		return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", err)
+	}
+	return NewIOError("Failed to transact write items due to non-conditional check failure", err)
+}
+
 // deleteExcessSnapshots deletes excess snapshots.
 //
 // # Parameters
@@ -606,10 +1027,19 @@ func (es *EventStoreOnDynamoDB) deleteExcessSnapshots(ctx context.Context, aggre
 				}
 				requests = append(requests, request)
 			}
-			request := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]types.WriteRequest{es.snapshotTableName: requests}}
-			if _, err = es.client.BatchWriteItem(context.Background(), request); err != nil {
+			request := &dynamodb.BatchWriteItemInput{
+				RequestItems:           map[string][]types.WriteRequest{es.snapshotTableName: requests},
+				ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+			}
+			result, err := es.client.BatchWriteItem(ctx, request)
+			if err != nil {
 				return NewIOError("Failed to deleteExcessSnapshots updateItem", err)
 			}
+			es.recordBatchWriteItem(result)
+			es.metrics.AddSnapshotsPurged(len(requests))
+			es.logger.LogAttrs(ctx, slog.LevelDebug, "deleted excess snapshots",
+				slog.String("aid", aggregateId.AsString()),
+				slog.Int("count", len(requests)))
 		}
 	}
 
@@ -641,7 +1071,8 @@ func (es *EventStoreOnDynamoDB) updateTtlOfExcessSnapshots(ctx context.Context,
 			ttl := time.Now().Add(es.deleteTtl).Unix()
 			for _, key := range keys {
 				request := &dynamodb.UpdateItemInput{
-					TableName: aws.String(es.snapshotTableName),
+					ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+					TableName:              aws.String(es.snapshotTableName),
 					Key: map[string]types.AttributeValue{
 						"pkey": &types.AttributeValueMemberS{Value: key.pkey},
 						"skey": &types.AttributeValueMemberS{Value: key.skey},
@@ -654,10 +1085,17 @@ func (es *EventStoreOnDynamoDB) updateTtlOfExcessSnapshots(ctx context.Context,
 						":ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(ttl, 10)},
 					},
 				}
-				if _, err := es.client.UpdateItem(ctx, request); err != nil {
+				result, err := es.client.UpdateItem(ctx, request)
+				if err != nil {
 					return NewIOError("Failed to updateTtlOfExcessSnapshots updateItem", err)
 				}
+				es.recordUpdateItem(result)
 			}
+			es.metrics.AddSnapshotsPurged(len(keys))
+			es.logger.LogAttrs(ctx, slog.LevelDebug, "set ttl of excess snapshots",
+				slog.String("aid", aggregateId.AsString()),
+				slog.Int("count", len(keys)),
+				slog.Int64("ttl", ttl))
 		}
 	}
 
@@ -677,6 +1115,7 @@ func (es *EventStoreOnDynamoDB) getSnapshotCount(ctx context.Context, aggregateI
 	}
 
 	request := &dynamodb.QueryInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
 		TableName:              aws.String(es.snapshotTableName),
 		IndexName:              aws.String(es.snapshotAidIndexName),
 		KeyConditionExpression: aws.String("#aid = :aid"),
@@ -688,10 +1127,12 @@ func (es *EventStoreOnDynamoDB) getSnapshotCount(ctx context.Context, aggregateI
 		},
 		Select: types.SelectCount,
 	}
+	es.addReshardingFilter(request, aggregateId)
 	response, err := es.client.Query(ctx, request)
 	if err != nil {
 		return 0, NewIOError("Failed to getSnapshotCount query", err)
 	}
+	es.recordQuery(response)
 	return response.Count, nil
 }
 
@@ -714,6 +1155,7 @@ func (es *EventStoreOnDynamoDB) getLastSnapshotKeys(ctx context.Context, aggrega
 	}
 
 	request := &dynamodb.QueryInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
 		TableName:              aws.String(es.snapshotTableName),
 		IndexName:              aws.String(es.snapshotAidIndexName),
 		KeyConditionExpression: aws.String("#aid = :aid AND #seq_nr > :seq_nr"),
@@ -733,10 +1175,12 @@ func (es *EventStoreOnDynamoDB) getLastSnapshotKeys(ctx context.Context, aggrega
 		request.ExpressionAttributeNames["#ttl"] = "ttl"
 		request.ExpressionAttributeValues[":ttl"] = &types.AttributeValueMemberN{Value: "0"}
 	}
+	es.addReshardingFilter(request, aggregateId)
 	response, err := es.client.Query(ctx, request)
 	if err != nil {
 		return nil, NewIOError("Failed to getLastSnapshotKeys query", err)
 	}
+	es.recordQuery(response)
 
 	var pkeySkeys []pkeyAndSkey
 	for _, item := range response.Items {
@@ -751,3 +1195,60 @@ func (es *EventStoreOnDynamoDB) getLastSnapshotKeys(ctx context.Context, aggrega
 
 	return pkeySkeys, nil
 }
+
+// recordQuery records the retries and the consumed capacity of a Query.
+func (es *EventStoreOnDynamoDB) recordQuery(output *dynamodb.QueryOutput) {
+	es.recordRetries("Query", output.ResultMetadata)
+	if output.ConsumedCapacity != nil {
+		es.recordConsumedCapacity("Query", *output.ConsumedCapacity)
+	}
+}
+
+// recordBatchGetItem records the retries and the consumed capacity of a BatchGetItem.
+func (es *EventStoreOnDynamoDB) recordBatchGetItem(output *dynamodb.BatchGetItemOutput) {
+	es.recordRetries("BatchGetItem", output.ResultMetadata)
+	es.recordConsumedCapacity("BatchGetItem", output.ConsumedCapacity...)
+}
+
+// recordGetItem records the retries and the consumed capacity of a GetItem.
+func (es *EventStoreOnDynamoDB) recordGetItem(output *dynamodb.GetItemOutput) {
+	es.recordRetries("GetItem", output.ResultMetadata)
+	if output.ConsumedCapacity != nil {
+		es.recordConsumedCapacity("GetItem", *output.ConsumedCapacity)
+	}
+}
+
+// recordTransactWriteItems records the retries and the consumed capacity of a TransactWriteItems.
+func (es *EventStoreOnDynamoDB) recordTransactWriteItems(output *dynamodb.TransactWriteItemsOutput) {
+	es.recordRetries("TransactWriteItems", output.ResultMetadata)
+	es.recordConsumedCapacity("TransactWriteItems", output.ConsumedCapacity...)
+}
+
+// recordBatchWriteItem records the retries and the consumed capacity of a BatchWriteItem.
+func (es *EventStoreOnDynamoDB) recordBatchWriteItem(output *dynamodb.BatchWriteItemOutput) {
+	es.recordRetries("BatchWriteItem", output.ResultMetadata)
+	es.recordConsumedCapacity("BatchWriteItem", output.ConsumedCapacity...)
+}
+
+// recordUpdateItem records the retries and the consumed capacity of an UpdateItem.
+func (es *EventStoreOnDynamoDB) recordUpdateItem(output *dynamodb.UpdateItemOutput) {
+	es.recordRetries("UpdateItem", output.ResultMetadata)
+	if output.ConsumedCapacity != nil {
+		es.recordConsumedCapacity("UpdateItem", *output.ConsumedCapacity)
+	}
+}
+
+// recordRetries records the attempts of a request made by the SDK retryer beyond the first one.
+func (es *EventStoreOnDynamoDB) recordRetries(operation string, metadata middleware.Metadata) {
+	if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 1 {
+		es.metrics.AddRetries(operation, len(attempts.Results)-1)
+	}
+}
+
+func (es *EventStoreOnDynamoDB) recordConsumedCapacity(operation string, consumedCapacities ...types.ConsumedCapacity) {
+	for _, consumedCapacity := range consumedCapacities {
+		if consumedCapacity.TableName != nil && consumedCapacity.CapacityUnits != nil {
+			es.metrics.AddConsumedCapacity(operation, *consumedCapacity.TableName, *consumedCapacity.CapacityUnits)
+		}
+	}
+}
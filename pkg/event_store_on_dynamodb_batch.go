@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// batchGetItemMaxKeys is the maximum number of keys of a BatchGetItem request.
+	batchGetItemMaxKeys = 100
+	// batchGetItemMaxAttempts is the maximum number of BatchGetItem requests made for a batch with unprocessed keys.
+	batchGetItemMaxAttempts = 8
+	// batchGetItemBaseBackoff is the wait before the first retry of unprocessed keys, doubled for each retry.
+	batchGetItemBaseBackoff = 50 * time.Millisecond
+)
+
+// WithBatchLoadConcurrency sets the number of aggregates whose events GetLatestSnapshotsByIds loads concurrently.
+//
+// - The default is 8.
+//
+// # Parameters
+// - batchLoadConcurrency is the number of concurrent loads.
+//
+// # Returns
+// - an EventStoreOption.
+func WithBatchLoadConcurrency(batchLoadConcurrency int) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if batchLoadConcurrency <= 0 {
+			return errors.New("batchLoadConcurrency is not positive")
+		}
+		c.batchLoadConcurrency = batchLoadConcurrency
+		return nil
+	}
+}
+
+// GetLatestSnapshotsByIds returns the latest snapshots of the aggregates and the events after them.
+//
+// The snapshots are read with BatchGetItem by the keys the KeyResolver resolves for seqNr 0,
+// retrying unprocessed keys, and the events are then read concurrently as configured by WithBatchLoadConcurrency.
+// Both are read with strongly consistent reads if configured by WithConsistentRead or ContextWithConsistentRead.
+//
+// # Parameters
+// - aggregateIds are the ids of the aggregates, which may contain duplicates loaded once.
+//
+// # Returns
+// - the results in the order of the aggregate ids, each with the error of loading that aggregate
+// - an error if the snapshots can not be read
+func (es *EventStoreOnDynamoDB) GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) (results []AggregateLoadResult, err error) {
+	ctx, span := es.tracer.Start(ctx, "EventStore.GetLatestSnapshotsByIds")
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpanWithItemCount(span, len(results), err)
+		es.metrics.ObserveRead("GetLatestSnapshotsByIds", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "GetLatestSnapshotsByIds", nil, duration)
+	}(time.Now())
+	return es.getLatestSnapshotsByIds(ctx, aggregateIds)
+}
+
+func (es *EventStoreOnDynamoDB) getLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) ([]AggregateLoadResult, error) {
+	for _, aggregateId := range aggregateIds {
+		if aggregateId == nil {
+			panic("aggregateId is nil")
+		}
+	}
+	// Each aggregate is loaded once, and BatchGetItem rejects duplicate keys.
+	uniqueIds, indexes := uniqueAggregateIds(aggregateIds)
+	if es.resharding() {
+		// The snapshots may be in either shard layout, so they are read one by one.
+		results := es.loadConcurrently(uniqueIds, func(_ int, result *AggregateLoadResult) {
+			es.loadAggregateById(ctx, result)
+		})
+		return fanOutLoadResults(aggregateIds, results, indexes), nil
+	}
+
+	keys := make([]pkeyAndSkey, len(uniqueIds))
+	for i, aggregateId := range uniqueIds {
+		keys[i] = pkeyAndSkey{
+			pkey: es.keyResolver.ResolvePkey(aggregateId, es.shardCount),
+			skey: es.keyResolver.ResolveSkey(aggregateId, 0),
+		}
+	}
+
+	items := make(map[pkeyAndSkey]map[string]types.AttributeValue, len(keys))
+	for start := 0; start < len(keys); start += batchGetItemMaxKeys {
+		end := min(start+batchGetItemMaxKeys, len(keys))
+		if err := es.batchGetSnapshots(ctx, keys[start:end], items); err != nil {
+			return nil, err
+		}
+	}
+
+	results := es.loadConcurrently(uniqueIds, func(i int, result *AggregateLoadResult) {
+		item, ok := items[keys[i]]
+		if !ok {
+			result.Snapshot = &AggregateResult{}
+			return
+		}
+		es.loadAggregate(ctx, item, result)
+	})
+	return fanOutLoadResults(aggregateIds, results, indexes), nil
+}
+
+// loadConcurrently returns the results of the aggregates, loading them concurrently as configured by WithBatchLoadConcurrency.
+func (es *EventStoreOnDynamoDB) loadConcurrently(aggregateIds []AggregateId, load func(i int, result *AggregateLoadResult)) []AggregateLoadResult {
+	results := make([]AggregateLoadResult, len(aggregateIds))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, es.batchLoadConcurrency)
+	for i, aggregateId := range aggregateIds {
+		results[i].AggregateId = aggregateId
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			load(i, &results[i])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// batchGetSnapshots reads the snapshot items of the keys into items, retrying unprocessed keys with backoff.
+func (es *EventStoreOnDynamoDB) batchGetSnapshots(ctx context.Context, keys []pkeyAndSkey, items map[pkeyAndSkey]map[string]types.AttributeValue) error {
+	requestKeys := make([]map[string]types.AttributeValue, 0, len(keys))
+	for _, key := range keys {
+		requestKeys = append(requestKeys, map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: key.pkey},
+			"skey": &types.AttributeValueMemberS{Value: key.skey},
+		})
+	}
+	request := &dynamodb.BatchGetItemInput{
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		RequestItems: map[string]types.KeysAndAttributes{
+			es.snapshotTableName: {Keys: requestKeys, ConsistentRead: aws.Bool(es.isConsistentRead(ctx))},
+		},
+	}
+
+	backoff := batchGetItemBaseBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := es.client.BatchGetItem(ctx, request)
+		if err != nil {
+			return NewIOError("Failed to GetLatestSnapshotsByIds batchGetItem", err)
+		}
+		es.recordBatchGetItem(result)
+		for _, item := range result.Responses[es.snapshotTableName] {
+			key := pkeyAndSkey{
+				pkey: item["pkey"].(*types.AttributeValueMemberS).Value,
+				skey: item["skey"].(*types.AttributeValueMemberS).Value,
+			}
+			items[key] = item
+		}
+
+		unprocessed, ok := result.UnprocessedKeys[es.snapshotTableName]
+		if !ok || len(unprocessed.Keys) == 0 {
+			return nil
+		}
+		if attempt == batchGetItemMaxAttempts {
+			return NewIOError("Failed to GetLatestSnapshotsByIds batchGetItem", errors.New("unprocessed keys remain after retries"))
+		}
+		es.metrics.AddRetries("BatchGetItem", 1)
+		select {
+		case <-ctx.Done():
+			return NewIOError("Failed to GetLatestSnapshotsByIds batchGetItem", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		request.RequestItems = result.UnprocessedKeys
+	}
+}
+
+// loadAggregate sets the snapshot of the item and the events after it to the result, or the error.
+func (es *EventStoreOnDynamoDB) loadAggregate(ctx context.Context, item map[string]types.AttributeValue, result *AggregateLoadResult) {
+	aggregate, err := es.snapshotFromItem(item)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	events, err := es.getEventsByIdSinceSeqNr(ctx, result.AggregateId, aggregate.GetSeqNr()+1)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	es.metrics.ObserveEventsReplayed(len(events))
+	result.Snapshot = &AggregateResult{aggregate}
+	result.Events = events
+}
+
+// loadAggregateById sets the latest snapshot of the aggregate of the result and the events after it to the result, or the error.
+func (es *EventStoreOnDynamoDB) loadAggregateById(ctx context.Context, result *AggregateLoadResult) {
+	snapshot, err := es.getLatestSnapshotById(ctx, result.AggregateId)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	if snapshot.Empty() {
+		result.Snapshot = snapshot
+		return
+	}
+	events, err := es.getEventsByIdSinceSeqNr(ctx, result.AggregateId, snapshot.Aggregate().GetSeqNr()+1)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	es.metrics.ObserveEventsReplayed(len(events))
+	result.Snapshot = snapshot
+	result.Events = events
+}
@@ -0,0 +1,225 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// WithHashChain makes the journal tamper-evident by chaining the hashes of the events of each aggregate.
+//
+// - Each journal item stores hash, the hex-encoded SHA-256 of prev_hash followed by its payload,
+// and prev_hash, the hash of the previous event of the aggregate, which is absent for the first one.
+// - The snapshot of seqNr 0 stores the hash of the last event as last_hash, written in the same transaction.
+// - Writing an event other than the first one reads the snapshot of seqNr 0 to get last_hash.
+// - Use VerifyHashChain to find the first broken link.
+// - Only EventStoreOnDynamoDB supports it, and the other event stores return an error.
+//
+// # Returns
+// - an EventStoreOption.
+func WithHashChain() EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.hashChain = true
+		c.dynamoDBOnlyOptions = append(c.dynamoDBOnlyOptions, "WithHashChain")
+		return nil
+	}
+}
+
+// VerifyHashChain walks the events of the aggregate in the journal table and reports the first broken link of their hash chain.
+//
+// A link is broken if an event is missing, if its prev_hash is not the hash of the previous event,
+// if its hash is not that of its payload, or if the hash of the last event is not the last_hash of the snapshot.
+// The events written before the hash chain was enabled are counted as unchained.
+//
+// # Parameters
+// - aggregateId is the id of the aggregate.
+//
+// # Returns
+// - a HashChainVerification
+// - an error if the items can not be read
+func (es *EventStoreOnDynamoDB) VerifyHashChain(ctx context.Context, aggregateId AggregateId) (result *HashChainVerification, err error) {
+	ctx, span := es.tracer.Start(ctx, "EventStore.VerifyHashChain")
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		endSpan(span, err)
+		es.metrics.ObserveRead("VerifyHashChain", outcomeOf(err), duration)
+		es.logIfSlow(ctx, "VerifyHashChain", aggregateId, duration)
+	}(time.Now())
+	return es.verifyHashChain(ctx, aggregateId)
+}
+
+func (es *EventStoreOnDynamoDB) verifyHashChain(ctx context.Context, aggregateId AggregateId) (*HashChainVerification, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+	pkey := es.keyResolver.ResolvePkey(aggregateId, es.writeShardCount())
+	snapshot, err := es.getSnapshotItem(ctx, aggregateId, pkey)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil && es.resharding() {
+		// The aggregate is not copied to the next shard layout yet.
+		pkey = es.keyResolver.ResolvePkey(aggregateId, es.shardCount)
+		if snapshot, err = es.getSnapshotItem(ctx, aggregateId, pkey); err != nil {
+			return nil, err
+		}
+	}
+	verification := &HashChainVerification{}
+	if snapshot == nil {
+		return verification, nil
+	}
+	var items []map[string]types.AttributeValue
+	request, _ := es.journalQueryByPkey(aggregateId, 0, pkey)
+	for {
+		result, err := es.client.Query(ctx, request)
+		if err != nil {
+			return nil, NewIOError("Failed to VerifyHashChain query", err)
+		}
+		es.recordQuery(result)
+		items = append(items, result.Items...)
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		request.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	seqNrs := make([]uint64, len(items))
+	for i, item := range items {
+		seqNr, err := itemSeqNr(item)
+		if err != nil {
+			return nil, err
+		}
+		seqNrs[i] = seqNr
+	}
+	sort.Sort(&itemsBySeqNr{items: items, seqNrs: seqNrs})
+
+	broken := func(seqNr uint64, reason string) (*HashChainVerification, error) {
+		verification.BrokenSeqNr = seqNr
+		verification.Reason = reason
+		es.logger.LogAttrs(ctx, slog.LevelWarn, "the hash chain is broken",
+			slog.String("aid", aggregateId.AsString()),
+			slog.Uint64("seq_nr", seqNr),
+			slog.String("reason", reason))
+		return verification, nil
+	}
+	chained := false
+	lastHash := ""
+	var lastSeqNr uint64
+	for i, item := range items {
+		seqNr := seqNrs[i]
+		if seqNr != lastSeqNr+1 {
+			return broken(seqNr, fmt.Sprintf("the event of seq_nr %d is missing", lastSeqNr+1))
+		}
+		lastSeqNr = seqNr
+		hash := stringAttribute(item, "hash")
+		if hash == "" {
+			if chained {
+				return broken(seqNr, "the hash is missing")
+			}
+			verification.Unchained++
+			continue
+		}
+		if stringAttribute(item, "prev_hash") != lastHash {
+			return broken(seqNr, "prev_hash is not the hash of the previous event")
+		}
+		payload, ok := item["payload"].(*types.AttributeValueMemberB)
+		if !ok || hashChainLink(lastHash, payload.Value) != hash {
+			return broken(seqNr, "the hash is not that of the payload")
+		}
+		chained = true
+		lastHash = hash
+		verification.Verified++
+	}
+	if stringAttribute(snapshot, "last_hash") != lastHash {
+		return broken(lastSeqNr+1, "last_hash of the snapshot is not the hash of the last event")
+	}
+	return verification, nil
+}
+
+// lastHash returns last_hash of the snapshot of seqNr 0 of the aggregate of the event, which is to be updated from the version.
+func (es *EventStoreOnDynamoDB) lastHash(ctx context.Context, event Event, version uint64) (string, error) {
+	pkey := es.keyResolver.ResolvePkey(event.GetAggregateId(), es.writeShardCount())
+	snapshot, err := es.getSnapshotItem(ctx, event.GetAggregateId(), pkey)
+	if err != nil {
+		return "", err
+	}
+	if snapshot == nil {
+		// The transaction fails the condition on the version.
+		return "", nil
+	}
+	if current, ok := snapshot["version"].(*types.AttributeValueMemberN); !ok || current.Value != strconv.FormatUint(version, 10) {
+		return "", NewOptimisticLockError("The version of the snapshot does not match", nil)
+	}
+	return stringAttribute(snapshot, "last_hash"), nil
+}
+
+// linkHashChain sets prev_hash and hash to the journal item.
+//
+// # Parameters
+// - putJournal is the PutInput of the journal item.
+// - prevHash is the hash of the previous event, or empty for the first one.
+//
+// # Returns
+// - the hash of the journal item
+func linkHashChain(putJournal *types.Put, prevHash string) string {
+	hash := hashChainLink(prevHash, putJournal.Item["payload"].(*types.AttributeValueMemberB).Value)
+	if prevHash != "" {
+		putJournal.Item["prev_hash"] = &types.AttributeValueMemberS{Value: prevHash}
+	}
+	putJournal.Item["hash"] = &types.AttributeValueMemberS{Value: hash}
+	return hash
+}
+
+// hashChainLink returns the hex-encoded SHA-256 of prevHash followed by the payload.
+func hashChainLink(prevHash string, payload []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stringAttribute returns the string attribute of the item, or empty if it is absent.
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+func itemSeqNr(item map[string]types.AttributeValue) (uint64, error) {
+	seqNr, ok := item["seq_nr"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, NewDeserializationError("seq_nr is not a number", nil)
+	}
+	value, err := strconv.ParseUint(seqNr.Value, 10, 64)
+	if err != nil {
+		return 0, NewDeserializationError("Failed to parse seq_nr", err)
+	}
+	return value, nil
+}
+
+// itemsBySeqNr sorts the items by their seqNrs.
+type itemsBySeqNr struct {
+	items  []map[string]types.AttributeValue
+	seqNrs []uint64
+}
+
+func (s *itemsBySeqNr) Len() int {
+	return len(s.items)
+}
+
+func (s *itemsBySeqNr) Less(i, j int) bool {
+	return s.seqNrs[i] < s.seqNrs[j]
+}
+
+func (s *itemsBySeqNr) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.seqNrs[i], s.seqNrs[j] = s.seqNrs[j], s.seqNrs[i]
+}
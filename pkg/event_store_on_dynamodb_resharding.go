@@ -0,0 +1,419 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// shardLayoutKey is the pkey and skey of the shard layout item in the snapshot table.
+//
+// The item has no aid, so it is not in the aid index.
+const shardLayoutKey = "event-store#shard-layout"
+
+// ShardLayout is the shard layout recorded in the snapshot table.
+type ShardLayout struct {
+	// ShardCount is the shard count of the items.
+	ShardCount uint64
+	// NextShardCount is the shard count the items are being resharded to, or 0.
+	NextShardCount uint64
+}
+
+// Resharding returns true if the items are being resharded.
+func (l ShardLayout) Resharding() bool {
+	return l.NextShardCount != 0
+}
+
+// WithShardLayoutCheck makes NewEventStoreOnDynamoDB check the shardCount against the shard layout recorded in the snapshot table.
+//
+// - The shard layout is recorded by the first store to start, and NewEventStoreOnDynamoDB returns an error if the shardCount differs.
+// - While a Resharder reshards the items, the store reads from both shard layouts and writes to the new one.
+// - The default is not to check.
+// - Only EventStoreOnDynamoDB supports it, and the other event stores return an error.
+//
+// # Parameters
+// - ctx is the context of reading and recording the shard layout.
+//
+// # Returns
+// - an EventStoreOption.
+func WithShardLayoutCheck(ctx context.Context) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if ctx == nil {
+			return errors.New("ctx is nil")
+		}
+		c.shardLayoutCheckContext = ctx
+		c.dynamoDBOnlyOptions = append(c.dynamoDBOnlyOptions, "WithShardLayoutCheck")
+		return nil
+	}
+}
+
+// checkShardLayout records the shard layout if it is not recorded yet, and returns an error if the shardCount differs from it.
+//
+// If the items are being resharded, the store switches to writing to the next shard count.
+func (es *EventStoreOnDynamoDB) checkShardLayout(ctx context.Context) error {
+	layout, err := getShardLayout(ctx, es.client, es.snapshotTableName)
+	if err != nil {
+		return err
+	}
+	if layout == nil {
+		layout = &ShardLayout{ShardCount: es.shardCount}
+		recorded, err := putShardLayoutIfNotExists(ctx, es.client, es.snapshotTableName, *layout)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			// Another store has just recorded it.
+			return es.checkShardLayout(ctx)
+		}
+	}
+	if layout.ShardCount != es.shardCount {
+		if layout.NextShardCount == es.shardCount {
+			return fmt.Errorf("shardCount is %d, but the items are being resharded from %d and it can be used after the cutover", es.shardCount, layout.ShardCount)
+		}
+		return fmt.Errorf("shardCount is %d, but the recorded shard count is %d", es.shardCount, layout.ShardCount)
+	}
+	es.nextShardCount = layout.NextShardCount
+	return nil
+}
+
+// resharding returns true if the store reads from both shard layouts and writes to the next one.
+func (es *EventStoreOnDynamoDB) resharding() bool {
+	return es.nextShardCount != 0
+}
+
+// writeShardCount returns the shard count of the items to write.
+func (es *EventStoreOnDynamoDB) writeShardCount() uint64 {
+	if es.resharding() {
+		return es.nextShardCount
+	}
+	return es.shardCount
+}
+
+// shardLayoutConditionCheck returns the ConditionCheck of the write transactions, which fails if the recorded
+// shard layout differs from the one the store writes by, so that a store not restarted after Resharder.Begin
+// or Resharder.Cutover does not write to a shard layout being copied or deleted.
+//
+// It passes if no shard layout is recorded.
+func (es *EventStoreOnDynamoDB) shardLayoutConditionCheck() *types.ConditionCheck {
+	return &types.ConditionCheck{
+		TableName: aws.String(es.snapshotTableName),
+		Key: map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: shardLayoutKey},
+			"skey": &types.AttributeValueMemberS{Value: shardLayoutKey},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(pkey) OR (#shard_count = :shard_count AND #next_shard_count = :next_shard_count)"),
+		ExpressionAttributeNames: map[string]string{
+			"#shard_count":      "shard_count",
+			"#next_shard_count": "next_shard_count",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":shard_count":      &types.AttributeValueMemberN{Value: strconv.FormatUint(es.shardCount, 10)},
+			":next_shard_count": &types.AttributeValueMemberN{Value: strconv.FormatUint(es.nextShardCount, 10)},
+		},
+	}
+}
+
+// getLatestSnapshotByIdResharding gets the snapshot from the next shard layout, or from the current one if it is not copied yet.
+func (es *EventStoreOnDynamoDB) getLatestSnapshotByIdResharding(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	item, err := es.getSnapshotItem(ctx, aggregateId, es.keyResolver.ResolvePkey(aggregateId, es.nextShardCount))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		item, err = es.getSnapshotItem(ctx, aggregateId, es.keyResolver.ResolvePkey(aggregateId, es.shardCount))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if item == nil {
+		return &AggregateResult{}, nil
+	}
+
+	aggregate, err := es.snapshotFromItem(item)
+	if err != nil {
+		return nil, err
+	}
+	return &AggregateResult{aggregate}, nil
+}
+
+// getEventsByIdSinceSeqNrResharding queries the events from the next shard layout, or from the current one if they are not copied yet.
+func (es *EventStoreOnDynamoDB) getEventsByIdSinceSeqNrResharding(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	pkey := es.keyResolver.ResolvePkey(aggregateId, es.nextShardCount)
+	item, err := es.getSnapshotItem(ctx, aggregateId, pkey)
+	if err != nil {
+		return nil, err
+	}
+	// The snapshot of seqNr 0 is copied after the events, so the events are copied if it is.
+	if item == nil {
+		pkey = es.keyResolver.ResolvePkey(aggregateId, es.shardCount)
+	}
+	return es.queryEventsByPkey(ctx, aggregateId, seqNr, pkey)
+}
+
+// ensureResharded copies the items of the aggregate to the next shard layout before it is written, if they are not copied yet.
+func (es *EventStoreOnDynamoDB) ensureResharded(ctx context.Context, aggregateId AggregateId) error {
+	fromPkey := es.keyResolver.ResolvePkey(aggregateId, es.shardCount)
+	toPkey := es.keyResolver.ResolvePkey(aggregateId, es.nextShardCount)
+	if fromPkey == toPkey {
+		return nil
+	}
+	item, err := es.getSnapshotItem(ctx, aggregateId, toPkey)
+	if err != nil || item != nil {
+		return err
+	}
+	return copyAggregateItems(ctx, es.client, []string{es.journalTableName, es.snapshotTableName}, aggregateId.AsString(), fromPkey, toPkey)
+}
+
+// addReshardingFilter filters the items of a query on an aid index to those of the next shard layout while resharding.
+func (es *EventStoreOnDynamoDB) addReshardingFilter(request *dynamodb.QueryInput, aggregateId AggregateId) {
+	if !es.resharding() {
+		return
+	}
+	filter := "#pkey = :pkey"
+	if request.FilterExpression != nil {
+		filter = *request.FilterExpression + " AND " + filter
+	}
+	request.FilterExpression = aws.String(filter)
+	request.ExpressionAttributeNames["#pkey"] = "pkey"
+	request.ExpressionAttributeValues[":pkey"] = &types.AttributeValueMemberS{Value: es.keyResolver.ResolvePkey(aggregateId, es.nextShardCount)}
+}
+
+// distinctEvents returns the events without the copies of the same event in both shard layouts.
+func distinctEvents(events []Event) []Event {
+	seen := make(map[string]bool, len(events))
+	result := make([]Event, 0, len(events))
+	for _, event := range events {
+		if !seen[event.GetId()] {
+			seen[event.GetId()] = true
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// getShardLayout returns the shard layout recorded in the snapshot table, or nil if it is not recorded.
+func getShardLayout(ctx context.Context, client *dynamodb.Client, snapshotTableName string) (*ShardLayout, error) {
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(snapshotTableName),
+		Key: map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: shardLayoutKey},
+			"skey": &types.AttributeValueMemberS{Value: shardLayoutKey},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, NewIOError("Failed to getShardLayout getItem", err)
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+	layout := &ShardLayout{}
+	if layout.ShardCount, err = strconv.ParseUint(result.Item["shard_count"].(*types.AttributeValueMemberN).Value, 10, 64); err != nil {
+		return nil, NewDeserializationError("Failed to parse the shard count", err)
+	}
+	if layout.NextShardCount, err = strconv.ParseUint(result.Item["next_shard_count"].(*types.AttributeValueMemberN).Value, 10, 64); err != nil {
+		return nil, NewDeserializationError("Failed to parse the next shard count", err)
+	}
+	return layout, nil
+}
+
+// putShardLayoutIfNotExists records the shard layout unless one is recorded, and returns whether it did.
+func putShardLayoutIfNotExists(ctx context.Context, client *dynamodb.Client, snapshotTableName string, layout ShardLayout) (bool, error) {
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(snapshotTableName),
+		Item:                shardLayoutItem(layout),
+		ConditionExpression: aws.String("attribute_not_exists(pkey)"),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return false, nil
+		}
+		return false, NewIOError("Failed to putShardLayoutIfNotExists putItem", err)
+	}
+	return true, nil
+}
+
+// replaceShardLayout records the shard layout if the recorded one is the expected one, and returns whether it did.
+func replaceShardLayout(ctx context.Context, client *dynamodb.Client, snapshotTableName string, expected ShardLayout, layout ShardLayout) (bool, error) {
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(snapshotTableName),
+		Item:                shardLayoutItem(layout),
+		ConditionExpression: aws.String("#shard_count = :shard_count AND #next_shard_count = :next_shard_count"),
+		ExpressionAttributeNames: map[string]string{
+			"#shard_count":      "shard_count",
+			"#next_shard_count": "next_shard_count",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":shard_count":      &types.AttributeValueMemberN{Value: strconv.FormatUint(expected.ShardCount, 10)},
+			":next_shard_count": &types.AttributeValueMemberN{Value: strconv.FormatUint(expected.NextShardCount, 10)},
+		},
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return false, nil
+		}
+		return false, NewIOError("Failed to replaceShardLayout putItem", err)
+	}
+	return true, nil
+}
+
+func shardLayoutItem(layout ShardLayout) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pkey":             &types.AttributeValueMemberS{Value: shardLayoutKey},
+		"skey":             &types.AttributeValueMemberS{Value: shardLayoutKey},
+		"shard_count":      &types.AttributeValueMemberN{Value: strconv.FormatUint(layout.ShardCount, 10)},
+		"next_shard_count": &types.AttributeValueMemberN{Value: strconv.FormatUint(layout.NextShardCount, 10)},
+	}
+}
+
+// copyAggregateItems copies the items of the aggregate in the tables from one pkey to another.
+//
+// The items already copied are left as they are, except the snapshot of seqNr 0, whose copy is replaced
+// if the snapshot has a higher version. It is copied last, so its presence under the new pkey means that
+// the other items are copied. The copies are marked by the copied attribute, so that StreamSubscription
+// does not deliver their events again.
+func copyAggregateItems(ctx context.Context, client *dynamodb.Client, tableNames []string, aid string, fromPkey string, toPkey string) error {
+	for _, tableName := range tableNames {
+		items, err := queryAggregateItems(ctx, client, tableName, aid, fromPkey)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(items, func(i, j int) bool { return !isSeqNrZero(items[i]) && isSeqNrZero(items[j]) })
+		for _, item := range items {
+			copied := maps.Clone(item)
+			copied["pkey"] = &types.AttributeValueMemberS{Value: toPkey}
+			copied[copiedAttributeName] = &types.AttributeValueMemberBOOL{Value: true}
+			input := &dynamodb.PutItemInput{
+				TableName:           aws.String(tableName),
+				Item:                copied,
+				ConditionExpression: aws.String("attribute_not_exists(pkey)"),
+			}
+			if version, ok := item["version"].(*types.AttributeValueMemberN); ok && isSeqNrZero(item) {
+				// The snapshot may have been updated after it was copied.
+				input.ConditionExpression = aws.String("attribute_not_exists(pkey) OR #version < :version")
+				input.ExpressionAttributeNames = map[string]string{"#version": "version"}
+				input.ExpressionAttributeValues = map[string]types.AttributeValue{":version": version}
+			}
+			_, err := client.PutItem(ctx, input)
+			if err != nil {
+				var conditionalCheckFailed *types.ConditionalCheckFailedException
+				if errors.As(err, &conditionalCheckFailed) {
+					continue
+				}
+				return NewIOError("Failed to copyAggregateItems putItem", err)
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAggregateItems deletes the items of the aggregate in the tables under the pkey, the snapshot of seqNr 0 last.
+func deleteAggregateItems(ctx context.Context, client *dynamodb.Client, tableNames []string, aid string, pkey string) (int, error) {
+	deleted := 0
+	for _, tableName := range tableNames {
+		items, err := queryAggregateItems(ctx, client, tableName, aid, pkey)
+		if err != nil {
+			return deleted, err
+		}
+		sort.SliceStable(items, func(i, j int) bool { return !isSeqNrZero(items[i]) && isSeqNrZero(items[j]) })
+		for _, item := range items {
+			_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(tableName),
+				Key: map[string]types.AttributeValue{
+					"pkey": item["pkey"],
+					"skey": item["skey"],
+				},
+			})
+			if err != nil {
+				return deleted, NewIOError("Failed to deleteAggregateItems deleteItem", err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// queryAggregateItems returns the items of the aggregate under the pkey with strongly consistent reads.
+func queryAggregateItems(ctx context.Context, client *dynamodb.Client, tableName string, aid string, pkey string) ([]map[string]types.AttributeValue, error) {
+	request := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("#pkey = :pkey"),
+		FilterExpression:       aws.String("#aid = :aid"),
+		ExpressionAttributeNames: map[string]string{
+			"#pkey": "pkey",
+			"#aid":  "aid",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pkey": &types.AttributeValueMemberS{Value: pkey},
+			":aid":  &types.AttributeValueMemberS{Value: aid},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	var items []map[string]types.AttributeValue
+	for {
+		result, err := client.Query(ctx, request)
+		if err != nil {
+			return nil, NewIOError("Failed to queryAggregateItems query", err)
+		}
+		items = append(items, result.Items...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		request.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+func isSeqNrZero(item map[string]types.AttributeValue) bool {
+	seqNr, ok := item["seq_nr"].(*types.AttributeValueMemberN)
+	return ok && seqNr.Value == "0"
+}
+
+// storedAggregateId is the AggregateId of a stored item, whose aid is {TypeName}-{Value}
+// and whose pkey is {TypeName}-{shard} as resolved by the DefaultKeyResolver.
+type storedAggregateId struct {
+	typeName string
+	value    string
+}
+
+// newStoredAggregateId returns the AggregateId of the item, or false if its pkey and aid are not as expected.
+func newStoredAggregateId(item map[string]types.AttributeValue) (*storedAggregateId, bool) {
+	pkey, ok := item["pkey"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, false
+	}
+	aid, ok := item["aid"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, false
+	}
+	i := strings.LastIndexByte(pkey.Value, '-')
+	if i < 0 || !strings.HasPrefix(aid.Value, pkey.Value[:i+1]) {
+		return nil, false
+	}
+	return &storedAggregateId{typeName: pkey.Value[:i], value: aid.Value[i+1:]}, true
+}
+
+func (id *storedAggregateId) String() string {
+	return id.AsString()
+}
+
+func (id *storedAggregateId) GetTypeName() string {
+	return id.typeName
+}
+
+func (id *storedAggregateId) GetValue() string {
+	return id.value
+}
+
+func (id *storedAggregateId) AsString() string {
+	return id.typeName + "-" + id.value
+}
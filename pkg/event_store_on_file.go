@@ -0,0 +1,770 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	fileJournalDirName  = "journal"
+	fileSnapshotDirName = "snapshot"
+	fileSegmentSuffix   = ".log"
+	fileSnapshotSuffix  = ".snapshot"
+	// fileRecordHeaderSize is the size of the length and the checksum preceding the body of a record.
+	fileRecordHeaderSize = 8
+)
+
+var fileChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornFileRecord is the error of a record cut short by the end of its segment.
+var errTornFileRecord = errors.New("torn record")
+
+// errFileEventStoreClosed is the error of an operation of a closed EventStoreOnFile.
+var errFileEventStoreClosed = NewIOError("The store is closed", nil)
+
+// fileRecord is the body of a record in a segment.
+//
+// A record carries the event and, when the write persists one, the snapshot, so that both are written atomically.
+type fileRecord struct {
+	Aid        string `json:"aid"`
+	SeqNr      uint64 `json:"seq_nr"`
+	TypeName   string `json:"type_name"`
+	OccurredAt uint64 `json:"occurred_at"`
+	Version    uint64 `json:"version"`
+	Event      []byte `json:"event"`
+	Snapshot   []byte `json:"snapshot,omitempty"`
+}
+
+// fileLatestSnapshot is the content of the latest snapshot file of an aggregate.
+type fileLatestSnapshot struct {
+	Version uint64 `json:"version"`
+	Payload []byte `json:"payload"`
+}
+
+// filePosition is the position of a record in a segment.
+type filePosition struct {
+	path   string
+	offset int64
+	size   int64
+}
+
+// fileEventEntry is the index entry of an event.
+type fileEventEntry struct {
+	position   filePosition
+	seqNr      uint64
+	typeName   string
+	occurredAt uint64
+}
+
+// fileAggregateEntry is the index entry of an aggregate.
+type fileAggregateEntry struct {
+	version uint64
+	events  []fileEventEntry
+	// snapshot is the position of the last record carrying a snapshot.
+	snapshot filePosition
+	// snapshotVersion is the version of the last record carrying a snapshot.
+	snapshotVersion uint64
+}
+
+// fileSegment is the active segment of a shard.
+type fileSegment struct {
+	file   *os.File
+	number uint64
+	size   int64
+}
+
+// EventStoreOnFile is EventStore for the local filesystem.
+//
+// Events are appended to segmented, checksummed log files under journal/{pkey}, and the latest snapshots
+// are written under snapshot/{aid}. The index from aid to the offsets of the records is kept in memory and
+// rebuilt from the logs when the store is opened. A torn record at the end of the last segment of a shard is
+// truncated; a corrupted record anywhere else fails the opening. If a failed append cannot be rolled back,
+// the store refuses further writes until it is reopened.
+//
+// Only one process may open a directory at a time.
+type EventStoreOnFile struct {
+	eventStoreConfig
+	dir               string
+	shardCount        uint64
+	segmentSize       int64
+	eventConverter    EventConverter
+	snapshotConverter AggregateConverter
+
+	mu         sync.RWMutex
+	aggregates map[string]*fileAggregateEntry
+	segments   map[string]*fileSegment
+	// failure is the error of an append that could not be rolled back, which fails the later appends.
+	failure error
+	closed  bool
+}
+
+// NewEventStoreOnFile opens the directory and returns a new EventStore.
+//
+// # Parameters
+// - dir is the directory of the store, which is created if it does not exist.
+// - shardCount is a shard count used to resolve the journal directory of an aggregate.
+// - segmentSize is the size in bytes at which a new segment is started.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStoreOnFile, which must be closed
+// - an error
+func NewEventStoreOnFile(
+	dir string,
+	shardCount uint64,
+	segmentSize int64,
+	eventConverter EventConverter,
+	snapshotConverter AggregateConverter,
+	options ...EventStoreOption,
+) (*EventStoreOnFile, error) {
+	if dir == "" {
+		return nil, errors.New("dir is empty")
+	}
+	if shardCount == 0 {
+		return nil, errors.New("shardCount is zero")
+	}
+	if segmentSize <= 0 {
+		return nil, errors.New("segmentSize is not positive")
+	}
+	config, err := newNonDynamoDBEventStoreConfig(options...)
+	if err != nil {
+		return nil, err
+	}
+	es := &EventStoreOnFile{
+		eventStoreConfig:  config,
+		dir:               dir,
+		shardCount:        shardCount,
+		segmentSize:       segmentSize,
+		eventConverter:    eventConverter,
+		snapshotConverter: snapshotConverter,
+		aggregates:        make(map[string]*fileAggregateEntry),
+		segments:          make(map[string]*fileSegment),
+	}
+	for _, name := range []string{fileJournalDirName, fileSnapshotDirName} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			return nil, NewIOError("Failed to create the directory", err)
+		}
+	}
+	if err := es.rebuildIndex(); err != nil {
+		_ = es.Close()
+		return nil, err
+	}
+	if err := es.repairSnapshots(); err != nil {
+		_ = es.Close()
+		return nil, err
+	}
+
+	return es, nil
+}
+
+// Close closes the active segments. The operations after Close return an IOError.
+func (es *EventStoreOnFile) Close() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.closed = true
+	var errs []error
+	for shard, segment := range es.segments {
+		if err := segment.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(es.segments, shard)
+	}
+	return errors.Join(errs...)
+}
+
+func (es *EventStoreOnFile) GetLatestSnapshotById(_ context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+	// The lock is held while reading the file so that the version matches the snapshot written with it.
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	if es.closed {
+		return nil, errFileEventStoreClosed
+	}
+	entry, ok := es.aggregates[aggregateId.AsString()]
+	if !ok {
+		return &AggregateResult{}, nil
+	}
+
+	data, err := os.ReadFile(es.snapshotPath(aggregateId.AsString(), 0))
+	if err != nil {
+		return nil, NewIOError("Failed to read the snapshot file", err)
+	}
+	var latest fileLatestSnapshot
+	if err := json.Unmarshal(data, &latest); err != nil {
+		return nil, NewDeserializationError("Failed to decode the snapshot file", err)
+	}
+	var aggregateMap map[string]any
+	if err := es.snapshotSerializer.Deserialize(latest.Payload, &aggregateMap); err != nil {
+		return nil, err
+	}
+	aggregate, err := es.snapshotConverter(aggregateMap)
+	if err != nil {
+		return nil, NewDeserializationError("Failed to convert the snapshot", err)
+	}
+	return &AggregateResult{aggregate.WithVersion(entry.version)}, nil
+}
+
+func (es *EventStoreOnFile) GetEventsByIdSinceSeqNr(_ context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+	es.mu.RLock()
+	if es.closed {
+		es.mu.RUnlock()
+		return nil, errFileEventStoreClosed
+	}
+	var entries []fileEventEntry
+	if entry, ok := es.aggregates[aggregateId.AsString()]; ok {
+		for _, event := range entry.events {
+			if event.seqNr >= seqNr {
+				entries = append(entries, event)
+			}
+		}
+	}
+	es.mu.RUnlock()
+
+	return es.readEvents(entries)
+}
+
+// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name whose occurred at is within [from, to].
+func (es *EventStoreOnFile) GetEventsByTypeNameAndOccurredAt(_ context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	es.mu.RLock()
+	if es.closed {
+		es.mu.RUnlock()
+		return nil, errFileEventStoreClosed
+	}
+	var entries []fileEventEntry
+	for _, entry := range es.aggregates {
+		for _, event := range entry.events {
+			if event.typeName == typeName && event.occurredAt >= from && event.occurredAt <= to {
+				entries = append(entries, event)
+			}
+		}
+	}
+	es.mu.RUnlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].occurredAt < entries[j].occurredAt
+	})
+
+	return es.readEvents(entries)
+}
+
+func (es *EventStoreOnFile) PersistEvent(_ context.Context, event Event, version uint64) error {
+	if event.IsCreated() {
+		panic("event is created")
+	}
+	return es.append(event, version, nil)
+}
+
+func (es *EventStoreOnFile) PersistEventAndSnapshot(_ context.Context, event Event, aggregate Aggregate) error {
+	if aggregate == nil {
+		return errors.New("aggregate is nil")
+	}
+	if event.IsCreated() {
+		return es.append(event, 0, aggregate)
+	}
+	return es.append(event, aggregate.GetVersion(), aggregate)
+}
+
+// append appends the record of the event and the snapshot if the version matches, and then writes the snapshot files.
+//
+// # Parameters
+// - event is an event to store.
+// - version is the expected version of the aggregate, ignored if the event is created.
+// - aggregate is an aggregate to store, or nil.
+// # Returns
+// - an error, which is an OptimisticLockError if the version or the seqNr conflicts
+//
+// If writing the snapshot files fails, the record is already durable and the error is an IOError;
+// the snapshot files are repaired from the logs when the store is opened again.
+func (es *EventStoreOnFile) append(event Event, version uint64, aggregate Aggregate) error {
+	if event == nil {
+		panic("event is nil")
+	}
+	aid := event.GetAggregateId().AsString()
+	eventPayload, err := es.eventSerializer.Serialize(event)
+	if err != nil {
+		return err
+	}
+	var snapshotPayload []byte
+	if aggregate != nil {
+		if snapshotPayload, err = es.snapshotSerializer.Serialize(aggregate); err != nil {
+			return err
+		}
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		return errFileEventStoreClosed
+	}
+	entry, ok := es.aggregates[aid]
+	if event.IsCreated() {
+		if ok {
+			return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+		}
+		entry = &fileAggregateEntry{}
+	} else {
+		if !ok || entry.version != version {
+			return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+		}
+		for _, existing := range entry.events {
+			if existing.seqNr == event.GetSeqNr() {
+				return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+			}
+		}
+	}
+
+	record := fileRecord{
+		Aid:        aid,
+		SeqNr:      event.GetSeqNr(),
+		TypeName:   event.GetTypeName(),
+		OccurredAt: event.GetOccurredAt(),
+		Version:    entry.version + 1,
+		Event:      eventPayload,
+		Snapshot:   snapshotPayload,
+	}
+	position, err := es.appendRecord(es.keyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount), &record)
+	if err != nil {
+		return err
+	}
+	es.aggregates[aid] = entry
+	es.index(entry, &record, position)
+	if aggregate == nil {
+		return nil
+	}
+
+	if err := es.writeLatestSnapshot(aid, record.Version, snapshotPayload); err != nil {
+		return err
+	}
+	if es.keepSnapshot {
+		if err := writeFileAtomically(es.snapshotPath(aid, aggregate.GetSeqNr()), snapshotPayload); err != nil {
+			return NewIOError("Failed to write the snapshot file", err)
+		}
+		if err := es.purgeExcessSnapshots(aid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index adds the record at the position to the entry of its aggregate.
+func (es *EventStoreOnFile) index(entry *fileAggregateEntry, record *fileRecord, position filePosition) {
+	entry.version = record.Version
+	entry.events = append(entry.events, fileEventEntry{
+		position:   position,
+		seqNr:      record.SeqNr,
+		typeName:   record.TypeName,
+		occurredAt: record.OccurredAt,
+	})
+	if record.Snapshot != nil {
+		entry.snapshot = position
+		entry.snapshotVersion = record.Version
+	}
+}
+
+// appendRecord appends the record to the active segment of the shard and syncs it.
+//
+// # Parameters
+// - shard is the pkey of the shard.
+// - record is a record to append.
+// # Returns
+// - the position of the record
+// - an error
+func (es *EventStoreOnFile) appendRecord(shard string, record *fileRecord) (filePosition, error) {
+	if es.failure != nil {
+		return filePosition{}, es.failure
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return filePosition{}, NewSerializationError("Failed to encode the record", err)
+	}
+	if len(body) > math.MaxUint32 {
+		return filePosition{}, NewSerializationError("The record is too large", nil)
+	}
+	data := make([]byte, fileRecordHeaderSize+len(body))
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.Checksum(body, fileChecksumTable))
+	copy(data[fileRecordHeaderSize:], body)
+
+	segment, err := es.activeSegment(shard, int64(len(data)))
+	if err != nil {
+		return filePosition{}, err
+	}
+	if _, err := segment.file.Write(data); err != nil {
+		// Drop the partial record so that the next append starts at a record boundary.
+		es.rollbackAppend(segment)
+		return filePosition{}, NewIOError("Failed to append the record", err)
+	}
+	if err := segment.file.Sync(); err != nil {
+		// The record is not durable, so it must not be read back after a later append succeeds.
+		es.rollbackAppend(segment)
+		return filePosition{}, NewIOError("Failed to sync the segment", err)
+	}
+	position := filePosition{path: segment.file.Name(), offset: segment.size, size: int64(len(data))}
+	segment.size += int64(len(data))
+	return position, nil
+}
+
+// rollbackAppend truncates the segment to its size before a failed append.
+//
+// If the truncation fails, the store is failed so that no record is appended after the failed one.
+func (es *EventStoreOnFile) rollbackAppend(segment *fileSegment) {
+	if err := segment.file.Truncate(segment.size); err != nil {
+		es.failure = NewIOError("Failed to roll back an append; reopen the store", err)
+	}
+}
+
+// activeSegment returns the segment of the shard to append a record of the size to, starting a new one if it is full.
+func (es *EventStoreOnFile) activeSegment(shard string, size int64) (*fileSegment, error) {
+	segment, ok := es.segments[shard]
+	if ok && (segment.size == 0 || segment.size+size <= es.segmentSize) {
+		return segment, nil
+	}
+	number := uint64(0)
+	if ok {
+		if err := segment.file.Close(); err != nil {
+			return nil, NewIOError("Failed to close the segment", err)
+		}
+		number = segment.number + 1
+	}
+	journalDir := filepath.Join(es.dir, fileJournalDirName)
+	shardDir := filepath.Join(journalDir, url.PathEscape(shard))
+	if err := os.MkdirAll(shardDir, 0o755); err != nil {
+		return nil, NewIOError("Failed to create the shard directory", err)
+	}
+	file, err := os.OpenFile(filepath.Join(shardDir, formatFileNumber(number)+fileSegmentSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, NewIOError("Failed to open the segment", err)
+	}
+	// The entries of the new segment and shard directory must be durable for the records synced to it to be.
+	for _, dir := range []string{shardDir, journalDir} {
+		if err := syncDir(dir); err != nil {
+			_ = file.Close()
+			return nil, NewIOError("Failed to sync the directory of the segment", err)
+		}
+	}
+	segment = &fileSegment{file: file, number: number}
+	es.segments[shard] = segment
+	return segment, nil
+}
+
+// readEvents reads the events at the positions of the entries.
+func (es *EventStoreOnFile) readEvents(entries []fileEventEntry) ([]Event, error) {
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		record, err := readRecordAt(entry.position)
+		if err != nil {
+			return nil, err
+		}
+		var eventMap map[string]any
+		if err := es.eventSerializer.Deserialize(record.Event, &eventMap); err != nil {
+			return nil, err
+		}
+		event, err := es.eventConverter(eventMap)
+		if err != nil {
+			return nil, NewDeserializationError("Failed to convert the event", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// rebuildIndex scans the segments of all shards and rebuilds the index, truncating torn records at the end of the shards.
+func (es *EventStoreOnFile) rebuildIndex() error {
+	shardDirs, err := os.ReadDir(filepath.Join(es.dir, fileJournalDirName))
+	if err != nil {
+		return NewIOError("Failed to read the journal directory", err)
+	}
+	for _, shardDir := range shardDirs {
+		if !shardDir.IsDir() {
+			continue
+		}
+		shard, err := url.PathUnescape(shardDir.Name())
+		if err != nil {
+			return NewIOError(fmt.Sprintf("Invalid shard directory %s", shardDir.Name()), err)
+		}
+		if err := es.rebuildShard(shard, filepath.Join(es.dir, fileJournalDirName, shardDir.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildShard scans the segments of the shard in order and opens its last segment for appending.
+func (es *EventStoreOnFile) rebuildShard(shard string, shardDir string) error {
+	numbers, err := listFileNumbers(shardDir, fileSegmentSuffix)
+	if err != nil {
+		return NewIOError("Failed to read the shard directory", err)
+	}
+	for i, number := range numbers {
+		path := filepath.Join(shardDir, formatFileNumber(number)+fileSegmentSuffix)
+		last := i == len(numbers)-1
+		size, err := es.scanSegment(path, last)
+		if err != nil {
+			return err
+		}
+		if !last {
+			continue
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return NewIOError("Failed to open the segment", err)
+		}
+		es.segments[shard] = &fileSegment{file: file, number: number, size: size}
+	}
+	return nil
+}
+
+// scanSegment indexes the records of the segment.
+//
+// A record cut short by the end of the segment, or a corrupted record ending at the end of the segment, is torn.
+//
+// # Parameters
+// - path is the path of the segment.
+// - last is true if the segment is the last of its shard, in which case a torn record at its end is truncated.
+// # Returns
+// - the size of the valid records
+// - an error
+func (es *EventStoreOnFile) scanSegment(path string, last bool) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, NewIOError("Failed to open the segment", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, NewIOError("Failed to stat the segment", err)
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		record, size, err := readRecord(reader, info.Size()-offset)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			torn := errors.Is(err, errTornFileRecord) || offset+size == info.Size()
+			if !last || !torn {
+				return 0, NewIOError(fmt.Sprintf("Corrupted record in %s at offset %d", path, offset), err)
+			}
+			if err := os.Truncate(path, offset); err != nil {
+				return 0, NewIOError("Failed to truncate the torn record", err)
+			}
+			return offset, nil
+		}
+		entry, ok := es.aggregates[record.Aid]
+		if !ok {
+			entry = &fileAggregateEntry{}
+			es.aggregates[record.Aid] = entry
+		}
+		es.index(entry, record, filePosition{path: path, offset: offset, size: size})
+		offset += size
+	}
+}
+
+// repairSnapshots rewrites the latest snapshot files that are missing or older than the logs,
+// which happens if the process stopped between appending a record and writing its snapshot.
+func (es *EventStoreOnFile) repairSnapshots() error {
+	for aid, entry := range es.aggregates {
+		data, err := os.ReadFile(es.snapshotPath(aid, 0))
+		if err == nil {
+			var latest fileLatestSnapshot
+			if json.Unmarshal(data, &latest) == nil && latest.Version == entry.snapshotVersion {
+				continue
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return NewIOError("Failed to read the snapshot file", err)
+		}
+		record, err := readRecordAt(entry.snapshot)
+		if err != nil {
+			return err
+		}
+		if err := es.writeLatestSnapshot(aid, record.Version, record.Snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLatestSnapshot writes the latest snapshot file of the aggregate.
+func (es *EventStoreOnFile) writeLatestSnapshot(aid string, version uint64, payload []byte) error {
+	data, err := json.Marshal(fileLatestSnapshot{Version: version, Payload: payload})
+	if err != nil {
+		return NewSerializationError("Failed to encode the snapshot file", err)
+	}
+	if err := writeFileAtomically(es.snapshotPath(aid, 0), data); err != nil {
+		return NewIOError("Failed to write the snapshot file", err)
+	}
+	return nil
+}
+
+// purgeExcessSnapshots deletes the snapshot files of the aggregate exceeding keepSnapshotCount, oldest first.
+//
+// Excess snapshot files are deleted immediately; deleteTtl is not used by this store.
+func (es *EventStoreOnFile) purgeExcessSnapshots(aid string) error {
+	if es.keepSnapshotCount == 0 {
+		return nil
+	}
+	numbers, err := listFileNumbers(filepath.Dir(es.snapshotPath(aid, 0)), fileSnapshotSuffix)
+	if err != nil {
+		return NewIOError("Failed to read the snapshot directory", err)
+	}
+	// The latest snapshot file is numbered 0 and is never purged.
+	if len(numbers) > 0 && numbers[0] == 0 {
+		numbers = numbers[1:]
+	}
+	if uint64(len(numbers)) <= uint64(es.keepSnapshotCount) {
+		return nil
+	}
+	for _, number := range numbers[:uint64(len(numbers))-uint64(es.keepSnapshotCount)] {
+		if err := os.Remove(es.snapshotPath(aid, number)); err != nil {
+			return NewIOError("Failed to deleteExcessSnapshots delete", err)
+		}
+	}
+	return nil
+}
+
+// snapshotPath returns the path of the snapshot file of the aggregate, where seqNr 0 is the latest snapshot.
+func (es *EventStoreOnFile) snapshotPath(aid string, seqNr uint64) string {
+	return filepath.Join(es.dir, fileSnapshotDirName, url.PathEscape(aid), formatFileNumber(seqNr)+fileSnapshotSuffix)
+}
+
+// readRecord reads a record and verifies its checksum.
+//
+// # Parameters
+// - reader is a reader positioned at the record.
+// - remaining is the number of bytes left to the end of the reader, which bounds the size of the record.
+// # Returns
+// - the record
+// - the size of the record including its header, which is also returned with a corrupted record
+// - an error, which is io.EOF if the reader is at the end, and errTornFileRecord if the record is cut short
+func readRecord(reader io.Reader, remaining int64) (*fileRecord, int64, error) {
+	header := make([]byte, fileRecordHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, errTornFileRecord
+		}
+		return nil, 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > remaining-fileRecordHeaderSize {
+		// The length is checked before the body is allocated.
+		return nil, 0, errTornFileRecord
+	}
+	size := fileRecordHeaderSize + length
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, errTornFileRecord
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(body, fileChecksumTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, size, errors.New("checksum mismatch")
+	}
+	var record fileRecord
+	if err := json.Unmarshal(body, &record); err != nil {
+		return nil, size, err
+	}
+	return &record, size, nil
+}
+
+// readRecordAt reads the record at the position.
+func readRecordAt(position filePosition) (*fileRecord, error) {
+	file, err := os.Open(position.path)
+	if err != nil {
+		return nil, NewIOError("Failed to open the segment", err)
+	}
+	defer file.Close()
+	record, _, err := readRecord(io.NewSectionReader(file, position.offset, position.size), position.size)
+	if err != nil {
+		return nil, NewIOError(fmt.Sprintf("Failed to read the record in %s at offset %d", position.path, position.offset), err)
+	}
+	return record, nil
+}
+
+// writeFileAtomically writes the data to a temporary file and renames it to the path.
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// syncDir syncs the directory, making the entries created in it durable.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// formatFileNumber formats a number as a lexicographically sortable file name.
+func formatFileNumber(number uint64) string {
+	return fmt.Sprintf("%020d", number)
+}
+
+// listFileNumbers returns the numbers of the files with the suffix in the directory, in ascending order.
+func listFileNumbers(dir string, suffix string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var numbers []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), suffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		number, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, nil
+}
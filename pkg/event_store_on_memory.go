@@ -2,24 +2,75 @@ package pkg
 
 import (
 	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
 )
 
 const initialVersion uint64 = 1
 
+// memorySnapshot is a kept snapshot of EventStoreOnMemory.
+type memorySnapshot struct {
+	aggregate Aggregate
+	// expireAt is set on excess snapshots when deleteTtl is specified, emulating the TTL of DynamoDB.
+	expireAt time.Time
+}
+
 // EventStoreOnMemory is the memory implementation of EventStore.
+//
+// It is safe for concurrent use; writes are serialized so that concurrent writes to an aggregate
+// result in exactly one success and OptimisticLockErrors for the others.
+//
+// The write conditions and the snapshot retention follow EventStoreOnDynamoDB:
+// a created event is rejected if the aggregate exists, an event is rejected if its seqNr exists,
+// and an update is rejected if the aggregate does not exist or its version does not match.
 type EventStoreOnMemory struct {
+	eventStoreConfig
+	mu        sync.RWMutex
 	events    map[string][]Event
 	snapshots map[string]Aggregate
+	// keptSnapshots are the snapshots kept by keepSnapshot, by aid and seqNr.
+	keptSnapshots map[string]map[uint64]*memorySnapshot
 }
 
 // NewEventStoreOnMemory is the constructor of EventStoreOnMemory.
 //
 // The returned value is the pointer to EventStoreOnMemory.
 func NewEventStoreOnMemory() EventStore {
-	return &EventStoreOnMemory{events: make(map[string][]Event), snapshots: make(map[string]Aggregate)}
+	es, _ := NewEventStoreOnMemoryWithOptions()
+	return es
+}
+
+// NewEventStoreOnMemoryWithOptions is the constructor of EventStoreOnMemory with options.
+//
+// keepSnapshot, keepSnapshotCount and deleteTtl are applied as in EventStoreOnDynamoDB;
+// the serializers are used by Dump and Load, and the other options are ignored,
+// except that the options only EventStoreOnDynamoDB supports, such as WithHashChain, return an error.
+//
+// # Parameters
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStore
+// - an error
+func NewEventStoreOnMemoryWithOptions(options ...EventStoreOption) (EventStore, error) {
+	config, err := newNonDynamoDBEventStoreConfig(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStoreOnMemory{
+		eventStoreConfig: config,
+		events:           make(map[string][]Event),
+		snapshots:        make(map[string]Aggregate),
+		keptSnapshots:    make(map[string]map[uint64]*memorySnapshot),
+	}, nil
 }
 
 func (es *EventStoreOnMemory) GetLatestSnapshotById(_ context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
 	snapshot := es.snapshots[aggregateId.AsString()]
 	if snapshot != nil {
 		return &AggregateResult{aggregate: snapshot}, nil
@@ -28,6 +79,8 @@ func (es *EventStoreOnMemory) GetLatestSnapshotById(_ context.Context, aggregate
 }
 
 func (es *EventStoreOnMemory) GetEventsByIdSinceSeqNr(_ context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
 	result := make([]Event, 0)
 	for _, event := range es.events[aggregateId.AsString()] {
 		if event.GetSeqNr() >= seqNr {
@@ -38,36 +91,180 @@ func (es *EventStoreOnMemory) GetEventsByIdSinceSeqNr(_ context.Context, aggrega
 	return result, nil
 }
 
+// GetEventsByIdSinceSeqNrWithLimit returns up to limit events of the aggregate since the specified sequence number.
+func (es *EventStoreOnMemory) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit is not positive")
+	}
+	result, err := es.GetEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name whose occurred at is within [from, to].
+func (es *EventStoreOnMemory) GetEventsByTypeNameAndOccurredAt(_ context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	es.mu.RLock()
+	result := make([]Event, 0)
+	for _, events := range es.events {
+		for _, event := range events {
+			if event.GetTypeName() == typeName && event.GetOccurredAt() >= from && event.GetOccurredAt() <= to {
+				result = append(result, event)
+			}
+		}
+	}
+	es.mu.RUnlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].GetOccurredAt() < result[j].GetOccurredAt()
+	})
+
+	return result, nil
+}
+
 func (es *EventStoreOnMemory) PersistEvent(_ context.Context, event Event, version uint64) error {
 	if event.IsCreated() {
 		panic("event is created")
 	}
 
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if err := es.updateEventAndSnapshotOpt(event, version, nil); err != nil {
+		return err
+	}
+	es.tryPurgeExcessSnapshots(event.GetAggregateId().AsString())
+
+	return nil
+}
+
+func (es *EventStoreOnMemory) PersistEventAndSnapshot(_ context.Context, event Event, aggregate Aggregate) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if event.IsCreated() {
+		return es.createEventAndSnapshot(event, aggregate)
+	}
+	if err := es.updateEventAndSnapshotOpt(event, aggregate.GetVersion(), aggregate); err != nil {
+		return err
+	}
+	es.tryPurgeExcessSnapshots(event.GetAggregateId().AsString())
+	return nil
+}
+
+// createEventAndSnapshot creates the event and the snapshot, under the write lock.
+func (es *EventStoreOnMemory) createEventAndSnapshot(event Event, aggregate Aggregate) error {
 	aggregateId := event.GetAggregateId().AsString()
-	if es.snapshots[aggregateId].GetVersion() != version {
+	if es.snapshots[aggregateId] != nil || es.hasEvent(event) || es.hasKeptSnapshot(aggregateId, aggregate) {
 		return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
 	}
-	newVersion := es.snapshots[aggregateId].GetVersion() + 1
-	es.events[aggregateId] = append(es.events[aggregateId], event)
-	snapshot := es.snapshots[aggregateId]
-	snapshot = snapshot.WithVersion(newVersion)
-	es.snapshots[aggregateId] = snapshot
 
+	es.events[aggregateId] = append(es.events[aggregateId], event)
+	es.snapshots[aggregateId] = aggregate.WithVersion(initialVersion)
+	es.keepSnapshotOf(aggregateId, aggregate)
 	return nil
 }
 
-func (es *EventStoreOnMemory) PersistEventAndSnapshot(_ context.Context, event Event, aggregate Aggregate) error {
+// updateEventAndSnapshotOpt appends the event and increments the version of the snapshot,
+// replacing it if aggregate is not nil, under the write lock.
+func (es *EventStoreOnMemory) updateEventAndSnapshotOpt(event Event, version uint64, aggregate Aggregate) error {
 	aggregateId := event.GetAggregateId().AsString()
-	newVersion := initialVersion
-	if !event.IsCreated() {
-		version := es.snapshots[aggregateId].GetVersion()
-		if version != aggregate.GetVersion() {
-			return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
-		}
-		newVersion = es.snapshots[aggregateId].GetVersion() + 1
+	snapshot := es.snapshots[aggregateId]
+	if snapshot == nil || snapshot.GetVersion() != version || es.hasEvent(event) || es.hasKeptSnapshot(aggregateId, aggregate) {
+		return NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
 	}
 
+	if aggregate != nil {
+		snapshot = aggregate
+	}
 	es.events[aggregateId] = append(es.events[aggregateId], event)
-	es.snapshots[aggregateId] = aggregate.WithVersion(newVersion)
+	es.snapshots[aggregateId] = snapshot.WithVersion(version + 1)
+	es.keepSnapshotOf(aggregateId, aggregate)
 	return nil
 }
+
+// hasEvent returns true if the seqNr of the event exists.
+func (es *EventStoreOnMemory) hasEvent(event Event) bool {
+	for _, existing := range es.events[event.GetAggregateId().AsString()] {
+		if existing.GetSeqNr() == event.GetSeqNr() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKeptSnapshot returns true if the snapshot of the seqNr of the aggregate is kept.
+func (es *EventStoreOnMemory) hasKeptSnapshot(aggregateId string, aggregate Aggregate) bool {
+	if !es.keepSnapshot || aggregate == nil {
+		return false
+	}
+	_, ok := es.keptSnapshots[aggregateId][aggregate.GetSeqNr()]
+	return ok
+}
+
+// keepSnapshotOf keeps the snapshot if keepSnapshot is set.
+func (es *EventStoreOnMemory) keepSnapshotOf(aggregateId string, aggregate Aggregate) {
+	if !es.keepSnapshot || aggregate == nil {
+		return
+	}
+	if es.keptSnapshots[aggregateId] == nil {
+		es.keptSnapshots[aggregateId] = make(map[uint64]*memorySnapshot)
+	}
+	es.keptSnapshots[aggregateId][aggregate.GetSeqNr()] = &memorySnapshot{aggregate: aggregate}
+}
+
+// tryPurgeExcessSnapshots purges the kept snapshots exceeding keepSnapshotCount, under the write lock.
+//
+// When deleteTtl is set, excess snapshots expire after it and expired snapshots are deleted.
+func (es *EventStoreOnMemory) tryPurgeExcessSnapshots(aggregateId string) {
+	if !es.keepSnapshot || es.keepSnapshotCount == 0 {
+		return
+	}
+	kept := es.keptSnapshots[aggregateId]
+	seqNrs := make([]uint64, 0, len(kept))
+	for seqNr := range kept {
+		seqNrs = append(seqNrs, seqNr)
+	}
+	sort.Slice(seqNrs, func(i, j int) bool { return seqNrs[i] > seqNrs[j] })
+
+	now := time.Now()
+	if es.deleteTtl < math.MaxInt64 {
+		// As in EventStoreOnDynamoDB, snapshots that are expiring are not counted among the kept ones.
+		count := uint32(0)
+		for _, seqNr := range seqNrs {
+			snapshot := kept[seqNr]
+			if snapshot.expireAt.IsZero() {
+				if count < es.keepSnapshotCount {
+					count++
+					continue
+				}
+				snapshot.expireAt = now.Add(es.deleteTtl)
+			}
+			if !snapshot.expireAt.After(now) {
+				delete(kept, seqNr)
+			}
+		}
+		return
+	}
+	if uint32(len(seqNrs)) > es.keepSnapshotCount {
+		for _, seqNr := range seqNrs[es.keepSnapshotCount:] {
+			delete(kept, seqNr)
+		}
+	}
+}
+
+// GetKeptSnapshotSeqNrsById returns the seqNrs of the snapshots of the aggregate kept by keepSnapshot, in ascending order.
+func (es *EventStoreOnMemory) GetKeptSnapshotSeqNrsById(aggregateId AggregateId) []uint64 {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	now := time.Now()
+	seqNrs := make([]uint64, 0)
+	for seqNr, snapshot := range es.keptSnapshots[aggregateId.AsString()] {
+		if snapshot.expireAt.IsZero() || snapshot.expireAt.After(now) {
+			seqNrs = append(seqNrs, seqNr)
+		}
+	}
+	sort.Slice(seqNrs, func(i, j int) bool { return seqNrs[i] < seqNrs[j] })
+	return seqNrs
+}
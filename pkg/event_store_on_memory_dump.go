@@ -0,0 +1,263 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// memoryDumpFormat is the version of the format written by EventStoreOnMemory.Dump.
+const memoryDumpFormat = 1
+
+// memoryDump is the contents of EventStoreOnMemory written by Dump.
+//
+// Aggregates are ordered by aid, and events and kept snapshots by seqNr, so that dumping the same contents
+// always produces the same bytes. Payloads are the bytes produced by the configured serializers.
+type memoryDump struct {
+	Format     int                   `json:"format"`
+	Aggregates []memoryDumpAggregate `json:"aggregates"`
+}
+
+type memoryDumpAggregate struct {
+	Aid           string               `json:"aid"`
+	Version       uint64               `json:"version"`
+	Snapshot      []byte               `json:"snapshot,omitempty"`
+	Events        []memoryDumpEvent    `json:"events"`
+	KeptSnapshots []memoryDumpSnapshot `json:"kept_snapshots,omitempty"`
+}
+
+type memoryDumpEvent struct {
+	SeqNr   uint64 `json:"seq_nr"`
+	Payload []byte `json:"payload"`
+}
+
+type memoryDumpSnapshot struct {
+	SeqNr    uint64     `json:"seq_nr"`
+	ExpireAt *time.Time `json:"expire_at,omitempty"`
+	Payload  []byte     `json:"payload"`
+}
+
+// Dump writes the journal and the snapshots to the writer, serialized by the configured serializers.
+//
+// Kept snapshots that have expired are not written.
+//
+// # Parameters
+// - w is the writer to write to.
+//
+// # Returns
+// - an error
+func (es *EventStoreOnMemory) Dump(w io.Writer) error {
+	es.mu.RLock()
+	dump, err := es.dump()
+	es.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return NewSerializationError("Failed to serialize the dump", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return NewIOError("Failed to write the dump", err)
+	}
+	return nil
+}
+
+// DumpToFile writes the journal and the snapshots to the file, replacing it atomically.
+//
+// # Parameters
+// - path is the path of the file.
+//
+// # Returns
+// - an error
+func (es *EventStoreOnMemory) DumpToFile(path string) error {
+	var buf bytes.Buffer
+	if err := es.Dump(&buf); err != nil {
+		return err
+	}
+	if err := writeFileAtomically(path, buf.Bytes()); err != nil {
+		return NewIOError("Failed to write the dump file", err)
+	}
+	return nil
+}
+
+// Load replaces the journal and the snapshots with those written by Dump.
+//
+// The contents are left unchanged if an error is returned.
+//
+// # Parameters
+// - r is the reader to read from.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+//
+// # Returns
+// - an error
+func (es *EventStoreOnMemory) Load(r io.Reader, eventConverter EventConverter, snapshotConverter AggregateConverter) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return NewIOError("Failed to read the dump", err)
+	}
+	var dump memoryDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return NewDeserializationError("Failed to deserialize the dump", err)
+	}
+	if dump.Format != memoryDumpFormat {
+		return NewDeserializationError(fmt.Sprintf("Unsupported dump format: %d", dump.Format), nil)
+	}
+
+	events := make(map[string][]Event)
+	snapshots := make(map[string]Aggregate)
+	keptSnapshots := make(map[string]map[uint64]*memorySnapshot)
+	for _, item := range dump.Aggregates {
+		for _, e := range item.Events {
+			event, err := es.deserializeEvent(e.Payload, eventConverter)
+			if err != nil {
+				return err
+			}
+			if event.GetAggregateId().AsString() != item.Aid || event.GetSeqNr() != e.SeqNr {
+				return NewDeserializationError(fmt.Sprintf("The event does not match aid %s and seqNr %d", item.Aid, e.SeqNr), nil)
+			}
+			events[item.Aid] = append(events[item.Aid], event)
+		}
+		if item.Snapshot != nil {
+			aggregate, err := es.deserializeSnapshot(item.Snapshot, snapshotConverter)
+			if err != nil {
+				return err
+			}
+			snapshots[item.Aid] = aggregate.WithVersion(item.Version)
+		}
+		for _, s := range item.KeptSnapshots {
+			aggregate, err := es.deserializeSnapshot(s.Payload, snapshotConverter)
+			if err != nil {
+				return err
+			}
+			if keptSnapshots[item.Aid] == nil {
+				keptSnapshots[item.Aid] = make(map[uint64]*memorySnapshot)
+			}
+			snapshot := &memorySnapshot{aggregate: aggregate}
+			if s.ExpireAt != nil {
+				snapshot.expireAt = *s.ExpireAt
+			}
+			keptSnapshots[item.Aid][s.SeqNr] = snapshot
+		}
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.events = events
+	es.snapshots = snapshots
+	es.keptSnapshots = keptSnapshots
+	return nil
+}
+
+// LoadFromFile replaces the journal and the snapshots with those written by DumpToFile.
+//
+// # Parameters
+// - path is the path of the file.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+//
+// # Returns
+// - an error
+func (es *EventStoreOnMemory) LoadFromFile(path string, eventConverter EventConverter, snapshotConverter AggregateConverter) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return NewIOError("Failed to open the dump file", err)
+	}
+	defer file.Close()
+	return es.Load(file, eventConverter, snapshotConverter)
+}
+
+// dump serializes the contents, under the read lock.
+func (es *EventStoreOnMemory) dump() (*memoryDump, error) {
+	aids := make(map[string]struct{})
+	for aid := range es.events {
+		aids[aid] = struct{}{}
+	}
+	for aid := range es.snapshots {
+		aids[aid] = struct{}{}
+	}
+	sortedAids := make([]string, 0, len(aids))
+	for aid := range aids {
+		sortedAids = append(sortedAids, aid)
+	}
+	sort.Strings(sortedAids)
+
+	now := time.Now()
+	dump := &memoryDump{Format: memoryDumpFormat, Aggregates: make([]memoryDumpAggregate, 0, len(sortedAids))}
+	for _, aid := range sortedAids {
+		item := memoryDumpAggregate{Aid: aid, Events: make([]memoryDumpEvent, 0, len(es.events[aid]))}
+		if snapshot := es.snapshots[aid]; snapshot != nil {
+			payload, err := es.snapshotSerializer.Serialize(snapshot)
+			if err != nil {
+				return nil, err
+			}
+			item.Version = snapshot.GetVersion()
+			item.Snapshot = payload
+		}
+
+		events := append([]Event(nil), es.events[aid]...)
+		sort.SliceStable(events, func(i, j int) bool { return events[i].GetSeqNr() < events[j].GetSeqNr() })
+		for _, event := range events {
+			payload, err := es.eventSerializer.Serialize(event)
+			if err != nil {
+				return nil, err
+			}
+			item.Events = append(item.Events, memoryDumpEvent{SeqNr: event.GetSeqNr(), Payload: payload})
+		}
+
+		kept := es.keptSnapshots[aid]
+		seqNrs := make([]uint64, 0, len(kept))
+		for seqNr := range kept {
+			seqNrs = append(seqNrs, seqNr)
+		}
+		sort.Slice(seqNrs, func(i, j int) bool { return seqNrs[i] < seqNrs[j] })
+		for _, seqNr := range seqNrs {
+			snapshot := kept[seqNr]
+			if !snapshot.expireAt.IsZero() && !snapshot.expireAt.After(now) {
+				continue
+			}
+			payload, err := es.snapshotSerializer.Serialize(snapshot.aggregate)
+			if err != nil {
+				return nil, err
+			}
+			s := memoryDumpSnapshot{SeqNr: seqNr, Payload: payload}
+			if !snapshot.expireAt.IsZero() {
+				expireAt := snapshot.expireAt.UTC()
+				s.ExpireAt = &expireAt
+			}
+			item.KeptSnapshots = append(item.KeptSnapshots, s)
+		}
+		dump.Aggregates = append(dump.Aggregates, item)
+	}
+	return dump, nil
+}
+
+func (es *EventStoreOnMemory) deserializeEvent(payload []byte, eventConverter EventConverter) (Event, error) {
+	var eventMap map[string]any
+	if err := es.eventSerializer.Deserialize(payload, &eventMap); err != nil {
+		return nil, err
+	}
+	event, err := eventConverter(eventMap)
+	if err != nil {
+		return nil, NewDeserializationError("Failed to convert the event", err)
+	}
+	return event, nil
+}
+
+func (es *EventStoreOnMemory) deserializeSnapshot(payload []byte, snapshotConverter AggregateConverter) (Aggregate, error) {
+	var aggregateMap map[string]any
+	if err := es.snapshotSerializer.Deserialize(payload, &aggregateMap); err != nil {
+		return nil, err
+	}
+	aggregate, err := snapshotConverter(aggregateMap)
+	if err != nil {
+		return nil, NewDeserializationError("Failed to convert the snapshot", err)
+	}
+	return aggregate, nil
+}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// eventStoreConfig holds the settings configured by EventStoreOption.
+//
+// The settings of tracing, metrics, logging and batch loading only apply to EventStoreOnDynamoDB and are ignored
+// by the other event stores, which reject the options changing what is written or read, such as WithHashChain.
+type eventStoreConfig struct {
+	keepSnapshot         bool
+	keepSnapshotCount    uint32
+	deleteTtl            time.Duration
+	keyResolver          KeyResolver
+	eventSerializer      EventSerializer
+	snapshotSerializer   SnapshotSerializer
+	journalTypeIndexName string
+	outboxTableName      string
+	tracer               trace.Tracer
+	metrics              Metrics
+	logger               *slog.Logger
+	// slowOperationThreshold is the duration above which an operation is logged; 0 disables it.
+	slowOperationThreshold time.Duration
+	batchLoadConcurrency   int
+	consistentRead         bool
+	// shardLayoutCheckContext is the context of checking the shard layout in the constructor, or nil not to check.
+	shardLayoutCheckContext context.Context
+	// hashChain is whether to chain the hashes of the journal items of an aggregate.
+	hashChain bool
+	// dynamoDBOnlyOptions are the names of the options applied that only EventStoreOnDynamoDB supports.
+	dynamoDBOnlyOptions []string
+}
+
+// newEventStoreConfig returns the default settings with the options applied.
+func newEventStoreConfig(options ...EventStoreOption) (eventStoreConfig, error) {
+	config := eventStoreConfig{
+		keepSnapshot:           false,
+		keepSnapshotCount:      1,
+		deleteTtl:              math.MaxInt64,
+		keyResolver:            &DefaultKeyResolver{},
+		eventSerializer:        &DefaultEventSerializer{},
+		snapshotSerializer:     &DefaultSnapshotSerializer{},
+		tracer:                 noop.NewTracerProvider().Tracer(tracerName),
+		metrics:                NoopMetrics{},
+		logger:                 newDiscardLogger(),
+		slowOperationThreshold: time.Second,
+		batchLoadConcurrency:   8,
+	}
+	for _, option := range options {
+		if err := option(&config); err != nil {
+			return eventStoreConfig{}, err
+		}
+	}
+	return config, nil
+}
+
+// newNonDynamoDBEventStoreConfig returns the settings of an event store other than EventStoreOnDynamoDB,
+// returning an error if an option that only EventStoreOnDynamoDB supports is applied.
+func newNonDynamoDBEventStoreConfig(options ...EventStoreOption) (eventStoreConfig, error) {
+	config, err := newEventStoreConfig(options...)
+	if err != nil {
+		return eventStoreConfig{}, err
+	}
+	if len(config.dynamoDBOnlyOptions) > 0 {
+		return eventStoreConfig{}, fmt.Errorf("the options only supported by EventStoreOnDynamoDB are applied: %s", strings.Join(config.dynamoDBOnlyOptions, ", "))
+	}
+	return config, nil
+}
+
+// EventStoreSettings are the settings configured by EventStoreOption that the event stores
+// in the subpackages, such as pkg/sqlite, apply.
+type EventStoreSettings struct {
+	// KeepSnapshot is whether to keep the snapshots besides the latest one.
+	KeepSnapshot bool
+	// KeepSnapshotCount is the number of the snapshots to keep.
+	KeepSnapshotCount uint32
+	// DeleteTtl is the duration after which the excess snapshots are deleted, or math.MaxInt64 to delete them at once.
+	DeleteTtl time.Duration
+	// KeyResolver resolves the pkey and skey of the items.
+	KeyResolver KeyResolver
+	// EventSerializer serializes the events.
+	EventSerializer EventSerializer
+	// SnapshotSerializer serializes the snapshots.
+	SnapshotSerializer SnapshotSerializer
+}
+
+// NewEventStoreSettings returns the default settings with the options applied.
+//
+// # Parameters
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStoreSettings
+// - an error if an option that only EventStoreOnDynamoDB supports is applied
+func NewEventStoreSettings(options ...EventStoreOption) (EventStoreSettings, error) {
+	config, err := newNonDynamoDBEventStoreConfig(options...)
+	if err != nil {
+		return EventStoreSettings{}, err
+	}
+	return EventStoreSettings{
+		KeepSnapshot:       config.keepSnapshot,
+		KeepSnapshotCount:  config.keepSnapshotCount,
+		DeleteTtl:          config.deleteTtl,
+		KeyResolver:        config.keyResolver,
+		EventSerializer:    config.eventSerializer,
+		SnapshotSerializer: config.snapshotSerializer,
+	}, nil
+}
+
+// EventStoreOption is an option for EventStore.
+//
+// It was a function of *EventStoreOnDynamoDB before the options were shared by the event stores;
+// see docs/MIGRATION_GUIDE.md to migrate custom options.
+type EventStoreOption func(*eventStoreConfig) error
+
+// WithKeepSnapshot sets whether or not to keep snapshots.
+//
+// - If you want to keep snapshots, specify true.
+// - If you do not want to keep snapshots, specify false.
+// - The default is false.
+//
+// # Parameters
+// - keepSnapshot is whether or not to keep snapshots.
+//
+// # Returns
+// - an EventStoreOption.
+func WithKeepSnapshot(keepSnapshot bool) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.keepSnapshot = keepSnapshot
+		return nil
+	}
+}
+
+// WithDeleteTtl sets the ttl for deletion snapshots.
+//
+// - If you want to delete snapshots, specify a time.Duration.
+// - If you do not want to delete snapshots, specify math.MaxInt64.
+// - The default is math.MaxInt64.
+//
+// # Parameters
+// - deleteTtl is the time to live for deletion snapshots.
+//
+// # Returns
+// - an EventStoreOption.
+func WithDeleteTtl(deleteTtl time.Duration) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.deleteTtl = deleteTtl
+		return nil
+	}
+}
+
+// WithKeepSnapshotCount sets a keep snapshot count.
+//
+// - If you want to keep snapshots, specify a keep snapshot count.
+// - If you do not want to keep snapshots, specify math.MaxInt64.
+// - The default is math.MaxInt64.
+//
+// # Parameters
+// - keepSnapshotCount is a keep snapshot count.
+//
+// # Returns
+// - an EventStoreOption.
+func WithKeepSnapshotCount(keepSnapshotCount uint32) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.keepSnapshotCount = keepSnapshotCount
+		return nil
+	}
+}
+
+// WithKeyResolver sets a key resolver.
+//
+// - If you want to change the key resolver, specify a KeyResolver.
+// - The default is DefaultKeyResolver.
+//
+// # Parameters
+// - keyResolver is a key resolver.
+//
+// # Returns
+// - an EventStoreOption.
+func WithKeyResolver(keyResolver KeyResolver) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.keyResolver = keyResolver
+		return nil
+	}
+}
+
+// WithSortableKeyResolver sets the SortableKeyResolver, whose skeys are ordered by seqNr.
+//
+// - Items written with the DefaultKeyResolver must be migrated with MigrateToSortableSkeys first.
+//
+// # Returns
+// - an EventStoreOption.
+func WithSortableKeyResolver() EventStoreOption {
+	return WithKeyResolver(&SortableKeyResolver{})
+}
+
+// WithEventSerializer sets an event serializer.
+//
+// - If you want to change the event serializer, specify an EventSerializer.
+// - The default is DefaultEventSerializer.
+//
+// # Parameters
+// - eventSerializer is an event serializer.
+//
+// # Returns
+// - an EventStoreOption.
+func WithEventSerializer(eventSerializer EventSerializer) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.eventSerializer = eventSerializer
+		return nil
+	}
+}
+
+// WithSnapshotSerializer sets a snapshot serializer.
+//
+// - If you want to change the snapshot serializer, specify a SnapshotSerializer.
+// - The default is DefaultSnapshotSerializer.
+//
+// # Parameters
+// - snapshotSerializer is a snapshot serializer.
+//
+// # Returns
+// - an EventStoreOption.
+func WithSnapshotSerializer(snapshotSerializer SnapshotSerializer) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		c.snapshotSerializer = snapshotSerializer
+		return nil
+	}
+}
@@ -0,0 +1,395 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// tenantSeparator separates the tenant id from the type names of the aggregate ids and events.
+const tenantSeparator = "#"
+
+type tenantIdKey struct{}
+
+// ContextWithTenantId returns a context carrying the tenant id for TenantEventStore.
+//
+// # Parameters
+// - tenantId is the id of the tenant.
+//
+// # Returns
+// - a context
+func ContextWithTenantId(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantIdKey{}, tenantId)
+}
+
+// TenantIdFromContext returns the tenant id set by ContextWithTenantId, or false if it is not set.
+func TenantIdFromContext(ctx context.Context) (string, bool) {
+	tenantId, ok := ctx.Value(tenantIdKey{}).(string)
+	return tenantId, ok
+}
+
+// TenantAggregateId is the interface of an aggregate id that belongs to a tenant.
+type TenantAggregateId interface {
+	AggregateId
+
+	// GetTenantId returns the id of the tenant of the aggregate.
+	GetTenantId() string
+}
+
+// TenantTableNameResolver resolves the journal and snapshot table names of a tenant.
+type TenantTableNameResolver func(tenantId string) (journalTableName string, snapshotTableName string)
+
+// TenantEventStore is an EventStore isolating the aggregates of tenants sharing the underlying EventStores.
+//
+// The tenant of each call is taken from the context, set by ContextWithTenantId, and from the aggregate id
+// if it is a TenantAggregateId. A TenantIsolationError is returned if there is no tenant or they differ.
+//
+// The type names of the aggregate ids and events are prefixed with "{TenantId}#" before they reach the
+// underlying EventStore, so the pkey, skey, aid and type_name of the items are those of the tenant and
+// reads never see the aggregates of other tenants. The payloads are serialized as they are.
+// Decorators keying by the aggregate id, such as CachingEventStore, go under TenantEventStore.
+type TenantEventStore struct {
+	resolveEventStore func(tenantId string) (EventStore, error)
+}
+
+// NewTenantEventStore returns a TenantEventStore storing the aggregates of all tenants in the EventStore.
+//
+// # Parameters
+// - eventStore is the underlying EventStore.
+//
+// # Returns
+// - a TenantEventStore
+// - an error
+func NewTenantEventStore(eventStore EventStore) (*TenantEventStore, error) {
+	if eventStore == nil {
+		return nil, errors.New("eventStore is nil")
+	}
+	return &TenantEventStore{resolveEventStore: func(string) (EventStore, error) {
+		return eventStore, nil
+	}}, nil
+}
+
+// NewTenantEventStoreWithResolver returns a TenantEventStore storing the aggregates of each tenant
+// in the EventStore the resolver returns for it.
+//
+// # Parameters
+// - resolver returns the underlying EventStore of a tenant. It is called for every call of the TenantEventStore.
+//
+// # Returns
+// - a TenantEventStore
+// - an error
+func NewTenantEventStoreWithResolver(resolver func(tenantId string) (EventStore, error)) (*TenantEventStore, error) {
+	if resolver == nil {
+		return nil, errors.New("resolver is nil")
+	}
+	return &TenantEventStore{resolveEventStore: resolver}, nil
+}
+
+// NewTenantEventStoreOnDynamoDB returns a TenantEventStore storing the aggregates of each tenant
+// in the tables the tableNameResolver resolves for it.
+//
+// An EventStoreOnDynamoDB is created on first use of each pair of tables and shared by the tenants resolved to it.
+//
+// # Parameters
+// - client is a DynamoDB client.
+// - tableNameResolver resolves the journal and snapshot table names of a tenant.
+// - journalAidIndexName is a journal aggregateId index name.
+// - snapshotAidIndexName is a snapshot aggregateId index name.
+// - shardCount is a shard count.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+// - options is an EventStoreOption applied to each EventStoreOnDynamoDB.
+//
+// # Returns
+// - a TenantEventStore
+// - an error
+func NewTenantEventStoreOnDynamoDB(
+	client *dynamodb.Client,
+	tableNameResolver TenantTableNameResolver,
+	journalAidIndexName string,
+	snapshotAidIndexName string,
+	shardCount uint64,
+	eventConverter EventConverter,
+	snapshotConverter AggregateConverter,
+	options ...EventStoreOption,
+) (*TenantEventStore, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if tableNameResolver == nil {
+		return nil, errors.New("tableNameResolver is nil")
+	}
+	if journalAidIndexName == "" {
+		return nil, errors.New("journalAidIndexName is empty")
+	}
+	if snapshotAidIndexName == "" {
+		return nil, errors.New("snapshotAidIndexName is empty")
+	}
+	if shardCount == 0 {
+		return nil, errors.New("shardCount is zero")
+	}
+	if _, err := newEventStoreConfig(options...); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	eventStores := make(map[[2]string]EventStore)
+	return NewTenantEventStoreWithResolver(func(tenantId string) (EventStore, error) {
+		journalTableName, snapshotTableName := tableNameResolver(tenantId)
+		tableNames := [2]string{journalTableName, snapshotTableName}
+		mu.Lock()
+		defer mu.Unlock()
+		if eventStore, ok := eventStores[tableNames]; ok {
+			return eventStore, nil
+		}
+		eventStore, err := NewEventStoreOnDynamoDB(client, journalTableName, snapshotTableName,
+			journalAidIndexName, snapshotAidIndexName, shardCount, eventConverter, snapshotConverter, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the event store of tenant %s: %w", tenantId, err)
+		}
+		eventStores[tableNames] = eventStore
+		return eventStore, nil
+	})
+}
+
+func (es *TenantEventStore) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (*AggregateResult, error) {
+	tenantId, eventStore, err := es.resolve(ctx, aggregateId)
+	if err != nil {
+		return nil, err
+	}
+	result, err := eventStore.GetLatestSnapshotById(ctx, newTenantAggregateId(tenantId, aggregateId))
+	if err != nil {
+		return nil, err
+	}
+	if result.Present() {
+		if err := checkTenant(tenantId, result.Aggregate().GetId()); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (es *TenantEventStore) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) ([]Event, error) {
+	tenantId, eventStore, err := es.resolve(ctx, aggregateId)
+	if err != nil {
+		return nil, err
+	}
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, newTenantAggregateId(tenantId, aggregateId), seqNr)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapTenantEvents(tenantId, events)
+}
+
+// GetEventsByIdSinceSeqNrWithLimit returns up to limit events of the aggregate of the tenant,
+// applying the limit in the query if the underlying EventStore is a LimitedEventReader.
+func (es *TenantEventStore) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) ([]Event, error) {
+	tenantId, eventStore, err := es.resolve(ctx, aggregateId)
+	if err != nil {
+		return nil, err
+	}
+	events, err := getEventsByIdSinceSeqNrWithLimit(ctx, eventStore, newTenantAggregateId(tenantId, aggregateId), seqNr, limit)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapTenantEvents(tenantId, events)
+}
+
+// GetEventsByTypeNameAndOccurredAt returns the events of the tenant of the context,
+// if the underlying EventStore is an EventTypeReader.
+func (es *TenantEventStore) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]Event, error) {
+	tenantId, eventStore, err := es.resolve(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	reader, ok := eventStore.(EventTypeReader)
+	if !ok {
+		return nil, errors.New("the underlying EventStore is not an EventTypeReader")
+	}
+	events, err := reader.GetEventsByTypeNameAndOccurredAt(ctx, tenantTypeName(tenantId, typeName), from, to)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapTenantEvents(tenantId, events)
+}
+
+// GetLatestSnapshotsByIds loads the aggregates of the tenant of the context,
+// one by one if the underlying EventStore is not a BatchAggregateReader.
+func (es *TenantEventStore) GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) ([]AggregateLoadResult, error) {
+	tenantId, eventStore, err := es.resolve(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	tenantAggregateIds := make([]AggregateId, len(aggregateIds))
+	for i, aggregateId := range aggregateIds {
+		if err := checkTenant(tenantId, aggregateId); err != nil {
+			return nil, err
+		}
+		tenantAggregateIds[i] = newTenantAggregateId(tenantId, aggregateId)
+	}
+	results, err := getLatestSnapshotsByIds(ctx, eventStore, tenantAggregateIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		result := &results[i]
+		result.AggregateId = aggregateIds[i]
+		if result.Err != nil {
+			continue
+		}
+		if result.Snapshot.Present() {
+			if err := checkTenant(tenantId, result.Snapshot.Aggregate().GetId()); err != nil {
+				*result = AggregateLoadResult{AggregateId: aggregateIds[i], Err: err}
+				continue
+			}
+		}
+		if result.Events, err = unwrapTenantEvents(tenantId, result.Events); err != nil {
+			*result = AggregateLoadResult{AggregateId: aggregateIds[i], Err: err}
+		}
+	}
+	return results, nil
+}
+
+// VerifyHashChain verifies the hash chain of the aggregate of the tenant,
+// if the underlying EventStore is a HashChainVerifier.
+func (es *TenantEventStore) VerifyHashChain(ctx context.Context, aggregateId AggregateId) (*HashChainVerification, error) {
+	tenantId, eventStore, err := es.resolve(ctx, aggregateId)
+	if err != nil {
+		return nil, err
+	}
+	verifier, ok := eventStore.(HashChainVerifier)
+	if !ok {
+		return nil, errors.New("the underlying EventStore is not a HashChainVerifier")
+	}
+	return verifier.VerifyHashChain(ctx, newTenantAggregateId(tenantId, aggregateId))
+}
+
+func (es *TenantEventStore) PersistEvent(ctx context.Context, event Event, version uint64) error {
+	tenantId, eventStore, err := es.resolve(ctx, event.GetAggregateId())
+	if err != nil {
+		return err
+	}
+	return eventStore.PersistEvent(ctx, newTenantEvent(tenantId, event), version)
+}
+
+func (es *TenantEventStore) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
+	tenantId, eventStore, err := es.resolve(ctx, event.GetAggregateId())
+	if err != nil {
+		return err
+	}
+	if err := checkTenant(tenantId, aggregate.GetId()); err != nil {
+		return err
+	}
+	return eventStore.PersistEventAndSnapshot(ctx, newTenantEvent(tenantId, event), aggregate)
+}
+
+// resolve returns the tenant of the context and the aggregate id, which may be nil, and its EventStore.
+func (es *TenantEventStore) resolve(ctx context.Context, aggregateId AggregateId) (string, EventStore, error) {
+	tenantId, ok := TenantIdFromContext(ctx)
+	if !ok {
+		tenantAggregateId, isTenantAggregateId := aggregateId.(TenantAggregateId)
+		if !isTenantAggregateId {
+			return "", nil, NewTenantIsolationError("the tenant is set in neither the context nor the aggregate id")
+		}
+		tenantId = tenantAggregateId.GetTenantId()
+	}
+	if tenantId == "" {
+		return "", nil, NewTenantIsolationError("the tenant id is empty")
+	}
+	if strings.Contains(tenantId, tenantSeparator) {
+		return "", nil, NewTenantIsolationError(fmt.Sprintf("the tenant id %q contains %q", tenantId, tenantSeparator))
+	}
+	if aggregateId != nil {
+		if err := checkTenant(tenantId, aggregateId); err != nil {
+			return "", nil, err
+		}
+	}
+	eventStore, err := es.resolveEventStore(tenantId)
+	if err != nil {
+		return "", nil, err
+	}
+	return tenantId, eventStore, nil
+}
+
+// checkTenant returns a TenantIsolationError if the aggregate id belongs to another tenant.
+func checkTenant(tenantId string, aggregateId AggregateId) error {
+	tenantAggregateId, ok := aggregateId.(TenantAggregateId)
+	if ok && tenantAggregateId.GetTenantId() != tenantId {
+		return NewTenantIsolationError(fmt.Sprintf("the aggregate %s belongs to tenant %s, not %s",
+			aggregateId.AsString(), tenantAggregateId.GetTenantId(), tenantId))
+	}
+	return nil
+}
+
+// unwrapTenantEvents returns the events as they were persisted, checking that they belong to the tenant.
+func unwrapTenantEvents(tenantId string, events []Event) ([]Event, error) {
+	result := make([]Event, len(events))
+	for i, event := range events {
+		if wrapped, ok := event.(*tenantEvent); ok {
+			if wrapped.tenantId != tenantId {
+				return nil, NewTenantIsolationError(fmt.Sprintf("the event %s belongs to tenant %s, not %s",
+					event.GetId(), wrapped.tenantId, tenantId))
+			}
+			event = wrapped.Event
+		}
+		if err := checkTenant(tenantId, event.GetAggregateId()); err != nil {
+			return nil, err
+		}
+		result[i] = event
+	}
+	return result, nil
+}
+
+func tenantTypeName(tenantId string, typeName string) string {
+	return tenantId + tenantSeparator + typeName
+}
+
+// tenantAggregateId is an aggregate id whose type name is prefixed with its tenant id.
+type tenantAggregateId struct {
+	AggregateId
+	tenantId string
+}
+
+func newTenantAggregateId(tenantId string, aggregateId AggregateId) AggregateId {
+	return &tenantAggregateId{AggregateId: aggregateId, tenantId: tenantId}
+}
+
+func (id *tenantAggregateId) String() string {
+	return id.AsString()
+}
+
+func (id *tenantAggregateId) GetTypeName() string {
+	return tenantTypeName(id.tenantId, id.AggregateId.GetTypeName())
+}
+
+func (id *tenantAggregateId) AsString() string {
+	return tenantTypeName(id.tenantId, id.AggregateId.AsString())
+}
+
+// tenantEvent is an event whose type name and aggregate id are prefixed with its tenant id.
+type tenantEvent struct {
+	Event
+	tenantId string
+}
+
+func newTenantEvent(tenantId string, event Event) Event {
+	return &tenantEvent{Event: event, tenantId: tenantId}
+}
+
+func (e *tenantEvent) GetTypeName() string {
+	return tenantTypeName(e.tenantId, e.Event.GetTypeName())
+}
+
+func (e *tenantEvent) GetAggregateId() AggregateId {
+	return newTenantAggregateId(e.tenantId, e.Event.GetAggregateId())
+}
+
+// MarshalJSON serializes the event as it was persisted.
+func (e *tenantEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Event)
+}
@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans created by this package.
+const tracerName = "github.com/szks-repo/event-store-adapter-go/pkg"
+
+// The attributes of the spans created by this package.
+const (
+	aggregateIdAttributeKey   = attribute.Key("event_store.aggregate.id")
+	aggregateTypeAttributeKey = attribute.Key("event_store.aggregate.type")
+	eventTypeAttributeKey     = attribute.Key("event_store.event.type")
+	seqNrAttributeKey         = attribute.Key("event_store.seq_nr")
+	versionAttributeKey       = attribute.Key("event_store.version")
+	itemCountAttributeKey     = attribute.Key("event_store.item_count")
+	outcomeAttributeKey       = attribute.Key("event_store.outcome")
+)
+
+// TracingEventStore is an EventStore that creates a span for each operation of the underlying EventStore.
+//
+// The spans carry the aggregate id and type, the seqNr, the version, the number of items read
+// and the outcome, which is "conflict" for an OptimisticLockError.
+type TracingEventStore struct {
+	eventStore EventStore
+	tracer     trace.Tracer
+}
+
+// NewTracingEventStore returns a new TracingEventStore.
+//
+// # Parameters
+// - eventStore is the EventStore to trace.
+// - tracerProvider is the TracerProvider to create spans with. If nil, the global TracerProvider is used.
+//
+// # Returns
+// - a TracingEventStore
+func NewTracingEventStore(eventStore EventStore, tracerProvider trace.TracerProvider) *TracingEventStore {
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	return &TracingEventStore{eventStore: eventStore, tracer: tracerProvider.Tracer(tracerName)}
+}
+
+func (es *TracingEventStore) GetLatestSnapshotById(ctx context.Context, aggregateId AggregateId) (result *AggregateResult, err error) {
+	ctx, span := startGetLatestSnapshotByIdSpan(ctx, es.tracer, aggregateId)
+	defer func() { endGetLatestSnapshotByIdSpan(span, result, err) }()
+	return es.eventStore.GetLatestSnapshotById(ctx, aggregateId)
+}
+
+func (es *TracingEventStore) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId AggregateId, seqNr uint64) (events []Event, err error) {
+	ctx, span := startGetEventsByIdSinceSeqNrSpan(ctx, es.tracer, aggregateId, seqNr)
+	defer func() { endSpanWithItemCount(span, len(events), err) }()
+	return es.eventStore.GetEventsByIdSinceSeqNr(ctx, aggregateId, seqNr)
+}
+
+// GetEventsByIdSinceSeqNrWithLimit delegates to the underlying EventStore,
+// applying the limit in the query if it is a LimitedEventReader.
+func (es *TracingEventStore) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId AggregateId, seqNr uint64, limit int) (events []Event, err error) {
+	ctx, span := startGetEventsByIdSinceSeqNrSpan(ctx, es.tracer, aggregateId, seqNr)
+	defer func() { endSpanWithItemCount(span, len(events), err) }()
+	return getEventsByIdSinceSeqNrWithLimit(ctx, es.eventStore, aggregateId, seqNr, limit)
+}
+
+// GetLatestSnapshotsByIds delegates to the underlying EventStore,
+// loading the aggregates one by one if it is not a BatchAggregateReader.
+func (es *TracingEventStore) GetLatestSnapshotsByIds(ctx context.Context, aggregateIds []AggregateId) (results []AggregateLoadResult, err error) {
+	ctx, span := es.tracer.Start(ctx, "EventStore.GetLatestSnapshotsByIds")
+	defer func() { endSpanWithItemCount(span, len(results), err) }()
+	return getLatestSnapshotsByIds(ctx, es.eventStore, aggregateIds)
+}
+
+// GetEventsByTypeNameAndOccurredAt delegates to the underlying EventStore if it is an EventTypeReader.
+func (es *TracingEventStore) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) (events []Event, err error) {
+	ctx, span := es.tracer.Start(ctx, "EventStore.GetEventsByTypeNameAndOccurredAt",
+		trace.WithAttributes(eventTypeAttributeKey.String(typeName)))
+	defer func() { endSpanWithItemCount(span, len(events), err) }()
+	reader, ok := es.eventStore.(EventTypeReader)
+	if !ok {
+		return nil, errors.New("the underlying EventStore is not an EventTypeReader")
+	}
+	return reader.GetEventsByTypeNameAndOccurredAt(ctx, typeName, from, to)
+}
+
+func (es *TracingEventStore) PersistEvent(ctx context.Context, event Event, version uint64) (err error) {
+	ctx, span := startPersistEventSpan(ctx, es.tracer, event, version)
+	defer func() { endSpan(span, err) }()
+	return es.eventStore.PersistEvent(ctx, event, version)
+}
+
+func (es *TracingEventStore) PersistEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) (err error) {
+	ctx, span := startPersistEventAndSnapshotSpan(ctx, es.tracer, event, aggregate)
+	defer func() { endSpan(span, err) }()
+	return es.eventStore.PersistEventAndSnapshot(ctx, event, aggregate)
+}
+
+func aggregateIdAttributes(aggregateId AggregateId) []attribute.KeyValue {
+	if aggregateId == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		aggregateIdAttributeKey.String(aggregateId.AsString()),
+		aggregateTypeAttributeKey.String(aggregateId.GetTypeName()),
+	}
+}
+
+func eventAttributes(event Event) []attribute.KeyValue {
+	if event == nil {
+		return nil
+	}
+	return append(aggregateIdAttributes(event.GetAggregateId()),
+		eventTypeAttributeKey.String(event.GetTypeName()),
+		seqNrAttributeKey.Int64(int64(event.GetSeqNr())))
+}
+
+func startGetLatestSnapshotByIdSpan(ctx context.Context, tracer trace.Tracer, aggregateId AggregateId) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "EventStore.GetLatestSnapshotById",
+		trace.WithAttributes(aggregateIdAttributes(aggregateId)...))
+}
+
+func startGetEventsByIdSinceSeqNrSpan(ctx context.Context, tracer trace.Tracer, aggregateId AggregateId, seqNr uint64) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "EventStore.GetEventsByIdSinceSeqNr",
+		trace.WithAttributes(aggregateIdAttributes(aggregateId)...),
+		trace.WithAttributes(seqNrAttributeKey.Int64(int64(seqNr))))
+}
+
+func startPersistEventSpan(ctx context.Context, tracer trace.Tracer, event Event, version uint64) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "EventStore.PersistEvent",
+		trace.WithAttributes(eventAttributes(event)...),
+		trace.WithAttributes(versionAttributeKey.Int64(int64(version))))
+}
+
+func startPersistEventAndSnapshotSpan(ctx context.Context, tracer trace.Tracer, event Event, aggregate Aggregate) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{trace.WithAttributes(eventAttributes(event)...)}
+	if aggregate != nil {
+		options = append(options, trace.WithAttributes(versionAttributeKey.Int64(int64(aggregate.GetVersion()))))
+	}
+	return tracer.Start(ctx, "EventStore.PersistEventAndSnapshot", options...)
+}
+
+func endGetLatestSnapshotByIdSpan(span trace.Span, result *AggregateResult, err error) {
+	count := 0
+	if result != nil && !result.Empty() {
+		count = 1
+		span.SetAttributes(
+			seqNrAttributeKey.Int64(int64(result.Aggregate().GetSeqNr())),
+			versionAttributeKey.Int64(int64(result.Aggregate().GetVersion())))
+	}
+	endSpanWithItemCount(span, count, err)
+}
+
+func endSpanWithItemCount(span trace.Span, count int, err error) {
+	if err == nil {
+		span.SetAttributes(itemCountAttributeKey.Int(count))
+	}
+	endSpan(span, err)
+}
+
+// endSpan records the outcome of the operation and ends the span.
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(outcomeAttributeKey.String(outcomeOf(err)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,193 @@
+package eventstoretest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+const (
+	accountCreatedTypeName = "AccountCreated"
+	accountRenamedTypeName = "AccountRenamed"
+)
+
+var eventIdCounter atomic.Uint64
+
+func newEventId() string {
+	return fmt.Sprintf("event-%d-%d", time.Now().UnixNano(), eventIdCounter.Add(1))
+}
+
+// accountId is the AggregateId of the aggregate used by the suite.
+type accountId struct {
+	Value string
+}
+
+func newAccountId(value string) *accountId {
+	return &accountId{Value: value}
+}
+
+func (id *accountId) GetTypeName() string {
+	return "AccountId"
+}
+
+func (id *accountId) GetValue() string {
+	return id.Value
+}
+
+func (id *accountId) String() string {
+	return fmt.Sprintf("AccountId{Value: %s}", id.Value)
+}
+
+func (id *accountId) AsString() string {
+	return fmt.Sprintf("%s-%s", id.GetTypeName(), id.Value)
+}
+
+// account is the Aggregate used by the suite.
+type account struct {
+	Id      accountId
+	Name    string
+	SeqNr   uint64
+	Version uint64
+}
+
+// newAccount returns a new account and its created event.
+func newAccount(id *accountId, name string) (*account, *accountEvent) {
+	aggregate := &account{Id: *id, Name: name, SeqNr: 1, Version: 1}
+	return aggregate, newAccountEvent(accountCreatedTypeName, id, aggregate.SeqNr, name)
+}
+
+func (a *account) String() string {
+	return fmt.Sprintf("Account{Id: %s, Name: %s, SeqNr: %d, Version: %d}", a.Id.Value, a.Name, a.SeqNr, a.Version)
+}
+
+func (a *account) GetId() pkg.AggregateId {
+	return &a.Id
+}
+
+func (a *account) GetSeqNr() uint64 {
+	return a.SeqNr
+}
+
+func (a *account) GetVersion() uint64 {
+	return a.Version
+}
+
+func (a *account) WithVersion(version uint64) pkg.Aggregate {
+	result := *a
+	result.Version = version
+	return &result
+}
+
+// rename returns the renamed account and its event.
+func (a *account) rename(name string) (*account, *accountEvent) {
+	result := *a
+	result.Name = name
+	result.SeqNr++
+	return &result, newAccountEvent(accountRenamedTypeName, &a.Id, result.SeqNr, name)
+}
+
+// replay applies the events to the account.
+func (a *account) replay(events []pkg.Event) *account {
+	result := *a
+	for _, event := range events {
+		e := event.(*accountEvent)
+		result.Name = e.Name
+		result.SeqNr = e.SeqNr
+	}
+	return &result
+}
+
+// accountEvent is the Event used by the suite.
+type accountEvent struct {
+	Id          string
+	TypeName    string
+	AggregateId accountId
+	SeqNr       uint64
+	Name        string
+	OccurredAt  uint64
+}
+
+func newAccountEvent(typeName string, id *accountId, seqNr uint64, name string) *accountEvent {
+	return &accountEvent{
+		Id:          newEventId(),
+		TypeName:    typeName,
+		AggregateId: *id,
+		SeqNr:       seqNr,
+		Name:        name,
+		OccurredAt:  uint64(time.Now().UnixNano()),
+	}
+}
+
+func (e *accountEvent) String() string {
+	return fmt.Sprintf("%s{Id: %s, AggregateId: %s, SeqNr: %d, Name: %s}", e.TypeName, e.Id, e.AggregateId.Value, e.SeqNr, e.Name)
+}
+
+func (e *accountEvent) GetId() string {
+	return e.Id
+}
+
+func (e *accountEvent) GetTypeName() string {
+	return e.TypeName
+}
+
+func (e *accountEvent) GetAggregateId() pkg.AggregateId {
+	return &e.AggregateId
+}
+
+func (e *accountEvent) GetSeqNr() uint64 {
+	return e.SeqNr
+}
+
+func (e *accountEvent) IsCreated() bool {
+	return e.TypeName == accountCreatedTypeName
+}
+
+func (e *accountEvent) GetOccurredAt() uint64 {
+	return e.OccurredAt
+}
+
+// eventConverter converts the events of the suite from the maps deserialized by the default EventSerializer.
+func eventConverter(m map[string]any) (pkg.Event, error) {
+	aggregateIdMap, ok := m["AggregateId"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("AggregateId is not a map")
+	}
+	value, ok := aggregateIdMap["Value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Value is not a string")
+	}
+	typeName, ok := m["TypeName"].(string)
+	if !ok || (typeName != accountCreatedTypeName && typeName != accountRenamedTypeName) {
+		return nil, fmt.Errorf("unknown event type: %v", m["TypeName"])
+	}
+	id, _ := m["Id"].(string)
+	name, _ := m["Name"].(string)
+	seqNr, _ := m["SeqNr"].(float64)
+	occurredAt, _ := m["OccurredAt"].(float64)
+	return &accountEvent{
+		Id:          id,
+		TypeName:    typeName,
+		AggregateId: accountId{Value: value},
+		SeqNr:       uint64(seqNr),
+		Name:        name,
+		OccurredAt:  uint64(occurredAt),
+	}, nil
+}
+
+// snapshotConverter converts the aggregates of the suite from the maps deserialized by the default SnapshotSerializer.
+func snapshotConverter(m map[string]any) (pkg.Aggregate, error) {
+	idMap, ok := m["Id"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("Id is not a map")
+	}
+	value, ok := idMap["Value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Value is not a string")
+	}
+	name, _ := m["Name"].(string)
+	seqNr, _ := m["SeqNr"].(float64)
+	version, _ := m["Version"].(float64)
+	return &account{Id: accountId{Value: value}, Name: name, SeqNr: uint64(seqNr), Version: uint64(version)}, nil
+}
@@ -0,0 +1,401 @@
+// Package eventstoretest provides a conformance test suite for EventStore implementations.
+//
+// The suite defines its own aggregate and events, so a backend only needs to provide a Factory:
+//
+//	func Test_MyEventStore(t *testing.T) {
+//		eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+//			eventStore, err := NewMyEventStore(eventConverter, snapshotConverter, options...)
+//			require.Nil(t, err)
+//			return eventStore
+//		})
+//	}
+package eventstoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+// Factory returns a new EventStore that contains no aggregates.
+//
+// # Parameters
+// - t is the test of the case, which can be used to register cleanups.
+// - eventConverter is a converter of the events of the suite.
+// - snapshotConverter is a converter of the aggregates of the suite.
+// - options is an EventStoreOption required by the case, to be passed to the store.
+type Factory func(
+	t *testing.T,
+	eventConverter pkg.EventConverter,
+	snapshotConverter pkg.AggregateConverter,
+	options ...pkg.EventStoreOption,
+) pkg.EventStore
+
+// KeptSnapshotCounter returns the number of snapshots of the aggregate kept by keepSnapshot, excluding the latest one.
+type KeptSnapshotCounter func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int
+
+type config struct {
+	keptSnapshotCounter KeptSnapshotCounter
+	serialized          bool
+	concurrentWriters   int
+	racingIOErrors      bool
+}
+
+// Option is an option for Run.
+type Option func(*config)
+
+// WithKeptSnapshotCounter enables the snapshot retention cases, which count the kept snapshots with the counter.
+//
+// - The default is nil, and the cases are skipped.
+func WithKeptSnapshotCounter(counter KeptSnapshotCounter) Option {
+	return func(c *config) {
+		c.keptSnapshotCounter = counter
+	}
+}
+
+// WithoutSerialization skips the cases that require the store to serialize events and snapshots,
+// for stores that keep them as objects such as EventStoreOnMemory.
+func WithoutSerialization() Option {
+	return func(c *config) {
+		c.serialized = false
+	}
+}
+
+// WithConcurrentWriters sets the number of writers racing in the concurrency case.
+//
+// - The default is 8.
+func WithConcurrentWriters(writers int) Option {
+	return func(c *config) {
+		c.concurrentWriters = writers
+	}
+}
+
+// WithRacingIOErrors lets the concurrency case accept writers aborted with an IOError,
+// for stores whose transactions can abort every racing writer, such as DynamoDB transactions
+// canceled by a TransactionConflict.
+//
+// - The default requires exactly one writer to succeed and the others to fail with an OptimisticLockError.
+func WithRacingIOErrors() Option {
+	return func(c *config) {
+		c.racingIOErrors = true
+	}
+}
+
+// Run runs the conformance suite against the EventStore created by the factory.
+//
+// Every case creates its own store with the factory.
+func Run(t *testing.T, factory Factory, options ...Option) {
+	c := &config{serialized: true, concurrentWriters: 8}
+	for _, option := range options {
+		option(c)
+	}
+	s := &suite{config: c, factory: factory}
+
+	t.Run("EmptyAggregate", s.testEmptyAggregate)
+	t.Run("CreateAndRead", s.testCreateAndRead)
+	t.Run("UpdateAndReplayFromSnapshot", s.testUpdateAndReplayFromSnapshot)
+	t.Run("EventsAreOrderedBySeqNr", s.testEventsAreOrderedBySeqNr)
+	t.Run("AggregatesAreIsolated", s.testAggregatesAreIsolated)
+	t.Run("OptimisticLock", s.testOptimisticLock)
+	t.Run("ConcurrentWriters", s.testConcurrentWriters)
+	t.Run("SnapshotRetention", s.testSnapshotRetention)
+	t.Run("ErrorTypes", s.testErrorTypes)
+}
+
+type suite struct {
+	*config
+	factory Factory
+}
+
+func (s *suite) newEventStore(t *testing.T, options ...pkg.EventStoreOption) pkg.EventStore {
+	eventStore := s.factory(t, eventConverter, snapshotConverter, options...)
+	require.NotNil(t, eventStore)
+	return eventStore
+}
+
+// persistRenames creates the account and renames it once per name, persisting a snapshot each time.
+func persistRenames(t *testing.T, ctx context.Context, eventStore pkg.EventStore, id *accountId, names ...string) *account {
+	current, created := newAccount(id, "created")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, created, current))
+	for _, name := range names {
+		renamed, event := current.rename(name)
+		require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, event, renamed))
+		current = renamed.WithVersion(renamed.Version + 1).(*account)
+	}
+	return current
+}
+
+func (s *suite) testEmptyAggregate(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+
+	result, err := eventStore.GetLatestSnapshotById(ctx, newAccountId("missing"))
+	require.Nil(t, err)
+	assert.True(t, result.Empty())
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, newAccountId("missing"), 0)
+	require.Nil(t, err)
+	assert.Empty(t, events)
+}
+
+func (s *suite) testCreateAndRead(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+	id := newAccountId("1")
+
+	initial, created := newAccount(id, "created")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, created, initial))
+
+	result, err := eventStore.GetLatestSnapshotById(ctx, id)
+	require.Nil(t, err)
+	require.True(t, result.Present())
+	snapshot := result.Aggregate().(*account)
+	assert.Equal(t, uint64(1), snapshot.GetVersion())
+	assert.Equal(t, uint64(1), snapshot.GetSeqNr())
+	assert.Equal(t, "created", snapshot.Name)
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, id, 0)
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, created.GetId(), events[0].GetId())
+	assert.True(t, events[0].IsCreated())
+	assert.Equal(t, id.AsString(), events[0].GetAggregateId().AsString())
+}
+
+func (s *suite) testUpdateAndReplayFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+	id := newAccountId("1")
+
+	initial, created := newAccount(id, "created")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, created, initial))
+	renamed, event := initial.rename("a")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, event, renamed))
+	// An event without a snapshot increments the version but keeps the snapshot.
+	renamedAgain, eventAgain := renamed.rename("b")
+	require.Nil(t, eventStore.PersistEvent(ctx, eventAgain, renamed.Version+1))
+
+	result, err := eventStore.GetLatestSnapshotById(ctx, id)
+	require.Nil(t, err)
+	require.True(t, result.Present())
+	snapshot := result.Aggregate().(*account)
+	assert.Equal(t, uint64(3), snapshot.GetVersion())
+	assert.Equal(t, "a", snapshot.Name)
+	assert.Equal(t, uint64(2), snapshot.GetSeqNr())
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, id, snapshot.GetSeqNr()+1)
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	actual := snapshot.replay(events)
+	assert.Equal(t, renamedAgain.Name, actual.Name)
+	assert.Equal(t, renamedAgain.SeqNr, actual.SeqNr)
+}
+
+func (s *suite) testEventsAreOrderedBySeqNr(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+	id := newAccountId("1")
+
+	// More than 10 events, so that seqNrs compared as strings would be misordered.
+	var names []string
+	for i := 0; i < 11; i++ {
+		names = append(names, fmt.Sprintf("name%d", i))
+	}
+	persistRenames(t, ctx, eventStore, id, names...)
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, id, 0)
+	require.Nil(t, err)
+	require.Len(t, events, 12)
+	for i, event := range events {
+		assert.Equal(t, uint64(i+1), event.GetSeqNr())
+	}
+
+	events, err = eventStore.GetEventsByIdSinceSeqNr(ctx, id, 10)
+	require.Nil(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, uint64(10), events[0].GetSeqNr())
+}
+
+func (s *suite) testAggregatesAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+	// The keys of the second aggregate start with the keys of the first one.
+	first := newAccountId("1")
+	second := newAccountId("1-1")
+
+	persistRenames(t, ctx, eventStore, first, "a")
+	persistRenames(t, ctx, eventStore, second, "b", "c")
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, first, 0)
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, first.AsString(), event.GetAggregateId().AsString())
+	}
+	result, err := eventStore.GetLatestSnapshotById(ctx, first)
+	require.Nil(t, err)
+	assert.Equal(t, "a", result.Aggregate().(*account).Name)
+	assert.Equal(t, uint64(2), result.Aggregate().GetVersion())
+}
+
+func (s *suite) testOptimisticLock(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+	id := newAccountId("1")
+	var optimisticLockError *pkg.OptimisticLockError
+
+	initial, created := newAccount(id, "created")
+	renamed, event := initial.rename("a")
+
+	err := eventStore.PersistEvent(ctx, event, initial.Version)
+	assert.True(t, errors.As(err, &optimisticLockError), "update of a missing aggregate: %v", err)
+
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, created, initial))
+	err = eventStore.PersistEventAndSnapshot(ctx, created, initial)
+	assert.True(t, errors.As(err, &optimisticLockError), "duplicate created event: %v", err)
+
+	err = eventStore.PersistEvent(ctx, event, initial.Version+1)
+	assert.True(t, errors.As(err, &optimisticLockError), "newer version: %v", err)
+	err = eventStore.PersistEventAndSnapshot(ctx, event, renamed.WithVersion(initial.Version+1))
+	assert.True(t, errors.As(err, &optimisticLockError), "newer version with a snapshot: %v", err)
+
+	require.Nil(t, eventStore.PersistEvent(ctx, event, initial.Version))
+	err = eventStore.PersistEvent(ctx, event, initial.Version)
+	assert.True(t, errors.As(err, &optimisticLockError), "stale version: %v", err)
+	_, duplicate := initial.rename("b")
+	err = eventStore.PersistEvent(ctx, duplicate, initial.Version+1)
+	assert.True(t, errors.As(err, &optimisticLockError), "duplicate seqNr: %v", err)
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 2)
+	result, err := eventStore.GetLatestSnapshotById(ctx, id)
+	require.Nil(t, err)
+	assert.Equal(t, initial.Version+1, result.Aggregate().GetVersion())
+}
+
+func (s *suite) testConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	eventStore := s.newEventStore(t)
+	id := newAccountId("1")
+
+	initial, created := newAccount(id, "created")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, created, initial))
+
+	errs := make([]error, s.concurrentWriters)
+	var wg sync.WaitGroup
+	for i := 0; i < s.concurrentWriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			renamed, event := initial.rename(fmt.Sprintf("writer%d", i))
+			if i%2 == 0 {
+				errs[i] = eventStore.PersistEvent(ctx, event, initial.Version)
+			} else {
+				errs[i] = eventStore.PersistEventAndSnapshot(ctx, event, renamed)
+			}
+		}(i)
+	}
+	// Readers run alongside the writers, so that the race detector checks their overlap.
+	readErrs := make([]error, s.concurrentWriters)
+	for i := 0; i < s.concurrentWriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := eventStore.GetLatestSnapshotById(ctx, id); err != nil {
+				readErrs[i] = err
+				return
+			}
+			_, readErrs[i] = eventStore.GetEventsByIdSinceSeqNr(ctx, id, 0)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range readErrs {
+		assert.Nil(t, err)
+	}
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		var optimisticLockError *pkg.OptimisticLockError
+		var ioError *pkg.IOError
+		if s.racingIOErrors {
+			assert.True(t, errors.As(err, &optimisticLockError) || errors.As(err, &ioError), "unexpected error: %v", err)
+		} else {
+			assert.True(t, errors.As(err, &optimisticLockError), "unexpected error: %v", err)
+		}
+	}
+	if s.racingIOErrors {
+		// The racing writers may all be aborted, but two writers of the same version never succeed.
+		assert.LessOrEqual(t, succeeded, 1)
+	} else {
+		assert.Equal(t, 1, succeeded)
+	}
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 1+succeeded)
+	result, err := eventStore.GetLatestSnapshotById(ctx, id)
+	require.Nil(t, err)
+	assert.Equal(t, initial.Version+uint64(succeeded), result.Aggregate().GetVersion())
+}
+
+func (s *suite) testSnapshotRetention(t *testing.T) {
+	if s.keptSnapshotCounter == nil {
+		t.Skip("no KeptSnapshotCounter")
+	}
+	ctx := context.Background()
+
+	eventStore := s.newEventStore(t, pkg.WithKeepSnapshot(true), pkg.WithKeepSnapshotCount(2))
+	id := newAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a", "b", "c")
+	assert.Equal(t, 2, s.keptSnapshotCounter(t, eventStore, id))
+	result, err := eventStore.GetLatestSnapshotById(ctx, id)
+	require.Nil(t, err)
+	assert.Equal(t, "c", result.Aggregate().(*account).Name)
+
+	eventStore = s.newEventStore(t, pkg.WithKeepSnapshot(false))
+	persistRenames(t, ctx, eventStore, id, "a", "b")
+	assert.Equal(t, 0, s.keptSnapshotCounter(t, eventStore, id))
+}
+
+func (s *suite) testErrorTypes(t *testing.T) {
+	if !s.serialized {
+		t.Skip("the store does not serialize")
+	}
+	ctx := context.Background()
+	id := newAccountId("1")
+
+	eventStore := s.newEventStore(t, pkg.WithEventSerializer(&failingEventSerializer{&pkg.DefaultEventSerializer{}}))
+	initial, created := newAccount(id, "created")
+	err := eventStore.PersistEventAndSnapshot(ctx, created, initial)
+	var serializationError *pkg.SerializationError
+	assert.True(t, errors.As(err, &serializationError), "failing serializer: %v", err)
+
+	eventStore = s.factory(t,
+		func(map[string]any) (pkg.Event, error) { return nil, errors.New("unknown event") },
+		func(map[string]any) (pkg.Aggregate, error) { return nil, errors.New("unknown aggregate") })
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, created, initial))
+	var deserializationError *pkg.DeserializationError
+	_, err = eventStore.GetEventsByIdSinceSeqNr(ctx, id, 0)
+	assert.True(t, errors.As(err, &deserializationError), "failing event converter: %v", err)
+	_, err = eventStore.GetLatestSnapshotById(ctx, id)
+	assert.True(t, errors.As(err, &deserializationError), "failing snapshot converter: %v", err)
+}
+
+// failingEventSerializer is an EventSerializer that always fails to serialize.
+type failingEventSerializer struct {
+	*pkg.DefaultEventSerializer
+}
+
+func (*failingEventSerializer) Serialize(pkg.Event) ([]byte, error) {
+	return nil, pkg.NewSerializationError("Failed to serialize the event", errors.New("failing serializer"))
+}
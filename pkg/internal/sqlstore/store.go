@@ -0,0 +1,410 @@
+// Package sqlstore provides the event store shared by the SQL databases, used by pkg/sqlite and pkg/postgres.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+// sqlIdentifierPattern is the pattern of table names accepted by the SQL event stores.
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Store is the EventStore implementation shared by the SQL databases.
+//
+// The statements use $N placeholders, which PostgreSQL and SQLite both accept.
+type Store struct {
+	settings          pkg.EventStoreSettings
+	db                *sql.DB
+	journalTableName  string
+	snapshotTableName string
+	shardCount        uint64
+	eventConverter    pkg.EventConverter
+	snapshotConverter pkg.AggregateConverter
+}
+
+// New validates the parameters and returns a new Store.
+func New(
+	db *sql.DB,
+	journalTableName string,
+	snapshotTableName string,
+	shardCount uint64,
+	eventConverter pkg.EventConverter,
+	snapshotConverter pkg.AggregateConverter,
+	options ...pkg.EventStoreOption,
+) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if !sqlIdentifierPattern.MatchString(journalTableName) {
+		return nil, errors.New("journalTableName is invalid")
+	}
+	if !sqlIdentifierPattern.MatchString(snapshotTableName) {
+		return nil, errors.New("snapshotTableName is invalid")
+	}
+	if shardCount == 0 {
+		return nil, errors.New("shardCount is zero")
+	}
+	settings, err := pkg.NewEventStoreSettings(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		settings:          settings,
+		db:                db,
+		journalTableName:  journalTableName,
+		snapshotTableName: snapshotTableName,
+		shardCount:        shardCount,
+		eventConverter:    eventConverter,
+		snapshotConverter: snapshotConverter,
+	}, nil
+}
+
+func (es *Store) GetLatestSnapshotById(ctx context.Context, aggregateId pkg.AggregateId) (*pkg.AggregateResult, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+
+	query := fmt.Sprintf("SELECT payload, version FROM %s WHERE aid = $1 AND seq_nr = 0", es.snapshotTableName)
+	var payload []byte
+	var version int64
+	err := es.db.QueryRowContext(ctx, query, aggregateId.AsString()).Scan(&payload, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pkg.NewAggregateResult(nil), nil
+	} else if err != nil {
+		return nil, pkg.NewIOError("Failed to GetLatestSnapshotById query", err)
+	}
+
+	var aggregateMap map[string]any
+	if err := es.settings.SnapshotSerializer.Deserialize(payload, &aggregateMap); err != nil {
+		return nil, err
+	}
+
+	aggregate, err := es.snapshotConverter(aggregateMap)
+	if err != nil {
+		return nil, pkg.NewDeserializationError("Failed to convert the snapshot", err)
+	}
+	return pkg.NewAggregateResult(aggregate.WithVersion(uint64(version))), nil
+}
+
+func (es *Store) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId pkg.AggregateId, seqNr uint64) ([]pkg.Event, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+
+	query := fmt.Sprintf("SELECT payload FROM %s WHERE aid = $1 AND seq_nr >= $2 ORDER BY seq_nr", es.journalTableName)
+	rows, err := es.db.QueryContext(ctx, query, aggregateId.AsString(), int64(seqNr))
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to GetEventsByIdSinceSeqNr query", err)
+	}
+	return es.scanEvents(rows)
+}
+
+// GetEventsByIdSinceSeqNrWithLimit returns up to limit events of the aggregate since the specified sequence number.
+func (es *Store) GetEventsByIdSinceSeqNrWithLimit(ctx context.Context, aggregateId pkg.AggregateId, seqNr uint64, limit int) ([]pkg.Event, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+	if limit <= 0 {
+		return nil, errors.New("limit is not positive")
+	}
+
+	query := fmt.Sprintf("SELECT payload FROM %s WHERE aid = $1 AND seq_nr >= $2 ORDER BY seq_nr LIMIT $3", es.journalTableName)
+	rows, err := es.db.QueryContext(ctx, query, aggregateId.AsString(), int64(seqNr), limit)
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to GetEventsByIdSinceSeqNrWithLimit query", err)
+	}
+	return es.scanEvents(rows)
+}
+
+// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name whose occurred at is within [from, to].
+func (es *Store) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]pkg.Event, error) {
+	if to > math.MaxInt64 {
+		to = math.MaxInt64
+	}
+	if from > to {
+		return []pkg.Event{}, nil
+	}
+	query := fmt.Sprintf("SELECT payload FROM %s WHERE type_name = $1 AND occurred_at BETWEEN $2 AND $3 ORDER BY occurred_at", es.journalTableName)
+	rows, err := es.db.QueryContext(ctx, query, typeName, int64(from), int64(to))
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to GetEventsByTypeNameAndOccurredAt query", err)
+	}
+	return es.scanEvents(rows)
+}
+
+func (es *Store) PersistEvent(ctx context.Context, event pkg.Event, version uint64) error {
+	if event.IsCreated() {
+		panic("event is created")
+	}
+	if err := es.updateEventAndSnapshotOpt(ctx, event, version, nil); err != nil {
+		return err
+	}
+	if err := es.tryPurgeExcessSnapshots(ctx, event); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (es *Store) PersistEventAndSnapshot(ctx context.Context, event pkg.Event, aggregate pkg.Aggregate) error {
+	if event.IsCreated() {
+		if err := es.createEventAndSnapshot(ctx, event, aggregate); err != nil {
+			return err
+		}
+	} else {
+		if err := es.updateEventAndSnapshotOpt(ctx, event, aggregate.GetVersion(), aggregate); err != nil {
+			return err
+		}
+		if err := es.tryPurgeExcessSnapshots(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanEvents converts the payload rows to events and closes the rows.
+//
+// # Parameters
+// - rows is the result of a payload query.
+// # Returns
+// - a list of events
+// - an error
+func (es *Store) scanEvents(rows *sql.Rows) ([]pkg.Event, error) {
+	defer rows.Close()
+	events := make([]pkg.Event, 0)
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, pkg.NewIOError("Failed to scan the journal row", err)
+		}
+		var eventMap map[string]any
+		if err := es.settings.EventSerializer.Deserialize(payload, &eventMap); err != nil {
+			return nil, err
+		}
+		event, err := es.eventConverter(eventMap)
+		if err != nil {
+			return nil, pkg.NewDeserializationError("Failed to convert the event", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pkg.NewIOError("Failed to read the journal rows", err)
+	}
+	return events, nil
+}
+
+// insertJournal inserts the event into the journal table.
+//
+// # Parameters
+// - tx is a transaction.
+// - event is an event to store.
+// # Returns
+// - an error, which is an OptimisticLockError if the seqNr of the aggregate already exists
+func (es *Store) insertJournal(ctx context.Context, tx *sql.Tx, event pkg.Event) error {
+	payload, err := es.settings.EventSerializer.Serialize(event)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (pkey, skey, aid, seq_nr, type_name, payload, occurred_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`, es.journalTableName)
+	result, err := tx.ExecContext(ctx, query,
+		es.settings.KeyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount),
+		es.settings.KeyResolver.ResolveSkey(event.GetAggregateId(), event.GetSeqNr()),
+		event.GetAggregateId().AsString(),
+		int64(event.GetSeqNr()),
+		event.GetTypeName(),
+		payload,
+		int64(event.GetOccurredAt()),
+	)
+	return checkAffected(result, err, "Failed to insert the journal row")
+}
+
+// insertSnapshot inserts the aggregate into the snapshot table.
+//
+// # Parameters
+// - tx is a transaction.
+// - event is an event to store.
+// - seqNr is a seqNr of the snapshot row.
+// - aggregate is an aggregate to store.
+// # Returns
+// - an error, which is an OptimisticLockError if the snapshot row already exists
+func (es *Store) insertSnapshot(ctx context.Context, tx *sql.Tx, event pkg.Event, seqNr uint64, aggregate pkg.Aggregate) error {
+	if aggregate == nil {
+		return errors.New("aggregate is nil")
+	}
+	payload, err := es.settings.SnapshotSerializer.Serialize(aggregate)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (pkey, skey, aid, seq_nr, payload, version, ttl)
+VALUES ($1, $2, $3, $4, $5, 1, 0) ON CONFLICT DO NOTHING`, es.snapshotTableName)
+	result, err := tx.ExecContext(ctx, query,
+		es.settings.KeyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount),
+		es.settings.KeyResolver.ResolveSkey(event.GetAggregateId(), seqNr),
+		event.GetAggregateId().AsString(),
+		int64(seqNr),
+		payload,
+	)
+	return checkAffected(result, err, "Failed to insert the snapshot row")
+}
+
+// updateSnapshot increments the version of the latest snapshot, replacing its payload if aggregate is not nil.
+//
+// # Parameters
+// - tx is a transaction.
+// - event is an event to store.
+// - version is the expected version of the aggregate.
+// - aggregate is an aggregate to store, or nil.
+// # Returns
+// - an error, which is an OptimisticLockError if the version does not match
+func (es *Store) updateSnapshot(ctx context.Context, tx *sql.Tx, event pkg.Event, version uint64, aggregate pkg.Aggregate) error {
+	var result sql.Result
+	var err error
+	if aggregate != nil {
+		payload, serializeErr := es.settings.SnapshotSerializer.Serialize(aggregate)
+		if serializeErr != nil {
+			return serializeErr
+		}
+		query := fmt.Sprintf("UPDATE %s SET payload = $1, version = version + 1 WHERE aid = $2 AND seq_nr = 0 AND version = $3", es.snapshotTableName)
+		result, err = tx.ExecContext(ctx, query, payload, event.GetAggregateId().AsString(), int64(version))
+	} else {
+		query := fmt.Sprintf("UPDATE %s SET version = version + 1 WHERE aid = $1 AND seq_nr = 0 AND version = $2", es.snapshotTableName)
+		result, err = tx.ExecContext(ctx, query, event.GetAggregateId().AsString(), int64(version))
+	}
+	return checkAffected(result, err, "Failed to update the snapshot row")
+}
+
+// updateEventAndSnapshotOpt updates the event and the snapshot in a transaction.
+//
+// # Parameters
+// - event is an event to store.
+// - version is a version of the aggregate.
+// - aggregate is an aggregate to store.
+// # Returns
+// - an error
+func (es *Store) updateEventAndSnapshotOpt(ctx context.Context, event pkg.Event, version uint64, aggregate pkg.Aggregate) error {
+	if event == nil {
+		panic("event is nil")
+	}
+	return es.inTransaction(ctx, func(tx *sql.Tx) error {
+		if err := es.updateSnapshot(ctx, tx, event, version, aggregate); err != nil {
+			return err
+		}
+		if err := es.insertJournal(ctx, tx, event); err != nil {
+			return err
+		}
+		if es.settings.KeepSnapshot && aggregate != nil {
+			if err := es.insertSnapshot(ctx, tx, event, aggregate.GetSeqNr(), aggregate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createEventAndSnapshot creates the event and the snapshot in a transaction.
+//
+// # Parameters
+// - event is an event to store.
+// - aggregate is an aggregate to store.
+// # Returns
+// - an error
+func (es *Store) createEventAndSnapshot(ctx context.Context, event pkg.Event, aggregate pkg.Aggregate) error {
+	if event == nil {
+		return errors.New("event is nil")
+	}
+	return es.inTransaction(ctx, func(tx *sql.Tx) error {
+		if err := es.insertSnapshot(ctx, tx, event, 0, aggregate); err != nil {
+			return err
+		}
+		if err := es.insertJournal(ctx, tx, event); err != nil {
+			return err
+		}
+		if es.settings.KeepSnapshot {
+			if err := es.insertSnapshot(ctx, tx, event, aggregate.GetSeqNr(), aggregate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tryPurgeExcessSnapshots tries to purge excess snapshots.
+//
+// When deleteTtl is set, the ttl of excess snapshots is set and expired snapshots are deleted,
+// emulating the TTL of DynamoDB.
+//
+// # Parameters
+// - event is an event to store.
+// # Returns
+// - an error
+func (es *Store) tryPurgeExcessSnapshots(ctx context.Context, event pkg.Event) error {
+	if !es.settings.KeepSnapshot || es.settings.KeepSnapshotCount == 0 {
+		return nil
+	}
+	aid := event.GetAggregateId().AsString()
+	excess := fmt.Sprintf(`aid = $1 AND seq_nr > 0 AND seq_nr NOT IN (
+SELECT seq_nr FROM %s WHERE aid = $1 AND seq_nr > 0 ORDER BY seq_nr DESC LIMIT $2)`, es.snapshotTableName)
+	if es.settings.DeleteTtl < math.MaxInt64 {
+		now := time.Now()
+		query := fmt.Sprintf("UPDATE %s SET ttl = $3 WHERE ttl = 0 AND %s", es.snapshotTableName, excess)
+		if _, err := es.db.ExecContext(ctx, query, aid, int64(es.settings.KeepSnapshotCount), now.Add(es.settings.DeleteTtl).Unix()); err != nil {
+			return pkg.NewIOError("Failed to updateTtlOfExcessSnapshots update", err)
+		}
+		query = fmt.Sprintf("DELETE FROM %s WHERE aid = $1 AND seq_nr > 0 AND ttl > 0 AND ttl <= $2", es.snapshotTableName)
+		if _, err := es.db.ExecContext(ctx, query, aid, now.Unix()); err != nil {
+			return pkg.NewIOError("Failed to deleteExpiredSnapshots delete", err)
+		}
+		return nil
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", es.snapshotTableName, excess)
+	if _, err := es.db.ExecContext(ctx, query, aid, int64(es.settings.KeepSnapshotCount)); err != nil {
+		return pkg.NewIOError("Failed to deleteExcessSnapshots delete", err)
+	}
+	return nil
+}
+
+// inTransaction runs fn in a transaction, committing it if fn succeeds.
+func (es *Store) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := es.db.BeginTx(ctx, nil)
+	if err != nil {
+		return pkg.NewIOError("Failed to begin the transaction", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return pkg.NewIOError("Failed to commit the transaction", err)
+	}
+	return nil
+}
+
+// checkAffected converts the result of a conditional write to an error.
+//
+// # Parameters
+// - result is the result of the statement.
+// - err is the error of the statement.
+// - message is the message of the IOError.
+// # Returns
+// - an OptimisticLockError if no row was affected, an IOError if the statement failed, otherwise nil
+func checkAffected(result sql.Result, err error, message string) error {
+	if err != nil {
+		return pkg.NewIOError(message, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return pkg.NewIOError(message, err)
+	}
+	if affected == 0 {
+		return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+	}
+	return nil
+}
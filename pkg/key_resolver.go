@@ -10,6 +10,14 @@ type KeyResolver interface {
 	ResolveSkey(aggregateId AggregateId, seqNr uint64) string
 }
 
+// SkeyPrefixResolver is the interface of a KeyResolver whose skeys of an aggregate share a prefix.
+//
+// EventStoreOnDynamoDB narrows the consistent reads of events by the prefix, if the KeyResolver implements it.
+type SkeyPrefixResolver interface {
+	// ResolveSkeyPrefix returns the prefix of the skeys of the aggregate.
+	ResolveSkeyPrefix(aggregateId AggregateId) string
+}
+
 type DefaultKeyResolver struct{}
 
 func (kr *DefaultKeyResolver) ResolvePkey(aggregateId AggregateId, shardCount uint64) string {
@@ -30,3 +38,28 @@ func (kr *DefaultKeyResolver) ResolveSkey(aggregateId AggregateId, seqNr uint64)
 	value := aggregateId.GetValue()
 	return fmt.Sprintf("%s-%s-%d", idTypeName, value, seqNr)
 }
+
+func (kr *DefaultKeyResolver) ResolveSkeyPrefix(aggregateId AggregateId) string {
+	idTypeName := aggregateId.GetTypeName()
+	value := aggregateId.GetValue()
+	return fmt.Sprintf("%s-%s-", idTypeName, value)
+}
+
+// SortableKeyResolver is a KeyResolver whose skeys of an aggregate are ordered lexicographically by seqNr.
+//
+// The pkey is that of the DefaultKeyResolver, and the skey is "{type}-{value}-{seqNr}" with
+// the seqNr zero-padded to 20 digits, so EventStoreOnDynamoDB can read the events of an aggregate
+// by an skey range on the journal table. Items written with the DefaultKeyResolver must be migrated
+// with MigrateToSortableSkeys before the resolver is switched.
+type SortableKeyResolver struct {
+	DefaultKeyResolver
+}
+
+func (kr *SortableKeyResolver) ResolveSkey(aggregateId AggregateId, seqNr uint64) string {
+	return kr.ResolveSkeyPrefix(aggregateId) + sortableSeqNr(seqNr)
+}
+
+// sortableSeqNr returns the seqNr zero-padded to the number of digits of math.MaxUint64.
+func sortableSeqNr(seqNr uint64) string {
+	return fmt.Sprintf("%020d", seqNr)
+}
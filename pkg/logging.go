@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// discardHandler is the slog.Handler that discards all records, used when no logger is specified.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// newDiscardLogger returns a logger that logs nothing.
+func newDiscardLogger() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// WithLogger sets the logger of the store.
+//
+// - EventStoreOnDynamoDB logs transaction cancellations with their reasons, the purge of excess snapshots and slow operations.
+// - The default logs nothing.
+//
+// # Parameters
+// - logger is a logger.
+//
+// # Returns
+// - an EventStoreOption.
+func WithLogger(logger *slog.Logger) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithSlowOperationThreshold sets the duration above which an operation is logged as slow.
+//
+// - Specify 0 to disable the logging of slow operations.
+// - The default is 1 second.
+//
+// # Parameters
+// - slowOperationThreshold is the threshold.
+//
+// # Returns
+// - an EventStoreOption.
+func WithSlowOperationThreshold(slowOperationThreshold time.Duration) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if slowOperationThreshold < 0 {
+			return errors.New("slowOperationThreshold is negative")
+		}
+		c.slowOperationThreshold = slowOperationThreshold
+		return nil
+	}
+}
+
+// logIfSlow logs the operation if it took longer than the threshold.
+func (c *eventStoreConfig) logIfSlow(ctx context.Context, operation string, aggregateId AggregateId, duration time.Duration) {
+	if c.slowOperationThreshold == 0 || duration < c.slowOperationThreshold {
+		return
+	}
+	attrs := []slog.Attr{slog.String("operation", operation), slog.Duration("duration", duration)}
+	if aggregateId != nil {
+		attrs = append(attrs, slog.String("aid", aggregateId.AsString()))
+	}
+	c.logger.LogAttrs(ctx, slog.LevelWarn, "slow event store operation", attrs...)
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"errors"
+	"time"
+)
+
+// The kinds of the serialized payloads observed by Metrics.
+const (
+	PayloadKindEvent    = "event"
+	PayloadKindSnapshot = "snapshot"
+)
+
+// The outcomes of the operations observed by Metrics.
+const (
+	OutcomeOk       = "ok"
+	OutcomeConflict = "conflict"
+	OutcomeError    = "error"
+)
+
+// Metrics is the interface for recording the metrics of EventStore.
+//
+// The methods are called concurrently, and must not block.
+type Metrics interface {
+	// ObserveRead records a read of the operation, which is the name of the EventStore method, its outcome and its duration.
+	ObserveRead(operation string, outcome string, duration time.Duration)
+
+	// ObserveAppend records an append of the operation, its outcome and its duration.
+	// A conflict is reported with OutcomeConflict.
+	ObserveAppend(operation string, outcome string, duration time.Duration)
+
+	// AddRetries records the retries of a request to the database, such as Query.
+	AddRetries(request string, retries int)
+
+	// ObservePayloadSize records the size of a serialized payload of the kind.
+	ObservePayloadSize(kind string, size int)
+
+	// ObserveEventsReplayed records the number of events read to replay an aggregate.
+	ObserveEventsReplayed(count int)
+
+	// AddSnapshotsPurged records the number of excess snapshots deleted or set to expire.
+	AddSnapshotsPurged(count int)
+
+	// AddConsumedCapacity records the capacity units consumed by a request to the database on the table.
+	AddConsumedCapacity(request string, tableName string, capacityUnits float64)
+}
+
+// NoopMetrics is the Metrics that records nothing. It is the default of EventStore.
+type NoopMetrics struct{}
+
+func (NoopMetrics) ObserveRead(string, string, time.Duration)   {}
+func (NoopMetrics) ObserveAppend(string, string, time.Duration) {}
+func (NoopMetrics) AddRetries(string, int)                      {}
+func (NoopMetrics) ObservePayloadSize(string, int)              {}
+func (NoopMetrics) ObserveEventsReplayed(int)                   {}
+func (NoopMetrics) AddSnapshotsPurged(int)                      {}
+func (NoopMetrics) AddConsumedCapacity(string, string, float64) {}
+
+// WithMetrics sets the Metrics to record the operations with.
+//
+// - The metrics are recorded by EventStoreOnDynamoDB.
+// - The default is NoopMetrics.
+//
+// # Parameters
+// - metrics is a Metrics.
+//
+// # Returns
+// - an EventStoreOption.
+func WithMetrics(metrics Metrics) EventStoreOption {
+	return func(c *eventStoreConfig) error {
+		if metrics == nil {
+			return errors.New("metrics is nil")
+		}
+		c.metrics = metrics
+		return nil
+	}
+}
+
+// outcomeOf returns the outcome of an operation that returned the error.
+func outcomeOf(err error) string {
+	var optimisticLockError *OptimisticLockError
+	switch {
+	case err == nil:
+		return OutcomeOk
+	case errors.As(err, &optimisticLockError):
+		return OutcomeConflict
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,453 @@
+// Package mongodb provides the event store on MongoDB.
+//
+// It links go.mongodb.org/mongo-driver/v2, so it is a separate package from pkg.
+//
+//	eventStore, err := mongodb.NewEventStore(database, "journal", "snapshot", 1, eventConverter, snapshotConverter)
+//	if err != nil {
+//		return err
+//	}
+//	if err := eventStore.EnsureIndexes(ctx); err != nil {
+//		return err
+//	}
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// mongoWriteConflictCode is the code of the error of a write conflicting with a concurrent transaction.
+const mongoWriteConflictCode = 112
+
+// mongoJournalDocument is a document of the journal collection.
+type mongoJournalDocument struct {
+	Pkey       string `bson:"pkey"`
+	Skey       string `bson:"skey"`
+	Aid        string `bson:"aid"`
+	SeqNr      int64  `bson:"seq_nr"`
+	TypeName   string `bson:"type_name"`
+	Payload    []byte `bson:"payload"`
+	OccurredAt int64  `bson:"occurred_at"`
+}
+
+// mongoSnapshotDocument is a document of the snapshot collection.
+//
+// expire_at is set on excess snapshots when deleteTtl is specified, and the TTL index deletes them.
+type mongoSnapshotDocument struct {
+	Pkey     string     `bson:"pkey"`
+	Skey     string     `bson:"skey"`
+	Aid      string     `bson:"aid"`
+	SeqNr    int64      `bson:"seq_nr"`
+	Payload  []byte     `bson:"payload"`
+	Version  int64      `bson:"version"`
+	ExpireAt *time.Time `bson:"expire_at,omitempty"`
+}
+
+// EventStore is pkg.EventStore for MongoDB.
+//
+// PersistEvent and PersistEventAndSnapshot use multi-document transactions, which require a replica set.
+type EventStore struct {
+	settings               pkg.EventStoreSettings
+	database               *mongo.Database
+	journalCollectionName  string
+	snapshotCollectionName string
+	shardCount             uint64
+	eventConverter         pkg.EventConverter
+	snapshotConverter      pkg.AggregateConverter
+}
+
+// NewEventStore returns a new EventStore.
+//
+// Call EnsureIndexes before the first use of the collections.
+//
+// # Parameters
+// - database is a database of a replica set.
+// - journalCollectionName is a journal collection name.
+// - snapshotCollectionName is a snapshot collection name.
+// - shardCount is a shard count used to resolve pkey.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStore
+// - an error
+func NewEventStore(
+	database *mongo.Database,
+	journalCollectionName string,
+	snapshotCollectionName string,
+	shardCount uint64,
+	eventConverter pkg.EventConverter,
+	snapshotConverter pkg.AggregateConverter,
+	options ...pkg.EventStoreOption,
+) (*EventStore, error) {
+	if database == nil {
+		return nil, errors.New("database is nil")
+	}
+	if journalCollectionName == "" {
+		return nil, errors.New("journalCollectionName is empty")
+	}
+	if snapshotCollectionName == "" {
+		return nil, errors.New("snapshotCollectionName is empty")
+	}
+	if shardCount == 0 {
+		return nil, errors.New("shardCount is zero")
+	}
+	settings, err := pkg.NewEventStoreSettings(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventStore{
+		settings:               settings,
+		database:               database,
+		journalCollectionName:  journalCollectionName,
+		snapshotCollectionName: snapshotCollectionName,
+		shardCount:             shardCount,
+		eventConverter:         eventConverter,
+		snapshotConverter:      snapshotConverter,
+	}, nil
+}
+
+// EnsureIndexes creates the indexes of the collections if they do not exist.
+//
+// - journal: unique (aid, seq_nr) and (type_name, occurred_at)
+// - snapshot: unique (aid, seq_nr) and a TTL index on expire_at
+func (es *EventStore) EnsureIndexes(ctx context.Context) error {
+	_, err := es.journal().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "aid", Value: 1}, {Key: "seq_nr", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "type_name", Value: 1}, {Key: "occurred_at", Value: 1}}},
+	})
+	if err != nil {
+		return pkg.NewIOError("Failed to create the journal indexes", err)
+	}
+	_, err = es.snapshot().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "aid", Value: 1}, {Key: "seq_nr", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expire_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return pkg.NewIOError("Failed to create the snapshot indexes", err)
+	}
+	return nil
+}
+
+func (es *EventStore) GetLatestSnapshotById(ctx context.Context, aggregateId pkg.AggregateId) (*pkg.AggregateResult, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+
+	var document mongoSnapshotDocument
+	err := es.snapshot().FindOne(ctx, bson.D{{Key: "aid", Value: aggregateId.AsString()}, {Key: "seq_nr", Value: 0}}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return pkg.NewAggregateResult(nil), nil
+	} else if err != nil {
+		return nil, pkg.NewIOError("Failed to GetLatestSnapshotById find", err)
+	}
+
+	var aggregateMap map[string]any
+	if err := es.settings.SnapshotSerializer.Deserialize(document.Payload, &aggregateMap); err != nil {
+		return nil, err
+	}
+	aggregate, err := es.snapshotConverter(aggregateMap)
+	if err != nil {
+		return nil, pkg.NewDeserializationError("Failed to convert the snapshot", err)
+	}
+	return pkg.NewAggregateResult(aggregate.WithVersion(uint64(document.Version))), nil
+}
+
+func (es *EventStore) GetEventsByIdSinceSeqNr(ctx context.Context, aggregateId pkg.AggregateId, seqNr uint64) ([]pkg.Event, error) {
+	if aggregateId == nil {
+		panic("aggregateId is nil")
+	}
+
+	filter := bson.D{{Key: "aid", Value: aggregateId.AsString()}, {Key: "seq_nr", Value: bson.D{{Key: "$gte", Value: int64(seqNr)}}}}
+	cursor, err := es.journal().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "seq_nr", Value: 1}}))
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to GetEventsByIdSinceSeqNr find", err)
+	}
+	return es.decodeEvents(ctx, cursor)
+}
+
+// GetEventsByTypeNameAndOccurredAt returns the events of the specified type name whose occurred at is within [from, to].
+func (es *EventStore) GetEventsByTypeNameAndOccurredAt(ctx context.Context, typeName string, from uint64, to uint64) ([]pkg.Event, error) {
+	if to > math.MaxInt64 {
+		to = math.MaxInt64
+	}
+	if from > to {
+		return []pkg.Event{}, nil
+	}
+	filter := bson.D{
+		{Key: "type_name", Value: typeName},
+		{Key: "occurred_at", Value: bson.D{{Key: "$gte", Value: int64(from)}, {Key: "$lte", Value: int64(to)}}},
+	}
+	cursor, err := es.journal().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "occurred_at", Value: 1}}))
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to GetEventsByTypeNameAndOccurredAt find", err)
+	}
+	return es.decodeEvents(ctx, cursor)
+}
+
+func (es *EventStore) PersistEvent(ctx context.Context, event pkg.Event, version uint64) error {
+	if event.IsCreated() {
+		panic("event is created")
+	}
+	if err := es.updateEventAndSnapshotOpt(ctx, event, version, nil); err != nil {
+		return err
+	}
+	if err := es.tryPurgeExcessSnapshots(ctx, event); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (es *EventStore) PersistEventAndSnapshot(ctx context.Context, event pkg.Event, aggregate pkg.Aggregate) error {
+	if event.IsCreated() {
+		if err := es.createEventAndSnapshot(ctx, event, aggregate); err != nil {
+			return err
+		}
+	} else {
+		if err := es.updateEventAndSnapshotOpt(ctx, event, aggregate.GetVersion(), aggregate); err != nil {
+			return err
+		}
+		if err := es.tryPurgeExcessSnapshots(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (es *EventStore) journal() *mongo.Collection {
+	return es.database.Collection(es.journalCollectionName)
+}
+
+func (es *EventStore) snapshot() *mongo.Collection {
+	return es.database.Collection(es.snapshotCollectionName)
+}
+
+// decodeEvents converts the journal documents to events and closes the cursor.
+func (es *EventStore) decodeEvents(ctx context.Context, cursor *mongo.Cursor) ([]pkg.Event, error) {
+	defer cursor.Close(ctx)
+	events := make([]pkg.Event, 0)
+	for cursor.Next(ctx) {
+		var document mongoJournalDocument
+		if err := cursor.Decode(&document); err != nil {
+			return nil, pkg.NewDeserializationError("Failed to decode the journal document", err)
+		}
+		var eventMap map[string]any
+		if err := es.settings.EventSerializer.Deserialize(document.Payload, &eventMap); err != nil {
+			return nil, err
+		}
+		event, err := es.eventConverter(eventMap)
+		if err != nil {
+			return nil, pkg.NewDeserializationError("Failed to convert the event", err)
+		}
+		events = append(events, event)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, pkg.NewIOError("Failed to read the journal documents", err)
+	}
+	return events, nil
+}
+
+// insertJournal inserts the event into the journal collection.
+//
+// # Returns
+// - an error, which is an OptimisticLockError if the seqNr of the aggregate already exists
+func (es *EventStore) insertJournal(ctx context.Context, event pkg.Event) error {
+	payload, err := es.settings.EventSerializer.Serialize(event)
+	if err != nil {
+		return err
+	}
+	_, err = es.journal().InsertOne(ctx, mongoJournalDocument{
+		Pkey:       es.settings.KeyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount),
+		Skey:       es.settings.KeyResolver.ResolveSkey(event.GetAggregateId(), event.GetSeqNr()),
+		Aid:        event.GetAggregateId().AsString(),
+		SeqNr:      int64(event.GetSeqNr()),
+		TypeName:   event.GetTypeName(),
+		Payload:    payload,
+		OccurredAt: int64(event.GetOccurredAt()),
+	})
+	return toMongoWriteError("Failed to insert the journal document", err)
+}
+
+// insertSnapshot inserts the aggregate into the snapshot collection with version 1.
+//
+// # Returns
+// - an error, which is an OptimisticLockError if the snapshot document already exists
+func (es *EventStore) insertSnapshot(ctx context.Context, event pkg.Event, seqNr uint64, aggregate pkg.Aggregate) error {
+	if aggregate == nil {
+		return errors.New("aggregate is nil")
+	}
+	payload, err := es.settings.SnapshotSerializer.Serialize(aggregate)
+	if err != nil {
+		return err
+	}
+	_, err = es.snapshot().InsertOne(ctx, mongoSnapshotDocument{
+		Pkey:    es.settings.KeyResolver.ResolvePkey(event.GetAggregateId(), es.shardCount),
+		Skey:    es.settings.KeyResolver.ResolveSkey(event.GetAggregateId(), seqNr),
+		Aid:     event.GetAggregateId().AsString(),
+		SeqNr:   int64(seqNr),
+		Payload: payload,
+		Version: 1,
+	})
+	return toMongoWriteError("Failed to insert the snapshot document", err)
+}
+
+// updateSnapshot increments the version of the latest snapshot, replacing its payload if aggregate is not nil.
+//
+// # Returns
+// - an error, which is an OptimisticLockError if the version does not match
+func (es *EventStore) updateSnapshot(ctx context.Context, event pkg.Event, version uint64, aggregate pkg.Aggregate) error {
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}}
+	if aggregate != nil {
+		payload, err := es.settings.SnapshotSerializer.Serialize(aggregate)
+		if err != nil {
+			return err
+		}
+		update = append(update, bson.E{Key: "$set", Value: bson.D{{Key: "payload", Value: payload}}})
+	}
+	filter := bson.D{
+		{Key: "aid", Value: event.GetAggregateId().AsString()},
+		{Key: "seq_nr", Value: 0},
+		{Key: "version", Value: int64(version)},
+	}
+	result, err := es.snapshot().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return toMongoWriteError("Failed to update the snapshot document", err)
+	}
+	if result.MatchedCount == 0 {
+		return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", nil)
+	}
+	return nil
+}
+
+// updateEventAndSnapshotOpt updates the event and the snapshot in a transaction.
+func (es *EventStore) updateEventAndSnapshotOpt(ctx context.Context, event pkg.Event, version uint64, aggregate pkg.Aggregate) error {
+	if event == nil {
+		panic("event is nil")
+	}
+	return es.inTransaction(ctx, func(ctx context.Context) error {
+		if err := es.updateSnapshot(ctx, event, version, aggregate); err != nil {
+			return err
+		}
+		if err := es.insertJournal(ctx, event); err != nil {
+			return err
+		}
+		if es.settings.KeepSnapshot && aggregate != nil {
+			if err := es.insertSnapshot(ctx, event, aggregate.GetSeqNr(), aggregate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createEventAndSnapshot creates the event and the snapshot in a transaction.
+func (es *EventStore) createEventAndSnapshot(ctx context.Context, event pkg.Event, aggregate pkg.Aggregate) error {
+	if event == nil {
+		return errors.New("event is nil")
+	}
+	return es.inTransaction(ctx, func(ctx context.Context) error {
+		if err := es.insertSnapshot(ctx, event, 0, aggregate); err != nil {
+			return err
+		}
+		if err := es.insertJournal(ctx, event); err != nil {
+			return err
+		}
+		if es.settings.KeepSnapshot {
+			if err := es.insertSnapshot(ctx, event, aggregate.GetSeqNr(), aggregate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tryPurgeExcessSnapshots tries to purge excess snapshots.
+//
+// When deleteTtl is set, expire_at is set on excess snapshots and the TTL index deletes them.
+func (es *EventStore) tryPurgeExcessSnapshots(ctx context.Context, event pkg.Event) error {
+	if !es.settings.KeepSnapshot || es.settings.KeepSnapshotCount == 0 {
+		return nil
+	}
+	aid := event.GetAggregateId().AsString()
+	filter := bson.D{{Key: "aid", Value: aid}, {Key: "seq_nr", Value: bson.D{{Key: "$gt", Value: 0}}}}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "seq_nr", Value: -1}}).
+		SetSkip(int64(es.settings.KeepSnapshotCount)).
+		SetProjection(bson.D{{Key: "seq_nr", Value: 1}})
+	cursor, err := es.snapshot().Find(ctx, filter, findOptions)
+	if err != nil {
+		return pkg.NewIOError("Failed to getSnapshotCount find", err)
+	}
+	var excess []mongoSnapshotDocument
+	if err := cursor.All(ctx, &excess); err != nil {
+		return pkg.NewIOError("Failed to getSnapshotCount find", err)
+	}
+	if len(excess) == 0 {
+		return nil
+	}
+	seqNrs := make(bson.A, 0, len(excess))
+	for _, document := range excess {
+		seqNrs = append(seqNrs, document.SeqNr)
+	}
+	excessFilter := bson.D{{Key: "aid", Value: aid}, {Key: "seq_nr", Value: bson.D{{Key: "$in", Value: seqNrs}}}}
+
+	if es.settings.DeleteTtl < math.MaxInt64 {
+		excessFilter = append(excessFilter, bson.E{Key: "expire_at", Value: bson.D{{Key: "$exists", Value: false}}})
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "expire_at", Value: time.Now().Add(es.settings.DeleteTtl)}}}}
+		if _, err := es.snapshot().UpdateMany(ctx, excessFilter, update); err != nil {
+			return pkg.NewIOError("Failed to updateTtlOfExcessSnapshots update", err)
+		}
+		return nil
+	}
+	if _, err := es.snapshot().DeleteMany(ctx, excessFilter); err != nil {
+		return pkg.NewIOError("Failed to deleteExcessSnapshots delete", err)
+	}
+	return nil
+}
+
+// inTransaction runs fn in a transaction, committing it if fn succeeds.
+//
+// fn may be retried on transient transaction errors. A write conflict with a concurrent transaction
+// is an OptimisticLockError.
+func (es *EventStore) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := es.database.Client().StartSession()
+	if err != nil {
+		return pkg.NewIOError("Failed to start the session", err)
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	if isMongoWriteConflict(err) {
+		return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", err)
+	}
+	return pkg.WrapIOError("Failed to commit the transaction", err)
+}
+
+// toMongoWriteError converts the error of a write, mapping a duplicate key and a write conflict
+// with a concurrent transaction to an OptimisticLockError.
+func toMongoWriteError(message string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongo.IsDuplicateKeyError(err) || isMongoWriteConflict(err) {
+		return pkg.NewOptimisticLockError("Transaction write was canceled due to conditional check failure", err)
+	}
+	return pkg.NewIOError(message, err)
+}
+
+// isMongoWriteConflict reports whether the error is a write conflict with a concurrent transaction.
+func isMongoWriteConflict(err error) bool {
+	var serverError mongo.ServerError
+	return errors.As(err, &serverError) && serverError.HasErrorCode(mongoWriteConflictCode)
+}
@@ -0,0 +1,435 @@
+package pkg
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// OutboxStatusPending is the status of an outbox item waiting to be published.
+	OutboxStatusPending = "PENDING"
+	// OutboxStatusDelivered is the status of an outbox item that has been published.
+	OutboxStatusDelivered = "DELIVERED"
+	// OutboxStatusDeadLetter is the status of an outbox item that exhausted its attempts.
+	OutboxStatusDeadLetter = "DEAD_LETTER"
+)
+
+// OutboxMessage is an event read from the outbox table.
+type OutboxMessage struct {
+	// Id is the id of the event.
+	Id string
+	// Aid is the aggregate id of the event.
+	Aid string
+	// SeqNr is the sequence number of the event.
+	SeqNr uint64
+	// TypeName is the type name of the event.
+	TypeName string
+	// Payload is the serialized event.
+	Payload []byte
+	// OccurredAt is the occurred at of the event.
+	OccurredAt uint64
+	// Attempts is the number of failed attempts to publish the event.
+	Attempts uint32
+}
+
+// OutboxPublisher is the interface for publishing outbox messages to an external broker.
+type OutboxPublisher interface {
+	// Publish publishes the message.
+	Publish(ctx context.Context, message OutboxMessage) error
+}
+
+// maxOutboxRetryBackoff is the upper limit of the doubled retry delay.
+const maxOutboxRetryBackoff = time.Hour
+
+// OutboxRelay publishes the pending items of the outbox table and marks them delivered.
+//
+// A message is published at least once. A failed message is retried with exponential backoff
+// and moved to the dead letter status after the maximum number of attempts.
+// The messages of an aggregate are published in the order of seq_nr: a message is held while
+// a message of the same aggregate with a smaller seq_nr is pending. A dead-lettered message
+// no longer holds the later ones.
+type OutboxRelay struct {
+	client            *dynamodb.Client
+	outboxTableName   string
+	statusIndexName   string
+	publisher         OutboxPublisher
+	maxAttempts       uint32
+	batchSize         int32
+	retryBackoff      time.Duration
+	pollInterval      time.Duration
+	deadLetterHandler func(ctx context.Context, message OutboxMessage, err error)
+}
+
+// OutboxRelayOption is an option for OutboxRelay.
+type OutboxRelayOption func(*OutboxRelay) error
+
+// WithOutboxMaxAttempts sets the maximum number of attempts before dead-lettering.
+//
+// - The default is 5.
+func WithOutboxMaxAttempts(maxAttempts uint32) OutboxRelayOption {
+	return func(r *OutboxRelay) error {
+		if maxAttempts == 0 {
+			return errors.New("maxAttempts is zero")
+		}
+		r.maxAttempts = maxAttempts
+		return nil
+	}
+}
+
+// WithOutboxBatchSize sets the maximum number of messages published by a poll.
+//
+// - The default is 25.
+func WithOutboxBatchSize(batchSize int32) OutboxRelayOption {
+	return func(r *OutboxRelay) error {
+		if batchSize <= 0 {
+			return errors.New("batchSize is not positive")
+		}
+		r.batchSize = batchSize
+		return nil
+	}
+}
+
+// WithOutboxRetryBackoff sets the base delay before a failed message is retried.
+//
+// - The delay doubles with each attempt, up to 1 hour or the base delay if it is longer.
+// - The default is 1 second.
+func WithOutboxRetryBackoff(retryBackoff time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) error {
+		if retryBackoff < 0 {
+			return errors.New("retryBackoff is negative")
+		}
+		r.retryBackoff = retryBackoff
+		return nil
+	}
+}
+
+// WithOutboxPollInterval sets the interval between polls in Run.
+//
+// - The default is 1 second.
+func WithOutboxPollInterval(pollInterval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) error {
+		if pollInterval <= 0 {
+			return errors.New("pollInterval is not positive")
+		}
+		r.pollInterval = pollInterval
+		return nil
+	}
+}
+
+// WithOutboxDeadLetterHandler sets the handler called when a message is dead-lettered.
+//
+// - The default does nothing.
+func WithOutboxDeadLetterHandler(deadLetterHandler func(ctx context.Context, message OutboxMessage, err error)) OutboxRelayOption {
+	return func(r *OutboxRelay) error {
+		if deadLetterHandler == nil {
+			return errors.New("deadLetterHandler is nil")
+		}
+		r.deadLetterHandler = deadLetterHandler
+		return nil
+	}
+}
+
+// NewOutboxRelay returns a new OutboxRelay.
+//
+// # Parameters
+// - client is a DynamoDB client.
+// - outboxTableName is an outbox table name.
+// - statusIndexName is the name of the outbox index keyed by status and next_attempt_at.
+// - publisher is an outbox publisher.
+// - options is an OutboxRelayOption.
+//
+// # Returns
+// - an OutboxRelay
+// - an error
+func NewOutboxRelay(
+	client *dynamodb.Client,
+	outboxTableName string,
+	statusIndexName string,
+	publisher OutboxPublisher,
+	options ...OutboxRelayOption,
+) (*OutboxRelay, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if outboxTableName == "" {
+		return nil, errors.New("outboxTableName is empty")
+	}
+	if statusIndexName == "" {
+		return nil, errors.New("statusIndexName is empty")
+	}
+	if publisher == nil {
+		return nil, errors.New("publisher is nil")
+	}
+	r := &OutboxRelay{
+		client:            client,
+		outboxTableName:   outboxTableName,
+		statusIndexName:   statusIndexName,
+		publisher:         publisher,
+		maxAttempts:       5,
+		batchSize:         25,
+		retryBackoff:      time.Second,
+		pollInterval:      time.Second,
+		deadLetterHandler: func(context.Context, OutboxMessage, error) {},
+	}
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Run polls the outbox until the context is canceled.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := r.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			if err != nil && !errors.Is(err, ctx.Err()) {
+				return err
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll publishes the pending messages that are due, and returns the number of delivered messages.
+//
+// Publisher failures are recorded on the items and do not make Poll fail.
+// After a message fails, the later messages of the same aggregate are held until it is delivered.
+func (r *OutboxRelay) Poll(ctx context.Context) (int, error) {
+	messages, err := r.getPendingMessages(ctx)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	failedAids := make(map[string]bool)
+	for _, message := range messages {
+		if failedAids[message.Aid] {
+			continue
+		}
+		if publishErr := r.publisher.Publish(ctx, message); publishErr != nil {
+			failedAids[message.Aid] = true
+			if err := r.markFailed(ctx, message, publishErr); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := r.markDelivered(ctx, message); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// getPendingMessages returns the pending messages that are due and not held by an earlier message.
+//
+// All pending items are read, because a message that is waiting for a retry holds
+// the later messages of its aggregate. For each aggregate, the messages are returned
+// in the order of seq_nr up to the first one that is not due.
+//
+// # Returns
+// - a list of messages
+// - an error
+func (r *OutboxRelay) getPendingMessages(ctx context.Context) ([]OutboxMessage, error) {
+	request := &dynamodb.QueryInput{
+		TableName:              aws.String(r.outboxTableName),
+		IndexName:              aws.String(r.statusIndexName),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: OutboxStatusPending},
+		},
+	}
+	now := time.Now().UnixMilli()
+	var aids []string
+	messagesByAid := make(map[string][]OutboxMessage)
+	dueIds := make(map[string]bool)
+	for {
+		response, err := r.client.Query(ctx, request)
+		if err != nil {
+			return nil, NewIOError("Failed to getPendingMessages query", err)
+		}
+		for _, item := range response.Items {
+			message, err := convertOutboxItem(item)
+			if err != nil {
+				return nil, err
+			}
+			nextAttemptAt, err := strconv.ParseInt(item["next_attempt_at"].(*types.AttributeValueMemberN).Value, 10, 64)
+			if err != nil {
+				return nil, NewDeserializationError("Failed to parse the next_attempt_at", err)
+			}
+			if nextAttemptAt <= now {
+				dueIds[message.Id] = true
+			}
+			if _, ok := messagesByAid[message.Aid]; !ok {
+				aids = append(aids, message.Aid)
+			}
+			messagesByAid[message.Aid] = append(messagesByAid[message.Aid], message)
+		}
+		if response.LastEvaluatedKey == nil {
+			break
+		}
+		request.ExclusiveStartKey = response.LastEvaluatedKey
+	}
+
+	messages := make([]OutboxMessage, 0, r.batchSize)
+	for _, aid := range aids {
+		pending := messagesByAid[aid]
+		slices.SortFunc(pending, func(a, b OutboxMessage) int {
+			return cmp.Compare(a.SeqNr, b.SeqNr)
+		})
+		for _, message := range pending {
+			if !dueIds[message.Id] || len(messages) == int(r.batchSize) {
+				break
+			}
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// markDelivered marks the message delivered.
+//
+// # Parameters
+// - message is a delivered message.
+// # Returns
+// - an error
+func (r *OutboxRelay) markDelivered(ctx context.Context, message OutboxMessage) error {
+	request := &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.outboxTableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: message.Id},
+		},
+		UpdateExpression:    aws.String("SET #status=:delivered, #delivered_at=:now REMOVE #next_attempt_at"),
+		ConditionExpression: aws.String("#status=:pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#status":          "status",
+			"#delivered_at":    "delivered_at",
+			"#next_attempt_at": "next_attempt_at",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delivered": &types.AttributeValueMemberS{Value: OutboxStatusDelivered},
+			":pending":   &types.AttributeValueMemberS{Value: OutboxStatusPending},
+			":now":       &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixMilli(), 10)},
+		},
+	}
+	if _, err := r.client.UpdateItem(ctx, request); err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			// Another relay has already settled the message.
+			return nil
+		}
+		return NewIOError("Failed to markDelivered updateItem", err)
+	}
+	return nil
+}
+
+// markFailed records a failed attempt, and dead-letters the message when the attempts are exhausted.
+//
+// # Parameters
+// - message is a failed message.
+// - cause is the error of the publisher.
+// # Returns
+// - an error
+func (r *OutboxRelay) markFailed(ctx context.Context, message OutboxMessage, cause error) error {
+	attempts := message.Attempts + 1
+	request := &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.outboxTableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: message.Id},
+		},
+		ConditionExpression: aws.String("#status=:pending AND #attempts=:before_attempts"),
+		ExpressionAttributeNames: map[string]string{
+			"#status":     "status",
+			"#attempts":   "attempts",
+			"#last_error": "last_error",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending":         &types.AttributeValueMemberS{Value: OutboxStatusPending},
+			":before_attempts": &types.AttributeValueMemberN{Value: strconv.FormatUint(uint64(message.Attempts), 10)},
+			":after_attempts":  &types.AttributeValueMemberN{Value: strconv.FormatUint(uint64(attempts), 10)},
+			":last_error":      &types.AttributeValueMemberS{Value: cause.Error()},
+		},
+	}
+	deadLetter := attempts >= r.maxAttempts
+	request.ExpressionAttributeNames["#next_attempt_at"] = "next_attempt_at"
+	if deadLetter {
+		request.UpdateExpression = aws.String("SET #status=:dead_letter, #attempts=:after_attempts, #last_error=:last_error REMOVE #next_attempt_at")
+		request.ExpressionAttributeValues[":dead_letter"] = &types.AttributeValueMemberS{Value: OutboxStatusDeadLetter}
+	} else {
+		nextAttemptAt := time.Now().Add(r.retryDelay(attempts)).UnixMilli()
+		request.UpdateExpression = aws.String("SET #attempts=:after_attempts, #last_error=:last_error, #next_attempt_at=:next_attempt_at")
+		request.ExpressionAttributeValues[":next_attempt_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(nextAttemptAt, 10)}
+	}
+	if _, err := r.client.UpdateItem(ctx, request); err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			// Another relay has already recorded this attempt.
+			return nil
+		}
+		return NewIOError("Failed to markFailed updateItem", err)
+	}
+	if deadLetter {
+		message.Attempts = attempts
+		r.deadLetterHandler(ctx, message, cause)
+	}
+	return nil
+}
+
+// retryDelay returns the delay before the next attempt of a message that failed the attempts.
+//
+// The base delay doubles with each attempt, up to maxOutboxRetryBackoff or the base delay if it is longer.
+func (r *OutboxRelay) retryDelay(attempts uint32) time.Duration {
+	delay := r.retryBackoff
+	for i := uint32(1); i < attempts && delay < maxOutboxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return max(min(delay, maxOutboxRetryBackoff), r.retryBackoff)
+}
+
+// convertOutboxItem converts an outbox item to an OutboxMessage.
+//
+// # Parameters
+// - item is an outbox item.
+// # Returns
+// - an OutboxMessage
+// - an error
+func convertOutboxItem(item map[string]types.AttributeValue) (OutboxMessage, error) {
+	seqNr, err := strconv.ParseUint(item["seq_nr"].(*types.AttributeValueMemberN).Value, 10, 64)
+	if err != nil {
+		return OutboxMessage{}, NewDeserializationError("Failed to parse the seq_nr", err)
+	}
+	occurredAt, err := strconv.ParseUint(item["occurred_at"].(*types.AttributeValueMemberN).Value, 10, 64)
+	if err != nil {
+		return OutboxMessage{}, NewDeserializationError("Failed to parse the occurred_at", err)
+	}
+	attempts, err := strconv.ParseUint(item["attempts"].(*types.AttributeValueMemberN).Value, 10, 32)
+	if err != nil {
+		return OutboxMessage{}, NewDeserializationError("Failed to parse the attempts", err)
+	}
+	return OutboxMessage{
+		Id:         item["id"].(*types.AttributeValueMemberS).Value,
+		Aid:        item["aid"].(*types.AttributeValueMemberS).Value,
+		SeqNr:      seqNr,
+		TypeName:   item["type_name"].(*types.AttributeValueMemberS).Value,
+		Payload:    item["payload"].(*types.AttributeValueMemberB).Value,
+		OccurredAt: occurredAt,
+		Attempts:   uint32(attempts),
+	}, nil
+}
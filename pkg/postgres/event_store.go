@@ -0,0 +1,120 @@
+// Package postgres provides the event store on PostgreSQL.
+//
+// The database handle is opened by the application with a PostgreSQL driver, such as pgx.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/internal/sqlstore"
+)
+
+// EventStore is pkg.EventStore for PostgreSQL.
+//
+// The journal and snapshot tables mirror the DynamoDB schema; see docs/DATABASE_SCHEMA.md.
+type EventStore struct {
+	*sqlstore.Store
+}
+
+// NewEventStore returns a new EventStore.
+//
+// # Parameters
+// - db is a database handle opened with a PostgreSQL driver.
+// - journalTableName is a journal table name.
+// - snapshotTableName is a snapshot table name.
+// - shardCount is a shard count used to resolve pkey.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStore
+// - an error
+func NewEventStore(
+	db *sql.DB,
+	journalTableName string,
+	snapshotTableName string,
+	shardCount uint64,
+	eventConverter pkg.EventConverter,
+	snapshotConverter pkg.AggregateConverter,
+	options ...pkg.EventStoreOption,
+) (pkg.EventStore, error) {
+	store, err := sqlstore.New(db, journalTableName, snapshotTableName, shardCount, eventConverter, snapshotConverter, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventStore{store}, nil
+}
+
+// Migrate creates the journal and snapshot tables of EventStore and their indexes if they do not exist.
+//
+// The statements are applied in a transaction, and applying them again is a no-op.
+//
+// # Parameters
+// - db is a database handle opened with a PostgreSQL driver.
+// - journalTableName is a journal table name.
+// - snapshotTableName is a snapshot table name.
+//
+// # Returns
+// - an error
+func Migrate(ctx context.Context, db *sql.DB, journalTableName string, snapshotTableName string) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if journalTableName == "" {
+		return errors.New("journalTableName is empty")
+	}
+	if snapshotTableName == "" {
+		return errors.New("snapshotTableName is empty")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return pkg.NewIOError("Failed to Migrate begin", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, statement := range migrationStatements(journalTableName, snapshotTableName) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return pkg.NewIOError("Failed to Migrate exec", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return pkg.NewIOError("Failed to Migrate commit", err)
+	}
+	return nil
+}
+
+// migrationStatements returns the DDL statements of the journal and snapshot tables.
+func migrationStatements(journalTableName string, snapshotTableName string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	pkey        TEXT   NOT NULL,
+	skey        TEXT   NOT NULL,
+	aid         TEXT   NOT NULL,
+	seq_nr      BIGINT NOT NULL,
+	type_name   TEXT   NOT NULL,
+	payload     BYTEA  NOT NULL,
+	occurred_at BIGINT NOT NULL,
+	PRIMARY KEY (pkey, skey),
+	UNIQUE (aid, seq_nr)
+)`, journalTableName),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_type_name_idx ON %s (type_name, occurred_at)", journalTableName, journalTableName),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	pkey    TEXT   NOT NULL,
+	skey    TEXT   NOT NULL,
+	aid     TEXT   NOT NULL,
+	seq_nr  BIGINT NOT NULL,
+	payload BYTEA  NOT NULL,
+	version BIGINT NOT NULL,
+	ttl     BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (pkey, skey),
+	UNIQUE (aid, seq_nr)
+)`, snapshotTableName),
+	}
+}
@@ -0,0 +1,416 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Projection is the interface for a read model built from events.
+type Projection interface {
+	// GetName returns the name of the projection, used as the id of its checkpoint.
+	GetName() string
+	// Handle applies the event to the read model.
+	Handle(ctx context.Context, event Event) error
+}
+
+// ResettableProjection is a Projection that can discard its read model before a rebuild.
+type ResettableProjection interface {
+	Projection
+	// Reset discards the read model.
+	Reset(ctx context.Context) error
+}
+
+// EventFeed is the interface for reading events in a stable order to catch up a projection.
+//
+// Checkpoints produced by a feed must be unique to each event and sort lexicographically
+// in the order of the feed.
+type EventFeed interface {
+	// ReadEvents returns up to limit events after the checkpoint.
+	//
+	// If checkpoint is empty, the events are read from the beginning.
+	ReadEvents(ctx context.Context, checkpoint string, limit int) ([]Event, error)
+	// CheckpointOf returns the checkpoint of the event.
+	CheckpointOf(event Event) string
+	// Contains returns true if the event belongs to the feed.
+	Contains(event Event) bool
+}
+
+// LiveEventSource is the interface for receiving events as they are persisted.
+type LiveEventSource interface {
+	// Subscribe registers the handler and returns a function that unregisters it.
+	Subscribe(handler func(ctx context.Context, event Event) error) (func(), error)
+}
+
+// feedCheckpointWidth is the width of a number formatted by formatFeedCheckpoint.
+const feedCheckpointWidth = 20
+
+// formatFeedCheckpoint formats a number as a lexicographically sortable checkpoint.
+func formatFeedCheckpoint(value uint64) string {
+	return fmt.Sprintf("%0*d", feedCheckpointWidth, value)
+}
+
+// parseFeedCheckpoint parses a checkpoint formatted by formatFeedCheckpoint.
+//
+// # Returns
+// - the number, and whether the checkpoint is present
+// - an error
+func parseFeedCheckpoint(checkpoint string) (uint64, bool, error) {
+	if checkpoint == "" {
+		return 0, false, nil
+	}
+	value, err := strconv.ParseUint(checkpoint, 10, 64)
+	if err != nil {
+		return 0, false, NewDeserializationError("Failed to parse the checkpoint", err)
+	}
+	return value, true, nil
+}
+
+// AggregateEventFeed is the EventFeed of the events of a single aggregate, ordered by seqNr.
+type AggregateEventFeed struct {
+	eventStore  EventStore
+	aggregateId AggregateId
+}
+
+// NewAggregateEventFeed returns the EventFeed of the events of the aggregate.
+func NewAggregateEventFeed(eventStore EventStore, aggregateId AggregateId) *AggregateEventFeed {
+	return &AggregateEventFeed{eventStore: eventStore, aggregateId: aggregateId}
+}
+
+// ReadEvents returns up to limit events after the checkpoint.
+//
+// The limit is applied in the query if the EventStore is a LimitedEventReader,
+// and to all the events since the checkpoint otherwise.
+func (f *AggregateEventFeed) ReadEvents(ctx context.Context, checkpoint string, limit int) ([]Event, error) {
+	seqNr, ok, err := parseFeedCheckpoint(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		seqNr++
+	}
+	return getEventsByIdSinceSeqNrWithLimit(ctx, f.eventStore, f.aggregateId, seqNr, limit)
+}
+
+func (f *AggregateEventFeed) CheckpointOf(event Event) string {
+	return formatFeedCheckpoint(event.GetSeqNr())
+}
+
+func (f *AggregateEventFeed) Contains(event Event) bool {
+	return event.GetAggregateId().AsString() == f.aggregateId.AsString()
+}
+
+// EventTypeFeed is the EventFeed of the events of the type names across aggregates,
+// ordered by occurred at, aggregate id and seqNr.
+//
+// The checkpoint of an event is its occurred at, aggregate id and seqNr, so the events
+// sharing an occurred at are ordered and resumed from one by one.
+type EventTypeFeed struct {
+	reader    EventTypeReader
+	typeNames []string
+}
+
+// NewEventTypeFeed returns the EventFeed of the events of the type names.
+func NewEventTypeFeed(reader EventTypeReader, typeNames ...string) *EventTypeFeed {
+	return &EventTypeFeed{reader: reader, typeNames: typeNames}
+}
+
+// ReadEvents returns up to limit events after the checkpoint.
+func (f *EventTypeFeed) ReadEvents(ctx context.Context, checkpoint string, limit int) ([]Event, error) {
+	var from uint64
+	if checkpoint != "" {
+		occurredAt, _, err := parseFeedCheckpoint(checkpoint[:min(len(checkpoint), feedCheckpointWidth)])
+		if err != nil {
+			return nil, err
+		}
+		from = occurredAt
+	}
+	var result []Event
+	for _, typeName := range f.typeNames {
+		events, err := f.reader.GetEventsByTypeNameAndOccurredAt(ctx, typeName, from, math.MaxUint64)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			// The events at the occurred at of the checkpoint are read again, and those up to it are skipped.
+			if f.CheckpointOf(event) > checkpoint {
+				result = append(result, event)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return f.CheckpointOf(result[i]) < f.CheckpointOf(result[j])
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (f *EventTypeFeed) CheckpointOf(event Event) string {
+	return formatFeedCheckpoint(event.GetOccurredAt()) + "/" + event.GetAggregateId().AsString() + "/" + formatFeedCheckpoint(event.GetSeqNr())
+}
+
+func (f *EventTypeFeed) Contains(event Event) bool {
+	for _, typeName := range f.typeNames {
+		if event.GetTypeName() == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+// eventBusLiveSource is the LiveEventSource of an EventBus.
+type eventBusLiveSource struct {
+	eventBus   *EventBus
+	bufferSize int
+}
+
+// NewEventBusLiveSource returns a LiveEventSource that receives the events published to the EventBus.
+//
+// The events are received asynchronously with a buffer of the specified size.
+func NewEventBusLiveSource(eventBus *EventBus, bufferSize int) LiveEventSource {
+	return &eventBusLiveSource{eventBus: eventBus, bufferSize: bufferSize}
+}
+
+func (s *eventBusLiveSource) Subscribe(handler func(ctx context.Context, event Event) error) (func(), error) {
+	subscription, err := s.eventBus.Subscribe(handler, WithAsync(s.bufferSize))
+	if err != nil {
+		return nil, err
+	}
+	return subscription.Unsubscribe, nil
+}
+
+// ProjectionRunner feeds a Projection from an EventFeed and a LiveEventSource, saving its checkpoint.
+//
+// An event is handled at least once; the checkpoint is saved after Handle succeeds.
+type ProjectionRunner struct {
+	projection      Projection
+	feed            EventFeed
+	checkpointStore CheckpointStore
+	liveSource      LiveEventSource
+	batchSize       int
+	pollInterval    time.Duration
+}
+
+// ProjectionRunnerOption is an option for ProjectionRunner.
+type ProjectionRunnerOption func(*ProjectionRunner) error
+
+// WithLiveEventSource sets the source of live events handled after the catch-up.
+//
+// - The default is nil, and Run polls the feed instead.
+func WithLiveEventSource(liveSource LiveEventSource) ProjectionRunnerOption {
+	return func(r *ProjectionRunner) error {
+		if liveSource == nil {
+			return errors.New("liveSource is nil")
+		}
+		r.liveSource = liveSource
+		return nil
+	}
+}
+
+// WithProjectionBatchSize sets the number of events read from the feed at once.
+//
+// - The default is 100.
+func WithProjectionBatchSize(batchSize int) ProjectionRunnerOption {
+	return func(r *ProjectionRunner) error {
+		if batchSize <= 0 {
+			return errors.New("batchSize is not positive")
+		}
+		r.batchSize = batchSize
+		return nil
+	}
+}
+
+// WithProjectionPollInterval sets the interval between catch-ups when no live source is set.
+//
+// - The default is 1 second.
+func WithProjectionPollInterval(pollInterval time.Duration) ProjectionRunnerOption {
+	return func(r *ProjectionRunner) error {
+		if pollInterval <= 0 {
+			return errors.New("pollInterval is not positive")
+		}
+		r.pollInterval = pollInterval
+		return nil
+	}
+}
+
+// NewProjectionRunner returns a new ProjectionRunner.
+//
+// # Parameters
+// - projection is the projection to feed.
+// - feed is the catch-up source.
+// - checkpointStore is a checkpoint store.
+// - options is a ProjectionRunnerOption.
+//
+// # Returns
+// - a ProjectionRunner
+// - an error
+func NewProjectionRunner(
+	projection Projection,
+	feed EventFeed,
+	checkpointStore CheckpointStore,
+	options ...ProjectionRunnerOption,
+) (*ProjectionRunner, error) {
+	if projection == nil {
+		return nil, errors.New("projection is nil")
+	}
+	if feed == nil {
+		return nil, errors.New("feed is nil")
+	}
+	if checkpointStore == nil {
+		return nil, errors.New("checkpointStore is nil")
+	}
+	r := &ProjectionRunner{
+		projection:      projection,
+		feed:            feed,
+		checkpointStore: checkpointStore,
+		batchSize:       100,
+		pollInterval:    time.Second,
+	}
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// CatchUp handles the events of the feed after the saved checkpoint until the feed is exhausted.
+func (r *ProjectionRunner) CatchUp(ctx context.Context) error {
+	checkpoint, err := r.checkpointStore.GetCheckpoint(ctx, r.projection.GetName())
+	if err != nil {
+		return err
+	}
+	_, err = r.catchUp(ctx, checkpoint)
+	return err
+}
+
+// Rebuild deletes the checkpoint, resets the projection if it is a ResettableProjection,
+// and replays the feed from the beginning.
+func (r *ProjectionRunner) Rebuild(ctx context.Context) error {
+	if err := r.checkpointStore.DeleteCheckpoint(ctx, r.projection.GetName()); err != nil {
+		return err
+	}
+	if resettable, ok := r.projection.(ResettableProjection); ok {
+		if err := resettable.Reset(ctx); err != nil {
+			return err
+		}
+	}
+	_, err := r.catchUp(ctx, "")
+	return err
+}
+
+// Run catches up and then handles live events until the context is canceled.
+//
+// Live events received during the catch-up are buffered, and events at or before the checkpoint
+// reached by the catch-up are skipped. The later live events are handled in the order received,
+// and the saved checkpoint only moves forward.
+func (r *ProjectionRunner) Run(ctx context.Context) error {
+	if r.liveSource == nil {
+		return r.poll(ctx)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	live := make(chan Event, r.batchSize)
+	unsubscribe, err := r.liveSource.Subscribe(func(_ context.Context, event Event) error {
+		if !r.feed.Contains(event) {
+			return nil
+		}
+		select {
+		case live <- event:
+		case <-done:
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	checkpoint, err := r.checkpointStore.GetCheckpoint(ctx, r.projection.GetName())
+	if err != nil {
+		return err
+	}
+	caughtUp, err := r.catchUp(ctx, checkpoint)
+	if err != nil {
+		return err
+	}
+	checkpoint = caughtUp
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-live:
+			eventCheckpoint := r.feed.CheckpointOf(event)
+			if eventCheckpoint <= caughtUp {
+				continue
+			}
+			if err := r.handle(ctx, event, max(checkpoint, eventCheckpoint)); err != nil {
+				return err
+			}
+			checkpoint = max(checkpoint, eventCheckpoint)
+		}
+	}
+}
+
+// poll catches up repeatedly until the context is canceled.
+func (r *ProjectionRunner) poll(ctx context.Context) error {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.CatchUp(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// catchUp handles the events of the feed after the checkpoint until the feed is exhausted.
+//
+// # Parameters
+// - checkpoint is the checkpoint to start after.
+// # Returns
+// - the last checkpoint
+// - an error
+func (r *ProjectionRunner) catchUp(ctx context.Context, checkpoint string) (string, error) {
+	for {
+		events, err := r.feed.ReadEvents(ctx, checkpoint, r.batchSize)
+		if err != nil {
+			return checkpoint, err
+		}
+		last := checkpoint
+		for _, event := range events {
+			eventCheckpoint := r.feed.CheckpointOf(event)
+			// An event at or before the checkpoint has already been handled.
+			if eventCheckpoint <= checkpoint {
+				continue
+			}
+			if err := r.handle(ctx, event, eventCheckpoint); err != nil {
+				return checkpoint, err
+			}
+			checkpoint = eventCheckpoint
+		}
+		if checkpoint == last {
+			return checkpoint, nil
+		}
+	}
+}
+
+// handle applies the event to the projection and saves the checkpoint.
+func (r *ProjectionRunner) handle(ctx context.Context, event Event, checkpoint string) error {
+	if err := r.projection.Handle(ctx, event); err != nil {
+		return err
+	}
+	return r.checkpointStore.SaveCheckpoint(ctx, r.projection.GetName(), checkpoint)
+}
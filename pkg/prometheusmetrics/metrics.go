@@ -0,0 +1,153 @@
+// Package prometheusmetrics provides the Prometheus implementation of pkg.Metrics.
+//
+//	metrics, err := prometheusmetrics.NewMetrics(prometheus.DefaultRegisterer, "myapp")
+//	if err != nil {
+//		return err
+//	}
+//	eventStore, err := pkg.NewEventStoreOnDynamoDB(..., pkg.WithMetrics(metrics))
+package prometheusmetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+// Metrics is the Prometheus implementation of pkg.Metrics.
+type Metrics struct {
+	reads                   *prometheus.CounterVec
+	readDuration            *prometheus.HistogramVec
+	appends                 *prometheus.CounterVec
+	appendDuration          *prometheus.HistogramVec
+	optimisticLockConflicts *prometheus.CounterVec
+	retries                 *prometheus.CounterVec
+	payloadSize             *prometheus.HistogramVec
+	eventsReplayed          prometheus.Histogram
+	snapshotsPurged         prometheus.Counter
+	consumedCapacity        *prometheus.CounterVec
+}
+
+// NewMetrics returns a new Metrics with its collectors registered to the registerer.
+//
+// # Parameters
+// - registerer is the registerer of the collectors.
+// - namespace is the namespace of the metric names, which may be empty.
+//
+// # Returns
+// - a Metrics
+// - an error if a collector can not be registered
+func NewMetrics(registerer prometheus.Registerer, namespace string) (*Metrics, error) {
+	const subsystem = "event_store"
+	m := &Metrics{
+		reads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "reads_total",
+			Help:      "The number of reads by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		readDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "read_duration_seconds",
+			Help:      "The duration of reads by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		appends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "appends_total",
+			Help:      "The number of appends by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		appendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "append_duration_seconds",
+			Help:      "The duration of appends by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		optimisticLockConflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "optimistic_lock_conflicts_total",
+			Help:      "The number of appends rejected by optimistic locking, by operation.",
+		}, []string{"operation"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "retries_total",
+			Help:      "The number of retried requests to the database, by request.",
+		}, []string{"request"}),
+		payloadSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "payload_size_bytes",
+			Help:      "The size of serialized payloads, by kind.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+		}, []string{"kind"}),
+		eventsReplayed: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "events_replayed",
+			Help:      "The number of events read to replay an aggregate.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+		snapshotsPurged: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "snapshots_purged_total",
+			Help:      "The number of excess snapshots deleted or set to expire.",
+		}),
+		consumedCapacity: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "consumed_capacity_units_total",
+			Help:      "The capacity units consumed by requests to the database, by request and table.",
+		}, []string{"request", "table"}),
+	}
+	collectors := []prometheus.Collector{
+		m.reads, m.readDuration, m.appends, m.appendDuration, m.optimisticLockConflicts,
+		m.retries, m.payloadSize, m.eventsReplayed, m.snapshotsPurged, m.consumedCapacity,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) ObserveRead(operation string, outcome string, duration time.Duration) {
+	m.reads.WithLabelValues(operation, outcome).Inc()
+	m.readDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveAppend(operation string, outcome string, duration time.Duration) {
+	m.appends.WithLabelValues(operation, outcome).Inc()
+	m.appendDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if outcome == pkg.OutcomeConflict {
+		m.optimisticLockConflicts.WithLabelValues(operation).Inc()
+	}
+}
+
+func (m *Metrics) AddRetries(request string, retries int) {
+	m.retries.WithLabelValues(request).Add(float64(retries))
+}
+
+func (m *Metrics) ObservePayloadSize(kind string, size int) {
+	m.payloadSize.WithLabelValues(kind).Observe(float64(size))
+}
+
+func (m *Metrics) ObserveEventsReplayed(count int) {
+	m.eventsReplayed.Observe(float64(count))
+}
+
+func (m *Metrics) AddSnapshotsPurged(count int) {
+	m.snapshotsPurged.Add(float64(count))
+}
+
+func (m *Metrics) AddConsumedCapacity(request string, tableName string, capacityUnits float64) {
+	m.consumedCapacity.WithLabelValues(request, tableName).Add(capacityUnits)
+}
+
+var _ pkg.Metrics = (*Metrics)(nil)
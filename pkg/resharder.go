@@ -0,0 +1,329 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// reshardCopyDone is the checkpoint of a completed Copy.
+const reshardCopyDone = "done"
+
+// Resharder reshards the items of the journal and snapshot tables of EventStoreOnDynamoDB to another shard count.
+//
+// Resharding is done online in these steps:
+//  1. Begin records the next shard count in the shard layout.
+//  2. Restart the stores, created with WithShardLayoutCheck and the current shard count, so that they read
+//     from both shard layouts and write to the next one, copying an aggregate before writing it.
+//  3. Copy copies the other aggregates in the background, saving its progress to the CheckpointStore
+//     so that it resumes where it stopped.
+//  4. Cutover copies the aggregates still not copied, deletes the items of the current shard layout
+//     and records the next shard count as the shard count.
+//  5. Restart the stores with the new shard count.
+//
+// Every write transaction of a store checks the shard layout it writes by, so the writes of a store
+// not restarted after Begin or Cutover fail with an IOError instead of writing to the old shard layout.
+//
+// The items are identified by the pkey and skey of the DefaultKeyResolver or the SortableKeyResolver.
+// The copied journal items are marked, so StreamSubscription skips their INSERT records in the stream.
+type Resharder struct {
+	eventStoreConfig
+	client            *dynamodb.Client
+	journalTableName  string
+	snapshotTableName string
+	checkpointStore   CheckpointStore
+}
+
+// ReshardProgress is the progress of Copy and Cutover.
+type ReshardProgress struct {
+	// Scanned is the number of aggregates scanned.
+	Scanned int
+	// Copied is the number of aggregates copied to the next shard layout.
+	Copied int
+	// Deleted is the number of items deleted from the current shard layout.
+	Deleted int
+}
+
+// NewResharder returns a new Resharder.
+//
+// # Parameters
+// - client is a DynamoDB client.
+// - journalTableName is a journal table name.
+// - snapshotTableName is a snapshot table name.
+// - checkpointStore is the CheckpointStore of the progress of Copy.
+// - options is an EventStoreOption, of which the key resolver and the logger are used.
+//
+// # Returns
+// - a Resharder
+// - an error
+func NewResharder(client *dynamodb.Client, journalTableName string, snapshotTableName string, checkpointStore CheckpointStore, options ...EventStoreOption) (*Resharder, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if journalTableName == "" {
+		return nil, errors.New("journalTableName is empty")
+	}
+	if snapshotTableName == "" {
+		return nil, errors.New("snapshotTableName is empty")
+	}
+	if checkpointStore == nil {
+		return nil, errors.New("checkpointStore is nil")
+	}
+	config, err := newEventStoreConfig(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Resharder{
+		eventStoreConfig:  config,
+		client:            client,
+		journalTableName:  journalTableName,
+		snapshotTableName: snapshotTableName,
+		checkpointStore:   checkpointStore,
+	}, nil
+}
+
+// ShardLayout returns the recorded shard layout.
+func (r *Resharder) ShardLayout(ctx context.Context) (*ShardLayout, error) {
+	layout, err := getShardLayout(ctx, r.client, r.snapshotTableName)
+	if err != nil {
+		return nil, err
+	}
+	if layout == nil {
+		return nil, errors.New("the shard layout is not recorded; start a store with WithShardLayoutCheck first")
+	}
+	return layout, nil
+}
+
+// Begin records the next shard count in the shard layout.
+//
+// # Parameters
+// - nextShardCount is the shard count to reshard the items to.
+//
+// # Returns
+// - an error if the items are already being resharded
+func (r *Resharder) Begin(ctx context.Context, nextShardCount uint64) error {
+	if nextShardCount == 0 {
+		return errors.New("nextShardCount is zero")
+	}
+	layout, err := r.ShardLayout(ctx)
+	if err != nil {
+		return err
+	}
+	if layout.Resharding() {
+		return fmt.Errorf("the items are already being resharded from %d to %d", layout.ShardCount, layout.NextShardCount)
+	}
+	if layout.ShardCount == nextShardCount {
+		return fmt.Errorf("the shard count is already %d", nextShardCount)
+	}
+	replaced, err := replaceShardLayout(ctx, r.client, r.snapshotTableName, *layout, ShardLayout{ShardCount: layout.ShardCount, NextShardCount: nextShardCount})
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		return errors.New("the shard layout was changed concurrently")
+	}
+	r.logger.LogAttrs(ctx, slog.LevelInfo, "began resharding",
+		slog.Uint64("shard_count", layout.ShardCount),
+		slog.Uint64("next_shard_count", nextShardCount))
+	return nil
+}
+
+// Copy copies the aggregates of the current shard layout to the next one, resuming from the saved progress.
+//
+// # Returns
+// - the progress of this run
+// - an error
+func (r *Resharder) Copy(ctx context.Context) (*ReshardProgress, error) {
+	layout, err := r.reshardingLayout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checkpointId := r.checkpointId(layout)
+	checkpoint, err := r.checkpointStore.GetCheckpoint(ctx, checkpointId)
+	if err != nil {
+		return nil, err
+	}
+	progress := &ReshardProgress{}
+	if checkpoint == reshardCopyDone {
+		return progress, nil
+	}
+	var startKey map[string]types.AttributeValue
+	if checkpoint != "" {
+		if startKey, err = decodeReshardCheckpoint(checkpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.scanAggregates(ctx, layout, startKey, func(id *storedAggregateId, fromPkey string, toPkey string) error {
+		if err := copyAggregateItems(ctx, r.client, r.tableNames(), id.AsString(), fromPkey, toPkey); err != nil {
+			return err
+		}
+		progress.Copied++
+		return nil
+	}, progress, func(lastEvaluatedKey map[string]types.AttributeValue) error {
+		checkpoint := reshardCopyDone
+		if len(lastEvaluatedKey) != 0 {
+			checkpoint = encodeReshardCheckpoint(lastEvaluatedKey)
+		}
+		return r.checkpointStore.SaveCheckpoint(ctx, checkpointId, checkpoint)
+	})
+	if err != nil {
+		return progress, err
+	}
+	r.logger.LogAttrs(ctx, slog.LevelInfo, "copied the aggregates to the next shard layout",
+		slog.Int("scanned", progress.Scanned),
+		slog.Int("copied", progress.Copied))
+	return progress, nil
+}
+
+// Cutover copies the aggregates still not copied, deletes the items of the current shard layout
+// and records the next shard count as the shard count.
+//
+// It can be run again if it stops midway.
+//
+// # Returns
+// - the progress of this run
+// - an error
+func (r *Resharder) Cutover(ctx context.Context) (*ReshardProgress, error) {
+	layout, err := r.reshardingLayout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progress := &ReshardProgress{}
+	err = r.scanAggregates(ctx, layout, nil, func(id *storedAggregateId, fromPkey string, toPkey string) error {
+		if err := copyAggregateItems(ctx, r.client, r.tableNames(), id.AsString(), fromPkey, toPkey); err != nil {
+			return err
+		}
+		progress.Copied++
+		deleted, err := deleteAggregateItems(ctx, r.client, r.tableNames(), id.AsString(), fromPkey)
+		progress.Deleted += deleted
+		return err
+	}, progress, nil)
+	if err != nil {
+		return progress, err
+	}
+
+	replaced, err := replaceShardLayout(ctx, r.client, r.snapshotTableName, *layout, ShardLayout{ShardCount: layout.NextShardCount})
+	if err != nil {
+		return progress, err
+	}
+	if !replaced {
+		return progress, errors.New("the shard layout was changed concurrently")
+	}
+	if err := r.checkpointStore.DeleteCheckpoint(ctx, r.checkpointId(layout)); err != nil {
+		return progress, err
+	}
+	r.logger.LogAttrs(ctx, slog.LevelInfo, "cut over to the next shard layout",
+		slog.Uint64("shard_count", layout.NextShardCount),
+		slog.Int("scanned", progress.Scanned),
+		slog.Int("copied", progress.Copied),
+		slog.Int("deleted", progress.Deleted))
+	return progress, nil
+}
+
+// reshardingLayout returns the shard layout, or an error if the items are not being resharded.
+func (r *Resharder) reshardingLayout(ctx context.Context) (*ShardLayout, error) {
+	layout, err := r.ShardLayout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !layout.Resharding() {
+		return nil, errors.New("the items are not being resharded")
+	}
+	return layout, nil
+}
+
+// scanAggregates calls f for each aggregate whose snapshot of seqNr 0 is in the current shard layout and whose pkey changes.
+//
+// onPage is called after each page of the scan with its last evaluated key, which is empty for the last page.
+func (r *Resharder) scanAggregates(
+	ctx context.Context,
+	layout *ShardLayout,
+	startKey map[string]types.AttributeValue,
+	f func(id *storedAggregateId, fromPkey string, toPkey string) error,
+	progress *ReshardProgress,
+	onPage func(lastEvaluatedKey map[string]types.AttributeValue) error,
+) error {
+	request := &dynamodb.ScanInput{
+		TableName:        aws.String(r.snapshotTableName),
+		FilterExpression: aws.String("#seq_nr = :seq_nr AND attribute_exists(#aid)"),
+		ExpressionAttributeNames: map[string]string{
+			"#seq_nr": "seq_nr",
+			"#aid":    "aid",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":seq_nr": &types.AttributeValueMemberN{Value: "0"},
+		},
+		ConsistentRead:    aws.Bool(true),
+		ExclusiveStartKey: startKey,
+	}
+	for {
+		result, err := r.client.Scan(ctx, request)
+		if err != nil {
+			return NewIOError("Failed to reshard scan", err)
+		}
+		for _, item := range result.Items {
+			progress.Scanned++
+			id, ok := newStoredAggregateId(item)
+			if !ok {
+				r.logger.LogAttrs(ctx, slog.LevelWarn, "skipped a snapshot whose pkey does not match its aid",
+					slog.Any("pkey", item["pkey"]), slog.Any("aid", item["aid"]))
+				continue
+			}
+			pkey := item["pkey"].(*types.AttributeValueMemberS).Value
+			fromPkey := r.keyResolver.ResolvePkey(id, layout.ShardCount)
+			toPkey := r.keyResolver.ResolvePkey(id, layout.NextShardCount)
+			if pkey != fromPkey || fromPkey == toPkey {
+				continue
+			}
+			if err := f(id, fromPkey, toPkey); err != nil {
+				return err
+			}
+		}
+		if onPage != nil {
+			if err := onPage(result.LastEvaluatedKey); err != nil {
+				return err
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		request.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+func (r *Resharder) tableNames() []string {
+	return []string{r.journalTableName, r.snapshotTableName}
+}
+
+func (r *Resharder) checkpointId(layout *ShardLayout) string {
+	return fmt.Sprintf("reshard/%s/%d-%d", r.snapshotTableName, layout.ShardCount, layout.NextShardCount)
+}
+
+// encodeReshardCheckpoint encodes the last evaluated key of a scan of the snapshot table.
+func encodeReshardCheckpoint(lastEvaluatedKey map[string]types.AttributeValue) string {
+	key := map[string]string{
+		"pkey": lastEvaluatedKey["pkey"].(*types.AttributeValueMemberS).Value,
+		"skey": lastEvaluatedKey["skey"].(*types.AttributeValueMemberS).Value,
+	}
+	checkpoint, _ := json.Marshal(key)
+	return string(checkpoint)
+}
+
+// decodeReshardCheckpoint decodes the start key of a scan of the snapshot table.
+func decodeReshardCheckpoint(checkpoint string) (map[string]types.AttributeValue, error) {
+	var key map[string]string
+	if err := json.Unmarshal([]byte(checkpoint), &key); err != nil {
+		return nil, NewDeserializationError("Failed to decode the reshard checkpoint", err)
+	}
+	return map[string]types.AttributeValue{
+		"pkey": &types.AttributeValueMemberS{Value: key["pkey"]},
+		"skey": &types.AttributeValueMemberS{Value: key["skey"]},
+	}, nil
+}
@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SkeyMigrationResult is the result of MigrateToSortableSkeys.
+type SkeyMigrationResult struct {
+	// Scanned is the number of items scanned.
+	Scanned int
+	// Migrated is the number of items rewritten, or to be rewritten in a dry run.
+	Migrated int
+	// Skipped is the number of items already migrated, or not of an aggregate of the DefaultKeyResolver.
+	Skipped int
+	// Conflicts is the number of items changed by a concurrent write while being rewritten, which are left as they are.
+	Conflicts int
+}
+
+// MigrateToSortableSkeys rewrites the items of a journal or snapshot table written with the DefaultKeyResolver
+// to the skeys of the SortableKeyResolver.
+//
+// Each item is put with the new skey and deleted with the old skey in a transaction, conditioned on the
+// version of a snapshot item not having changed. Items already migrated are skipped, so the migration
+// can be run again to pick up conflicts. Stop the writers using the DefaultKeyResolver before migrating,
+// and switch them to the SortableKeyResolver afterwards.
+//
+// # Parameters
+// - client is a DynamoDB client.
+// - tableName is the name of the journal or snapshot table.
+// - dryRun is whether to only count the items to rewrite.
+// - logger is the logger of the skipped items and conflicts. If nil, nothing is logged.
+//
+// # Returns
+// - a SkeyMigrationResult
+// - an error
+func MigrateToSortableSkeys(ctx context.Context, client *dynamodb.Client, tableName string, dryRun bool, logger *slog.Logger) (*SkeyMigrationResult, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if tableName == "" {
+		return nil, errors.New("tableName is empty")
+	}
+	if logger == nil {
+		logger = newDiscardLogger()
+	}
+
+	result := &SkeyMigrationResult{}
+	request := &dynamodb.ScanInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+	}
+	for {
+		response, err := client.Scan(ctx, request)
+		if err != nil {
+			return result, NewIOError("Failed to MigrateToSortableSkeys scan", err)
+		}
+		for _, item := range response.Items {
+			result.Scanned++
+			if err := migrateSkey(ctx, client, tableName, item, dryRun, logger, result); err != nil {
+				return result, err
+			}
+		}
+		if len(response.LastEvaluatedKey) == 0 {
+			break
+		}
+		request.ExclusiveStartKey = response.LastEvaluatedKey
+	}
+	return result, nil
+}
+
+// migrateSkey rewrites the item to the sortable skey and counts it in the result.
+func migrateSkey(ctx context.Context, client *dynamodb.Client, tableName string, item map[string]types.AttributeValue, dryRun bool, logger *slog.Logger, result *SkeyMigrationResult) error {
+	pkey := item["pkey"].(*types.AttributeValueMemberS).Value
+	skey := item["skey"].(*types.AttributeValueMemberS).Value
+	if isSortableSkey(skey) || pkey == shardLayoutKey {
+		result.Skipped++
+		return nil
+	}
+	sortableSkey, ok := toSortableSkey(skey)
+	if !ok {
+		result.Skipped++
+		logger.LogAttrs(ctx, slog.LevelWarn, "skipped an item whose skey is not of the DefaultKeyResolver",
+			slog.String("table", tableName), slog.String("pkey", pkey), slog.String("skey", skey))
+		return nil
+	}
+	result.Migrated++
+	if dryRun {
+		return nil
+	}
+
+	migrated := maps.Clone(item)
+	migrated["skey"] = &types.AttributeValueMemberS{Value: sortableSkey}
+	// The put is an INSERT in the stream, which StreamSubscription skips by the marker.
+	migrated[copiedAttributeName] = &types.AttributeValueMemberBOOL{Value: true}
+	remove := &types.Delete{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: pkey},
+			"skey": &types.AttributeValueMemberS{Value: skey},
+		},
+		ConditionExpression: aws.String("attribute_exists(skey)"),
+	}
+	if version, ok := item["version"]; ok {
+		remove.ConditionExpression = aws.String("#version = :version")
+		remove.ExpressionAttributeNames = map[string]string{"#version": "version"}
+		remove.ExpressionAttributeValues = map[string]types.AttributeValue{":version": version}
+	}
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName:           aws.String(tableName),
+				Item:                migrated,
+				ConditionExpression: aws.String("attribute_not_exists(skey)"),
+			}},
+			{Delete: remove},
+		},
+	})
+	if err != nil {
+		var transactionCanceledException *types.TransactionCanceledException
+		if errors.As(err, &transactionCanceledException) {
+			result.Migrated--
+			result.Conflicts++
+			logger.LogAttrs(ctx, slog.LevelWarn, "skipped an item changed while being migrated",
+				slog.String("table", tableName), slog.String("pkey", pkey), slog.String("skey", skey))
+			return nil
+		}
+		return NewIOError("Failed to MigrateToSortableSkeys transactWriteItems", err)
+	}
+	return nil
+}
+
+// toSortableSkey returns the skey of the SortableKeyResolver for an skey of the DefaultKeyResolver,
+// or false if the skey is not one.
+func toSortableSkey(skey string) (string, bool) {
+	i := strings.LastIndexByte(skey, '-')
+	if i < 0 {
+		return "", false
+	}
+	seqNr, err := strconv.ParseUint(skey[i+1:], 10, 64)
+	if err != nil || strconv.FormatUint(seqNr, 10) != skey[i+1:] {
+		return "", false
+	}
+	return skey[:i+1] + sortableSeqNr(seqNr), true
+}
+
+// isSortableSkey returns whether the skey ends with a seqNr of the SortableKeyResolver.
+func isSortableSkey(skey string) bool {
+	i := strings.LastIndexByte(skey, '-')
+	if i < 0 || len(skey)-i-1 != len(sortableSeqNr(0)) {
+		return false
+	}
+	_, err := strconv.ParseUint(skey[i+1:], 10, 64)
+	return err == nil
+}
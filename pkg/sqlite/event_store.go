@@ -0,0 +1,170 @@
+// Package sqlite provides the event store on a single SQLite database file.
+//
+// It links the pure Go driver modernc.org/sqlite, which registers the "sqlite" database/sql driver,
+// so it is a separate package from pkg.
+//
+//	eventStore, err := sqlite.NewEventStore(ctx, "event_store.db", eventConverter, snapshotConverter)
+//	if err != nil {
+//		return err
+//	}
+//	defer eventStore.Close()
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/internal/sqlstore"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	journalTableName  = "journal"
+	snapshotTableName = "snapshot"
+)
+
+// migrations are the schema migrations of EventStore, applied in order.
+//
+// Applied migrations are recorded in the schema_migrations table; append new migrations and never edit existing ones.
+var migrations = []string{
+	`CREATE TABLE journal (
+	pkey        TEXT    NOT NULL,
+	skey        TEXT    NOT NULL,
+	aid         TEXT    NOT NULL,
+	seq_nr      INTEGER NOT NULL,
+	type_name   TEXT    NOT NULL,
+	payload     BLOB    NOT NULL,
+	occurred_at INTEGER NOT NULL,
+	PRIMARY KEY (pkey, skey),
+	UNIQUE (aid, seq_nr)
+);
+CREATE INDEX journal_type_name_idx ON journal (type_name, occurred_at);
+CREATE TABLE snapshot (
+	pkey    TEXT    NOT NULL,
+	skey    TEXT    NOT NULL,
+	aid     TEXT    NOT NULL,
+	seq_nr  INTEGER NOT NULL,
+	payload BLOB    NOT NULL,
+	version INTEGER NOT NULL,
+	ttl     INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (pkey, skey),
+	UNIQUE (aid, seq_nr)
+);`,
+}
+
+// EventStore is pkg.EventStore for a single SQLite database file.
+//
+// The database is opened in WAL mode, and writes take the write lock when the transaction begins,
+// so concurrent writers wait for each other instead of failing to upgrade their locks.
+type EventStore struct {
+	*sqlstore.Store
+	db *sql.DB
+}
+
+// NewEventStore opens the database file, migrates its schema and returns a new EventStore.
+//
+// # Parameters
+// - ctx is the context of the migrations.
+// - path is the path of the database file, which is created if it does not exist.
+// - eventConverter is a converter to convert a map to an event.
+// - snapshotConverter is a converter to convert a map to an aggregate.
+// - options is an EventStoreOption.
+//
+// # Returns
+// - an EventStore, which must be closed
+// - an error
+func NewEventStore(
+	ctx context.Context,
+	path string,
+	eventConverter pkg.EventConverter,
+	snapshotConverter pkg.AggregateConverter,
+	options ...pkg.EventStoreOption,
+) (*EventStore, error) {
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+	query := url.Values{}
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Set("_txlock", "immediate")
+	// The path is escaped, since SQLite decodes the file: URI.
+	dsn := url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: query.Encode(),
+	}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, pkg.NewIOError("Failed to open the database", err)
+	}
+	if err := Migrate(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store, err := sqlstore.New(db, journalTableName, snapshotTableName, 1, eventConverter, snapshotConverter, options...)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &EventStore{Store: store, db: db}, nil
+}
+
+// Close closes the database.
+func (es *EventStore) Close() error {
+	return es.db.Close()
+}
+
+// Migrate applies the schema migrations of EventStore that are not yet applied to the database.
+//
+// NewEventStore calls this function, so it is only needed to migrate a database ahead of time.
+//
+// # Parameters
+// - db is a database handle opened with a SQLite driver.
+//
+// # Returns
+// - an error
+func Migrate(ctx context.Context, db *sql.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)"); err != nil {
+		return pkg.NewIOError("Failed to create the schema_migrations table", err)
+	}
+	for i, migration := range migrations {
+		version := i + 1
+		if err := migrate(ctx, db, version, migration); err != nil {
+			return pkg.NewIOError(fmt.Sprintf("Failed to apply the migration %d", version), err)
+		}
+	}
+	return nil
+}
+
+// migrate applies the migration in a transaction unless its version is recorded.
+func migrate(ctx context.Context, db *sql.DB, version int, migration string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", version).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
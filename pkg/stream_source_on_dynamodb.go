@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// copiedAttributeName is the attribute marking an item written as a copy of an existing item.
+const copiedAttributeName = "copied"
+
+// StreamSourceOnDynamoDB is StreamSource for the DynamoDB Stream of the journal table.
+//
+// The stream must be enabled with a view type that includes new images.
+type StreamSourceOnDynamoDB struct {
+	client    *dynamodbstreams.Client
+	streamArn string
+	limit     int32
+	mu        sync.Mutex
+	iterators map[string]shardIteratorPosition
+}
+
+// shardIteratorPosition is a shard iterator and the sequence number it continues from.
+type shardIteratorPosition struct {
+	sequenceNumber string
+	iterator       *string
+}
+
+// NewStreamSourceOnDynamoDB returns a new StreamSourceOnDynamoDB.
+//
+// # Parameters
+// - client is a DynamoDB Streams client.
+// - streamArn is the ARN of the journal table stream.
+// - limit is the maximum number of records returned by a GetRecords call.
+//
+// # Returns
+// - a StreamSourceOnDynamoDB
+// - an error
+func NewStreamSourceOnDynamoDB(client *dynamodbstreams.Client, streamArn string, limit int32) (*StreamSourceOnDynamoDB, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if streamArn == "" {
+		return nil, errors.New("streamArn is empty")
+	}
+	if limit <= 0 {
+		return nil, errors.New("limit is not positive")
+	}
+	return &StreamSourceOnDynamoDB{
+		client:    client,
+		streamArn: streamArn,
+		limit:     limit,
+		iterators: make(map[string]shardIteratorPosition),
+	}, nil
+}
+
+func (ss *StreamSourceOnDynamoDB) GetShards(ctx context.Context) ([]StreamShard, error) {
+	var shards []StreamShard
+	request := &dynamodbstreams.DescribeStreamInput{
+		StreamArn: aws.String(ss.streamArn),
+	}
+	for {
+		response, err := ss.client.DescribeStream(ctx, request)
+		if err != nil {
+			return nil, NewIOError("Failed to GetShards describeStream", err)
+		}
+		for _, shard := range response.StreamDescription.Shards {
+			shards = append(shards, StreamShard{
+				ShardId:       aws.ToString(shard.ShardId),
+				ParentShardId: aws.ToString(shard.ParentShardId),
+			})
+		}
+		if response.StreamDescription.LastEvaluatedShardId == nil {
+			break
+		}
+		request.ExclusiveStartShardId = response.StreamDescription.LastEvaluatedShardId
+	}
+	return shards, nil
+}
+
+func (ss *StreamSourceOnDynamoDB) GetRecords(ctx context.Context, shardId string, sequenceNumber string) ([]StreamRecord, bool, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	position, ok := ss.iterators[shardId]
+	if !ok || position.sequenceNumber != sequenceNumber {
+		iterator, err := ss.getShardIterator(ctx, shardId, sequenceNumber)
+		if err != nil {
+			return nil, false, err
+		}
+		position = shardIteratorPosition{sequenceNumber: sequenceNumber, iterator: iterator}
+	}
+	if position.iterator == nil {
+		// The shard is closed and all of its records have been read.
+		return nil, true, nil
+	}
+
+	response, err := ss.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+		ShardIterator: position.iterator,
+		Limit:         aws.Int32(ss.limit),
+	})
+	var expired *types.ExpiredIteratorException
+	if errors.As(err, &expired) {
+		iterator, err := ss.getShardIterator(ctx, shardId, sequenceNumber)
+		if err != nil {
+			return nil, false, err
+		}
+		response, err = ss.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int32(ss.limit),
+		})
+		if err != nil {
+			delete(ss.iterators, shardId)
+			return nil, false, NewIOError("Failed to GetRecords getRecords", err)
+		}
+	} else if err != nil {
+		delete(ss.iterators, shardId)
+		return nil, false, NewIOError("Failed to GetRecords getRecords", err)
+	}
+
+	records := make([]StreamRecord, 0, len(response.Records))
+	for _, r := range response.Records {
+		record, err := ss.convertRecord(shardId, r)
+		if err != nil {
+			delete(ss.iterators, shardId)
+			return nil, false, err
+		}
+		records = append(records, record)
+	}
+	next := shardIteratorPosition{sequenceNumber: sequenceNumber, iterator: response.NextShardIterator}
+	if len(records) > 0 {
+		next.sequenceNumber = records[len(records)-1].SequenceNumber
+	}
+	ss.iterators[shardId] = next
+
+	return records, response.NextShardIterator == nil, nil
+}
+
+// getShardIterator returns a shard iterator positioned after the sequence number.
+//
+// # Parameters
+// - shardId is the id of the shard.
+// - sequenceNumber is the sequence number to continue from. If empty, the iterator starts at the trim horizon.
+// # Returns
+// - a shard iterator
+// - an error
+func (ss *StreamSourceOnDynamoDB) getShardIterator(ctx context.Context, shardId string, sequenceNumber string) (*string, error) {
+	request := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(ss.streamArn),
+		ShardId:           aws.String(shardId),
+		ShardIteratorType: types.ShardIteratorTypeTrimHorizon,
+	}
+	if sequenceNumber != "" {
+		request.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		request.SequenceNumber = aws.String(sequenceNumber)
+	}
+	response, err := ss.client.GetShardIterator(ctx, request)
+	if err != nil {
+		return nil, NewIOError("Failed to GetRecords getShardIterator", err)
+	}
+	return response.ShardIterator, nil
+}
+
+// convertRecord converts a DynamoDB Streams record to a StreamRecord.
+//
+// # Parameters
+// - shardId is the id of the shard.
+// - r is a DynamoDB Streams record.
+// # Returns
+// - a StreamRecord
+// - an error
+func (ss *StreamSourceOnDynamoDB) convertRecord(shardId string, r types.Record) (StreamRecord, error) {
+	if r.Dynamodb == nil {
+		return StreamRecord{}, NewDeserializationError("Failed to convert the stream record", errors.New("dynamodb is nil"))
+	}
+	record := StreamRecord{
+		ShardId:        shardId,
+		SequenceNumber: aws.ToString(r.Dynamodb.SequenceNumber),
+		EventName:      string(r.EventName),
+	}
+	image := r.Dynamodb.NewImage
+	if image == nil {
+		return record, nil
+	}
+	if aid, ok := image["aid"].(*types.AttributeValueMemberS); ok {
+		record.Aid = aid.Value
+	}
+	if seqNr, ok := image["seq_nr"].(*types.AttributeValueMemberN); ok {
+		value, err := strconv.ParseUint(seqNr.Value, 10, 64)
+		if err != nil {
+			return StreamRecord{}, NewDeserializationError("Failed to parse the seq_nr", err)
+		}
+		record.SeqNr = value
+	}
+	if payload, ok := image["payload"].(*types.AttributeValueMemberB); ok {
+		record.Payload = payload.Value
+	}
+	if copied, ok := image[copiedAttributeName].(*types.AttributeValueMemberBOOL); ok {
+		record.Copied = copied.Value
+	}
+	return record, nil
+}
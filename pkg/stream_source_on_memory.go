@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StreamSourceOnMemory is the memory implementation of StreamSource.
+//
+// It stands in for a DynamoDB Stream in tests.
+type StreamSourceOnMemory struct {
+	mu              sync.RWMutex
+	records         map[string][]StreamRecord
+	parentShardIds  map[string]string
+	closed          map[string]bool
+	sequence        uint64
+	eventSerializer EventSerializer
+}
+
+// NewStreamSourceOnMemory is the constructor of StreamSourceOnMemory.
+func NewStreamSourceOnMemory() *StreamSourceOnMemory {
+	return &StreamSourceOnMemory{
+		records:         make(map[string][]StreamRecord),
+		parentShardIds:  make(map[string]string),
+		closed:          make(map[string]bool),
+		eventSerializer: &DefaultEventSerializer{},
+	}
+}
+
+// SplitShard closes the parent shard and adds the child shards split from it.
+func (ss *StreamSourceOnMemory) SplitShard(parentShardId string, childShardIds ...string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.records[parentShardId]; !ok {
+		ss.records[parentShardId] = nil
+	}
+	ss.closed[parentShardId] = true
+	for _, childShardId := range childShardIds {
+		if _, ok := ss.records[childShardId]; !ok {
+			ss.records[childShardId] = nil
+		}
+		ss.parentShardIds[childShardId] = parentShardId
+	}
+}
+
+// Append appends the record to the shard, assigning its shard id and sequence number.
+//
+// It panics if the shard is closed by SplitShard.
+func (ss *StreamSourceOnMemory) Append(shardId string, record StreamRecord) StreamRecord {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed[shardId] {
+		panic("shard is closed")
+	}
+	ss.sequence++
+	record.ShardId = shardId
+	record.SequenceNumber = fmt.Sprintf("%021d", ss.sequence)
+	ss.records[shardId] = append(ss.records[shardId], record)
+	return record
+}
+
+// AppendEvent appends an INSERT record of the event to the shard.
+func (ss *StreamSourceOnMemory) AppendEvent(shardId string, event Event) (StreamRecord, error) {
+	payload, err := ss.eventSerializer.Serialize(event)
+	if err != nil {
+		return StreamRecord{}, err
+	}
+	return ss.Append(shardId, StreamRecord{
+		EventName: StreamEventNameInsert,
+		Aid:       event.GetAggregateId().AsString(),
+		SeqNr:     event.GetSeqNr(),
+		Payload:   payload,
+	}), nil
+}
+
+func (ss *StreamSourceOnMemory) GetShards(_ context.Context) ([]StreamShard, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	shards := make([]StreamShard, 0, len(ss.records))
+	for shardId := range ss.records {
+		shards = append(shards, StreamShard{ShardId: shardId, ParentShardId: ss.parentShardIds[shardId]})
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].ShardId < shards[j].ShardId
+	})
+	return shards, nil
+}
+
+func (ss *StreamSourceOnMemory) GetRecords(_ context.Context, shardId string, sequenceNumber string) ([]StreamRecord, bool, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	result := make([]StreamRecord, 0)
+	for _, record := range ss.records[shardId] {
+		if record.SequenceNumber > sequenceNumber {
+			result = append(result, record)
+		}
+	}
+	return result, ss.closed[shardId], nil
+}
@@ -0,0 +1,324 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// StreamEventNameInsert is the event name of a stream record for a newly written item.
+	StreamEventNameInsert = "INSERT"
+	// StreamEventNameModify is the event name of a stream record for an updated item.
+	StreamEventNameModify = "MODIFY"
+	// StreamEventNameRemove is the event name of a stream record for a deleted item.
+	StreamEventNameRemove = "REMOVE"
+)
+
+// StreamRecord is a journal record read from a change stream.
+type StreamRecord struct {
+	// ShardId is the id of the shard the record belongs to.
+	ShardId string
+	// SequenceNumber is the position of the record in the shard.
+	SequenceNumber string
+	// EventName is the kind of change (INSERT, MODIFY or REMOVE).
+	EventName string
+	// Aid is the aggregate id of the journal item.
+	Aid string
+	// SeqNr is the sequence number of the journal item.
+	SeqNr uint64
+	// Payload is the serialized event of the journal item.
+	Payload []byte
+	// Copied is true if the journal item is a copy of an item already in the stream,
+	// written by MigrateToSortableSkeys or by resharding.
+	Copied bool
+}
+
+// StreamShard is a shard of a change stream.
+type StreamShard struct {
+	// ShardId is the id of the shard.
+	ShardId string
+	// ParentShardId is the id of the shard this shard was split from, or empty.
+	ParentShardId string
+}
+
+// StreamSource is the interface for reading journal records from a change stream.
+type StreamSource interface {
+	// GetShards returns the shards of the stream.
+	GetShards(ctx context.Context) ([]StreamShard, error)
+	// GetRecords returns the records of the shard after the specified sequence number,
+	// and whether the shard is closed and has no records after them.
+	//
+	// If sequenceNumber is empty, the records are read from the beginning of the shard.
+	GetRecords(ctx context.Context, shardId string, sequenceNumber string) (records []StreamRecord, ended bool, err error)
+}
+
+// streamShardEnded is the checkpoint of a shard whose records have all been dispatched.
+const streamShardEnded = "ended"
+
+// StreamHandler is the function type that handles an event read from a change stream.
+type StreamHandler func(ctx context.Context, event Event) error
+
+// StreamSubscription dispatches the events in a journal change stream to the registered handlers.
+//
+// The checkpoint of each shard is saved after all handlers succeed for a record,
+// so a record is delivered at least once. The INSERT records of copied journal items are
+// skipped, so rewriting the items does not deliver their events again. A shard split from
+// a parent shard is read only after all records of the parent are dispatched, so the events
+// of an aggregate are dispatched in order across shard splits.
+type StreamSubscription struct {
+	name            string
+	source          StreamSource
+	checkpointStore CheckpointStore
+	eventConverter  EventConverter
+	eventSerializer EventSerializer
+	pollInterval    time.Duration
+	errorHandler    func(ctx context.Context, err error)
+	handlers        []StreamHandler
+}
+
+// StreamSubscriptionOption is an option for StreamSubscription.
+type StreamSubscriptionOption func(*StreamSubscription) error
+
+// WithStreamEventSerializer sets an event serializer.
+//
+// - If you want to change the event serializer, specify an EventSerializer.
+// - The default is DefaultEventSerializer.
+//
+// # Parameters
+// - eventSerializer is an event serializer.
+//
+// # Returns
+// - a StreamSubscriptionOption.
+func WithStreamEventSerializer(eventSerializer EventSerializer) StreamSubscriptionOption {
+	return func(s *StreamSubscription) error {
+		s.eventSerializer = eventSerializer
+		return nil
+	}
+}
+
+// WithStreamPollInterval sets the interval between polls in Run.
+//
+// - The default is 1 second.
+//
+// # Parameters
+// - pollInterval is an interval between polls.
+//
+// # Returns
+// - a StreamSubscriptionOption.
+func WithStreamPollInterval(pollInterval time.Duration) StreamSubscriptionOption {
+	return func(s *StreamSubscription) error {
+		if pollInterval <= 0 {
+			return errors.New("pollInterval is not positive")
+		}
+		s.pollInterval = pollInterval
+		return nil
+	}
+}
+
+// WithStreamErrorHandler sets the handler of the errors of the polls in Run, which are retried on the next poll.
+//
+// - The default discards the errors.
+//
+// # Parameters
+// - errorHandler is an error handler.
+//
+// # Returns
+// - a StreamSubscriptionOption.
+func WithStreamErrorHandler(errorHandler func(ctx context.Context, err error)) StreamSubscriptionOption {
+	return func(s *StreamSubscription) error {
+		if errorHandler == nil {
+			return errors.New("errorHandler is nil")
+		}
+		s.errorHandler = errorHandler
+		return nil
+	}
+}
+
+// NewStreamSubscription returns a new StreamSubscription.
+//
+// # Parameters
+// - name is the name of the subscription, used as the prefix of the checkpoint ids.
+// - source is a stream source.
+// - checkpointStore is a checkpoint store.
+// - eventConverter is a converter to convert a map to an event.
+// - options is a StreamSubscriptionOption.
+//
+// # Returns
+// - a StreamSubscription
+// - an error
+func NewStreamSubscription(
+	name string,
+	source StreamSource,
+	checkpointStore CheckpointStore,
+	eventConverter EventConverter,
+	options ...StreamSubscriptionOption,
+) (*StreamSubscription, error) {
+	if name == "" {
+		return nil, errors.New("name is empty")
+	}
+	if source == nil {
+		return nil, errors.New("source is nil")
+	}
+	if checkpointStore == nil {
+		return nil, errors.New("checkpointStore is nil")
+	}
+	if eventConverter == nil {
+		return nil, errors.New("eventConverter is nil")
+	}
+	s := &StreamSubscription{
+		name:            name,
+		source:          source,
+		checkpointStore: checkpointStore,
+		eventConverter:  eventConverter,
+		eventSerializer: &DefaultEventSerializer{},
+		pollInterval:    time.Second,
+		errorHandler:    func(context.Context, error) {},
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// AddHandler registers a handler. Handlers are called in the order of registration.
+func (s *StreamSubscription) AddHandler(handler StreamHandler) {
+	s.handlers = append(s.handlers, handler)
+}
+
+// Run polls the stream until the context is canceled.
+//
+// Errors of a poll are returned only when the context is canceled; otherwise
+// they are passed to the error handler and the failed records are retried on the next poll.
+func (s *StreamSubscription) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		err := s.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			if err != nil && !errors.Is(err, ctx.Err()) {
+				return err
+			}
+			return ctx.Err()
+		default:
+		}
+		if err != nil {
+			s.errorHandler(ctx, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads the new records of every shard once and dispatches them to the handlers.
+//
+// A shard stops at the first record that fails, and the record is redelivered on the next poll.
+// A shard whose parent shard has records not dispatched yet is skipped until they are.
+// The errors of all shards are joined.
+func (s *StreamSubscription) Poll(ctx context.Context) error {
+	shards, err := s.source.GetShards(ctx)
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[shard.ShardId] = true
+	}
+
+	var errs []error
+	ended := make(map[string]bool, len(shards))
+	pending := shards
+	for len(pending) > 0 {
+		var blocked []StreamShard
+		for _, shard := range pending {
+			// A parent no longer listed has been trimmed from the stream.
+			if shard.ParentShardId != "" && listed[shard.ParentShardId] && !ended[shard.ParentShardId] {
+				blocked = append(blocked, shard)
+				continue
+			}
+			shardEnded, err := s.pollShard(ctx, shard.ShardId)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			ended[shard.ShardId] = shardEnded
+		}
+		if len(blocked) == len(pending) {
+			break
+		}
+		pending = blocked
+	}
+	return errors.Join(errs...)
+}
+
+// checkpointId returns the id of the checkpoint of the shard.
+func (s *StreamSubscription) checkpointId(shardId string) string {
+	return s.name + "/" + shardId
+}
+
+// pollShard reads the new records of the shard and dispatches them to the handlers.
+//
+// # Parameters
+// - shardId is the id of the shard.
+// # Returns
+// - whether all records of the shard are dispatched and the shard is closed
+// - an error
+func (s *StreamSubscription) pollShard(ctx context.Context, shardId string) (bool, error) {
+	checkpoint, err := s.checkpointStore.GetCheckpoint(ctx, s.checkpointId(shardId))
+	if err != nil {
+		return false, err
+	}
+	if checkpoint == streamShardEnded {
+		return true, nil
+	}
+	records, ended, err := s.source.GetRecords(ctx, shardId, checkpoint)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if record.EventName == StreamEventNameInsert && !record.Copied {
+			if err := s.dispatch(ctx, record); err != nil {
+				return false, err
+			}
+		}
+		if err := s.checkpointStore.SaveCheckpoint(ctx, s.checkpointId(shardId), record.SequenceNumber); err != nil {
+			return false, err
+		}
+	}
+	if !ended {
+		return false, nil
+	}
+	if err := s.checkpointStore.SaveCheckpoint(ctx, s.checkpointId(shardId), streamShardEnded); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// dispatch decodes the record and calls the handlers.
+//
+// # Parameters
+// - record is a stream record.
+// # Returns
+// - an error
+func (s *StreamSubscription) dispatch(ctx context.Context, record StreamRecord) error {
+	var eventMap map[string]any
+	if err := s.eventSerializer.Deserialize(record.Payload, &eventMap); err != nil {
+		return err
+	}
+	event, err := s.eventConverter(eventMap)
+	if err != nil {
+		return NewDeserializationError("Failed to convert the event", err)
+	}
+	for _, handler := range s.handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package pkg
 
+import "errors"
+
 // AggregateConverter is the function type that converts map[string]any to Aggregate.
 type AggregateConverter func(map[string]any) (Aggregate, error)
 
@@ -11,6 +13,11 @@ type AggregateResult struct {
 	aggregate Aggregate
 }
 
+// NewAggregateResult returns the result of the aggregate, which is empty if the aggregate is nil.
+func NewAggregateResult(aggregate Aggregate) *AggregateResult {
+	return &AggregateResult{aggregate: aggregate}
+}
+
 // Present returns true if the aggregate is not nil.
 func (a *AggregateResult) Present() bool {
 	return a.aggregate != nil
@@ -29,6 +36,35 @@ func (a *AggregateResult) Aggregate() Aggregate {
 	return a.aggregate
 }
 
+// AggregateLoadResult is the result of loading an aggregate by GetLatestSnapshotsByIds.
+type AggregateLoadResult struct {
+	// AggregateId is the id of the aggregate.
+	AggregateId AggregateId
+	// Snapshot is the latest snapshot, which is empty if the aggregate does not exist.
+	Snapshot *AggregateResult
+	// Events are the events after the snapshot.
+	Events []Event
+	// Err is the error of loading the aggregate, in which case Snapshot and Events are nil.
+	Err error
+}
+
+// HashChainVerification is the result of verifying the hash chain of the journal of an aggregate by VerifyHashChain.
+type HashChainVerification struct {
+	// Verified is the number of events whose links are intact.
+	Verified int
+	// Unchained is the number of events written before the hash chain was enabled, which are not verified.
+	Unchained int
+	// BrokenSeqNr is the seqNr of the first event whose link is broken, or 0 if the chain is intact.
+	BrokenSeqNr uint64
+	// Reason describes the broken link.
+	Reason string
+}
+
+// Intact returns true if no link of the hash chain is broken.
+func (v *HashChainVerification) Intact() bool {
+	return v.BrokenSeqNr == 0
+}
+
 // EventSerializer is an interface that serializes and deserializes events.
 type EventSerializer interface {
 	// Serialize serializes the event.
@@ -97,3 +133,43 @@ type IOError struct {
 func NewIOError(message string, cause error) *IOError {
 	return &IOError{EventStoreBaseError{message, cause}}
 }
+
+// PublishError is the error type that occurs when a subscriber fails to handle a persisted event.
+//
+// The event has already been persisted when this error is returned.
+type PublishError struct {
+	EventStoreBaseError
+}
+
+// NewPublishError is the constructor of PublishError.
+func NewPublishError(message string, cause error) *PublishError {
+	return &PublishError{EventStoreBaseError{message, cause}}
+}
+
+// WrapIOError wraps the error in an IOError unless it is already an error of this package, or returns nil if it is nil.
+func WrapIOError(message string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var optimisticLockError *OptimisticLockError
+	var serializationError *SerializationError
+	var deserializationError *DeserializationError
+	var ioError *IOError
+	var tenantIsolationError *TenantIsolationError
+	if errors.As(err, &optimisticLockError) || errors.As(err, &serializationError) ||
+		errors.As(err, &deserializationError) || errors.As(err, &ioError) || errors.As(err, &tenantIsolationError) {
+		return err
+	}
+	return NewIOError(message, err)
+}
+
+// TenantIsolationError is the error type that occurs when the tenant of a read or write can not be resolved
+// or differs from the tenant of the aggregate.
+type TenantIsolationError struct {
+	EventStoreBaseError
+}
+
+// NewTenantIsolationError is the constructor of TenantIsolationError.
+func NewTenantIsolationError(message string) *TenantIsolationError {
+	return &TenantIsolationError{EventStoreBaseError{message, nil}}
+}
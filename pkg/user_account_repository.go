@@ -2,7 +2,9 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 )
 
 type UserAccountRepository interface {
@@ -13,25 +15,68 @@ type UserAccountRepository interface {
 
 type userAccountRepository struct {
 	eventStore EventStore
+	logger     *slog.Logger
 }
 
-func NewUserAccountRepository(eventStore EventStore) *userAccountRepository {
-	return &userAccountRepository{
+// UserAccountRepositoryOption is an option for NewUserAccountRepository.
+type UserAccountRepositoryOption func(*userAccountRepository)
+
+// WithUserAccountRepositoryLogger sets the logger of the repository.
+//
+// - The repository logs conflicts and failures of stores and the number of events replayed by FindById.
+// - The default logs nothing.
+func WithUserAccountRepositoryLogger(logger *slog.Logger) UserAccountRepositoryOption {
+	return func(r *userAccountRepository) {
+		if logger != nil {
+			r.logger = logger
+		}
+	}
+}
+
+func NewUserAccountRepository(eventStore EventStore, options ...UserAccountRepositoryOption) *userAccountRepository {
+	r := &userAccountRepository{
 		eventStore: eventStore,
+		logger:     newDiscardLogger(),
+	}
+	for _, option := range options {
+		option(r)
 	}
+	return r
 }
 
 func (r *userAccountRepository) StoreEvent(ctx context.Context, event Event, version uint64) error {
-	return r.eventStore.PersistEvent(ctx, event, version)
+	err := r.eventStore.PersistEvent(ctx, event, version)
+	r.logStore(ctx, event, err)
+	return err
 }
 
 func (r *userAccountRepository) StoreEventAndSnapshot(ctx context.Context, event Event, aggregate Aggregate) error {
-	return r.eventStore.PersistEventAndSnapshot(ctx, event, aggregate)
+	err := r.eventStore.PersistEventAndSnapshot(ctx, event, aggregate)
+	r.logStore(ctx, event, err)
+	return err
+}
+
+// logStore logs the failure of storing the event, at the info level for a conflict.
+func (r *userAccountRepository) logStore(ctx context.Context, event Event, err error) {
+	if err == nil {
+		return
+	}
+	level := slog.LevelError
+	var optimisticLockError *OptimisticLockError
+	if errors.As(err, &optimisticLockError) {
+		level = slog.LevelInfo
+	}
+	r.logger.LogAttrs(ctx, level, "failed to store the event",
+		slog.String("aid", event.GetAggregateId().AsString()),
+		slog.Uint64("seq_nr", event.GetSeqNr()),
+		slog.String("type_name", event.GetTypeName()),
+		slog.Any("error", err))
 }
 
 func (r *userAccountRepository) FindById(ctx context.Context, id AggregateId) (*UserAccount, error) {
 	result, err := r.eventStore.GetLatestSnapshotById(ctx, id)
 	if err != nil {
+		r.logger.LogAttrs(ctx, slog.LevelError, "failed to get the snapshot", slog.String("aid", id.AsString()), slog.Any("error", err))
 		return nil, err
 	}
 	if result.Empty() {
@@ -40,7 +85,12 @@ func (r *userAccountRepository) FindById(ctx context.Context, id AggregateId) (*
 
 	events, err := r.eventStore.GetEventsByIdSinceSeqNr(ctx, id, result.Aggregate().GetSeqNr()+1)
 	if err != nil {
+		r.logger.LogAttrs(ctx, slog.LevelError, "failed to get the events", slog.String("aid", id.AsString()), slog.Any("error", err))
 		return nil, err
 	}
+	r.logger.LogAttrs(ctx, slog.LevelDebug, "replayed the user account",
+		slog.String("aid", id.AsString()),
+		slog.Uint64("snapshot_seq_nr", result.Aggregate().GetSeqNr()),
+		slog.Int("events", len(events)))
 	return replayUserAccount(events, result.Aggregate().(*UserAccount)), nil
 }
@@ -0,0 +1,40 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/common"
+)
+
+func Test_CheckpointStoreOnDynamoDB(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateCheckpointTable(t, ctx, dynamodbClient, "checkpoint")
+	require.Nil(t, err)
+
+	checkpointStore, err := pkg.NewCheckpointStoreOnDynamoDB(dynamodbClient, "checkpoint")
+	require.Nil(t, err)
+
+	checkpoint, err := checkpointStore.GetCheckpoint(ctx, "subscription")
+	require.Nil(t, err)
+	assert.Equal(t, "", checkpoint)
+
+	err = checkpointStore.SaveCheckpoint(ctx, "subscription", "00000000000000000001")
+	require.Nil(t, err)
+	checkpoint, err = checkpointStore.GetCheckpoint(ctx, "subscription")
+	require.Nil(t, err)
+	assert.Equal(t, "00000000000000000001", checkpoint)
+
+	err = checkpointStore.DeleteCheckpoint(ctx, "subscription")
+	require.Nil(t, err)
+	checkpoint, err = checkpointStore.GetCheckpoint(ctx, "subscription")
+	require.Nil(t, err)
+	assert.Equal(t, "", checkpoint)
+}
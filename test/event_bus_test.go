@@ -0,0 +1,238 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+func Test_EventBus_PublishesPersistedEventsToFilteredSubscribers(t *testing.T) {
+	ctx := context.Background()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+	eventStore := pkg.NewPublishingEventStore(pkg.NewEventStoreOnMemory(), eventBus)
+
+	var all, renamed []string
+	_, err = eventBus.Subscribe(func(_ context.Context, event pkg.Event) error {
+		all = append(all, event.GetId())
+		return nil
+	}, pkg.WithEventFilter(pkg.FilterByAggregateTypeName("UserAccountId")))
+	require.Nil(t, err)
+	_, err = eventBus.Subscribe(func(_ context.Context, event pkg.Event) error {
+		renamed = append(renamed, event.GetId())
+		return nil
+	}, pkg.WithEventFilter(pkg.FilterByEventTypeName("UserAccountNameChanged")))
+	require.Nil(t, err)
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{userAccountCreated.GetId(), updated.Event.GetId()}, all)
+	assert.Equal(t, []string{updated.Event.GetId()}, renamed)
+}
+
+func Test_EventBus_DoesNotPublishFailedWrites(t *testing.T) {
+	ctx := context.Background()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+	eventStore := pkg.NewPublishingEventStore(pkg.NewEventStoreOnMemory(), eventBus)
+
+	count := 0
+	_, err = eventBus.Subscribe(func(context.Context, pkg.Event) error {
+		count++
+		return nil
+	})
+	require.Nil(t, err)
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version+1)
+	var optimisticLockError *pkg.OptimisticLockError
+	require.True(t, errors.As(err, &optimisticLockError))
+
+	assert.Equal(t, 1, count)
+}
+
+func Test_EventBus_ErrorPolicies(t *testing.T) {
+	ctx := context.Background()
+	var reported []error
+	eventBus, err := pkg.NewEventBus(pkg.WithEventBusErrorHandler(func(_ context.Context, _ pkg.Event, err error) {
+		reported = append(reported, err)
+	}))
+	require.Nil(t, err)
+
+	reportErr := errors.New("report")
+	_, err = eventBus.Subscribe(func(context.Context, pkg.Event) error {
+		return reportErr
+	})
+	require.Nil(t, err)
+	returnErr := errors.New("return")
+	_, err = eventBus.Subscribe(func(context.Context, pkg.Event) error {
+		return returnErr
+	}, pkg.WithPublishErrorPolicy(pkg.PublishErrorPolicyReturn))
+	require.Nil(t, err)
+
+	_, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventBus.Publish(ctx, userAccountCreated)
+	var publishError *pkg.PublishError
+	require.True(t, errors.As(err, &publishError))
+	assert.Equal(t, returnErr, publishError.Cause)
+	assert.Equal(t, []error{reportErr}, reported)
+}
+
+func Test_EventBus_AsyncSubscriberDrainsOnUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+
+	var mu sync.Mutex
+	var received []string
+	subscription, err := eventBus.Subscribe(func(_ context.Context, event pkg.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, event.GetId())
+		return nil
+	}, pkg.WithAsync(16))
+	require.Nil(t, err)
+
+	var expected []string
+	for _, id := range []string{"1", "2", "3"} {
+		_, userAccountCreated := newUserAccount(newUserAccountId(id), "test")
+		expected = append(expected, userAccountCreated.GetId())
+		err = eventBus.Publish(ctx, userAccountCreated)
+		require.Nil(t, err)
+	}
+	subscription.Unsubscribe()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, expected, received)
+}
+
+func Test_EventBus_SubscriberCanUnsubscribeDuringPublish(t *testing.T) {
+	ctx := context.Background()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+
+	count := 0
+	var subscription *pkg.EventSubscription
+	subscription, err = eventBus.Subscribe(func(context.Context, pkg.Event) error {
+		count++
+		subscription.Unsubscribe()
+		_, err := eventBus.Subscribe(func(context.Context, pkg.Event) error { return nil })
+		return err
+	})
+	require.Nil(t, err)
+
+	_, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventBus.Publish(ctx, userAccountCreated)
+	require.Nil(t, err)
+	err = eventBus.Publish(ctx, userAccountCreated)
+	require.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func Test_EventBus_AsyncSubscriberCanUnsubscribeItself(t *testing.T) {
+	ctx := context.Background()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+
+	var mu sync.Mutex
+	var received []string
+	unsubscribed := make(chan struct{})
+	var subscription *pkg.EventSubscription
+	subscription, err = eventBus.Subscribe(func(_ context.Context, event pkg.Event) error {
+		mu.Lock()
+		received = append(received, event.GetId())
+		first := len(received) == 1
+		mu.Unlock()
+		if first {
+			subscription.Unsubscribe()
+			close(unsubscribed)
+		}
+		return nil
+	}, pkg.WithAsync(16))
+	require.Nil(t, err)
+
+	_, created1 := newUserAccount(newUserAccountId("1"), "test")
+	_, created2 := newUserAccount(newUserAccountId("2"), "test")
+	require.Nil(t, eventBus.Publish(ctx, created1))
+	require.Nil(t, eventBus.Publish(ctx, created2))
+	select {
+	case <-unsubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unsubscribe called by the subscriber did not return")
+	}
+
+	// The events buffered before Unsubscribe are still handled.
+	eventBus.Close()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_PublishingEventStore_ReturnsPublishErrorWhenEnqueueIsCanceled(t *testing.T) {
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+	release := make(chan struct{})
+	_, err = eventBus.Subscribe(func(context.Context, pkg.Event) error {
+		<-release
+		return nil
+	}, pkg.WithAsync(1))
+	require.Nil(t, err)
+	defer func() {
+		close(release)
+		eventBus.Close()
+	}()
+	underlying := pkg.NewEventStoreOnMemory()
+	eventStore := pkg.NewPublishingEventStore(underlying, eventBus)
+
+	// The first event is taken by the blocked subscriber, and the second fills the buffer.
+	ctx := context.Background()
+	for _, id := range []string{"1", "2"} {
+		initial, userAccountCreated := newUserAccount(newUserAccountId(id), "test")
+		require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+	}
+	canceled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	id := newUserAccountId("3")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	err = eventStore.PersistEventAndSnapshot(canceled, userAccountCreated, initial)
+	var publishError *pkg.PublishError
+	assert.True(t, errors.As(err, &publishError))
+
+	// The event is stored but not published.
+	events, err := underlying.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+}
+
+func Test_PublishingEventStore_ForwardsEventTypeReader(t *testing.T) {
+	ctx := context.Background()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+	eventStore := pkg.NewPublishingEventStore(pkg.NewEventStoreOnMemory(), eventBus)
+	persistRenames(t, ctx, eventStore, newUserAccountId("1"), "test")
+
+	reader, ok := eventStore.(pkg.EventTypeReader)
+	require.True(t, ok)
+	events, err := reader.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountCreated", 0, ^uint64(0))
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+}
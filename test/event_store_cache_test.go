@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+)
+
+// countReads wraps the EventStore in a middleware counting the reads that reach it.
+func countReads(eventStore pkg.EventStore, reads *atomic.Int64) pkg.EventStore {
+	return pkg.ChainEventStore(eventStore, pkg.HooksMiddleware(pkg.EventStoreHooks{
+		BeforeRead: func(context.Context, pkg.AggregateId) error {
+			reads.Add(1)
+			return nil
+		},
+	}))
+}
+
+// loadUserAccount replays the user account from its latest snapshot and the events after it.
+func loadUserAccount(t *testing.T, ctx context.Context, eventStore pkg.EventStore, id userAccountId) *userAccount {
+	result, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	require.False(t, result.Empty())
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, result.Aggregate().GetSeqNr()+1)
+	require.Nil(t, err)
+	return replayUserAccount(events, result.Aggregate().(*userAccount))
+}
+
+func Test_CachingEventStore_AvoidsRepeatReads(t *testing.T) {
+	ctx := context.Background()
+	var reads atomic.Int64
+	eventStore, err := pkg.NewCachingEventStore(countReads(pkg.NewEventStoreOnMemory(), &reads), 10, 0)
+	require.Nil(t, err)
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "test2")
+	eventStore.Invalidate(&id)
+
+	first := loadUserAccount(t, ctx, eventStore, id)
+	assert.Equal(t, int64(2), reads.Load())
+	second := loadUserAccount(t, ctx, eventStore, id)
+	assert.Equal(t, int64(2), reads.Load())
+	assert.Equal(t, first, second)
+	assert.Equal(t, "test2", second.Name)
+	assert.Equal(t, uint64(2), second.Version)
+}
+
+func Test_CachingEventStore_UpdatesOnWrite(t *testing.T) {
+	ctx := context.Background()
+	var reads atomic.Int64
+	eventStore, err := pkg.NewCachingEventStore(countReads(pkg.NewEventStoreOnMemory(), &reads), 10, 0)
+	require.Nil(t, err)
+
+	id := newUserAccountId("1")
+	current := persistRenames(t, ctx, eventStore, id, "test2")
+	renamed, err := current.Rename("test3")
+	require.Nil(t, err)
+	require.Nil(t, eventStore.PersistEvent(ctx, renamed.Event, current.Version))
+
+	loaded := loadUserAccount(t, ctx, eventStore, id)
+	assert.Equal(t, int64(0), reads.Load())
+	assert.Equal(t, "test3", loaded.Name)
+	assert.Equal(t, uint64(3), loaded.Version)
+	assert.Equal(t, uint64(3), loaded.SeqNr)
+}
+
+func Test_CachingEventStore_InvalidatesOnOptimisticLockError(t *testing.T) {
+	ctx := context.Background()
+	var reads atomic.Int64
+	underlying := pkg.NewEventStoreOnMemory()
+	eventStore, err := pkg.NewCachingEventStore(countReads(underlying, &reads), 10, 0)
+	require.Nil(t, err)
+	other, err := pkg.NewCachingEventStore(underlying, 10, 0)
+	require.Nil(t, err)
+
+	id := newUserAccountId("1")
+	current := persistRenames(t, ctx, eventStore, id)
+
+	// Another instance writes, so the entry of eventStore is stale.
+	renamedByOther, err := current.Rename("other")
+	require.Nil(t, err)
+	require.Nil(t, other.PersistEventAndSnapshot(ctx, renamedByOther.Event, renamedByOther.Aggregate))
+
+	renamed, err := current.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEventAndSnapshot(ctx, renamed.Event, renamed.Aggregate)
+	var optimisticLockError *pkg.OptimisticLockError
+	require.True(t, errors.As(err, &optimisticLockError))
+
+	loaded := loadUserAccount(t, ctx, eventStore, id)
+	assert.Equal(t, int64(2), reads.Load())
+	assert.Equal(t, "other", loaded.Name)
+	assert.Equal(t, uint64(2), loaded.Version)
+}
+
+func Test_CachingEventStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	var reads atomic.Int64
+	eventStore, err := pkg.NewCachingEventStore(countReads(pkg.NewEventStoreOnMemory(), &reads), 2, 0)
+	require.Nil(t, err)
+
+	id1, id2, id3 := newUserAccountId("1"), newUserAccountId("2"), newUserAccountId("3")
+	persistRenames(t, ctx, eventStore, id1)
+	persistRenames(t, ctx, eventStore, id2)
+	loadUserAccount(t, ctx, eventStore, id1)
+	persistRenames(t, ctx, eventStore, id3)
+	assert.Equal(t, 2, eventStore.Len())
+
+	// id2 is the least recently used, so it was evicted by id3.
+	loadUserAccount(t, ctx, eventStore, id1)
+	loadUserAccount(t, ctx, eventStore, id3)
+	assert.Equal(t, int64(0), reads.Load())
+	loadUserAccount(t, ctx, eventStore, id2)
+	assert.Equal(t, int64(2), reads.Load())
+}
+
+func Test_CachingEventStore_ExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	var reads atomic.Int64
+	eventStore, err := pkg.NewCachingEventStore(countReads(pkg.NewEventStoreOnMemory(), &reads), 10, 50*time.Millisecond)
+	require.Nil(t, err)
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id)
+	loadUserAccount(t, ctx, eventStore, id)
+	assert.Equal(t, int64(0), reads.Load())
+
+	time.Sleep(100 * time.Millisecond)
+	loadUserAccount(t, ctx, eventStore, id)
+	assert.Equal(t, int64(2), reads.Load())
+}
+
+func Test_NewCachingEventStore_RejectsInvalidArguments(t *testing.T) {
+	_, err := pkg.NewCachingEventStore(nil, 10, 0)
+	assert.NotNil(t, err)
+	_, err = pkg.NewCachingEventStore(pkg.NewEventStoreOnMemory(), 0, 0)
+	assert.NotNil(t, err)
+	_, err = pkg.NewCachingEventStore(pkg.NewEventStoreOnMemory(), 10, -time.Second)
+	assert.NotNil(t, err)
+}
+
+func Test_CachingEventStore_Conformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T, _ pkg.EventConverter, _ pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		underlying, err := pkg.NewEventStoreOnMemoryWithOptions(options...)
+		require.Nil(t, err)
+		eventStore, err := pkg.NewCachingEventStore(underlying, 10, 0)
+		require.Nil(t, err)
+		return eventStore
+	}, eventstoretest.WithoutSerialization())
+}
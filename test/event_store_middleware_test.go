@@ -0,0 +1,216 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+)
+
+func Test_ChainEventStore_RunsMiddlewaresInOrder(t *testing.T) {
+	ctx := context.Background()
+	var calls []string
+	recording := func(name string) pkg.EventStoreMiddleware {
+		return pkg.HooksMiddleware(pkg.EventStoreHooks{
+			BeforeRead: func(context.Context, pkg.AggregateId) error {
+				calls = append(calls, "before "+name)
+				return nil
+			},
+			AfterGetLatestSnapshotById: func(_ context.Context, _ pkg.AggregateId, _ *pkg.AggregateResult, err error) error {
+				calls = append(calls, "after "+name)
+				return err
+			},
+		})
+	}
+	eventStore := pkg.ChainEventStore(pkg.NewEventStoreOnMemory(), recording("outer"), recording("inner"))
+
+	id := newUserAccountId("1")
+	_, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"before outer", "before inner", "after inner", "after outer"}, calls)
+}
+
+func Test_HooksMiddleware_VetoesWrite(t *testing.T) {
+	ctx := context.Background()
+	errForbidden := errors.New("forbidden")
+	underlying := pkg.NewEventStoreOnMemory()
+	eventStore := pkg.ChainEventStore(underlying, pkg.HooksMiddleware(pkg.EventStoreHooks{
+		BeforeWrite: func(_ context.Context, event pkg.Event, aggregate pkg.Aggregate, _ uint64) error {
+			if aggregate != nil && aggregate.(*userAccount).Name == "forbidden" {
+				return errForbidden
+			}
+			return nil
+		},
+	}))
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+	renamed, err := initial.Rename("forbidden")
+	require.Nil(t, err)
+	err = eventStore.PersistEventAndSnapshot(ctx, renamed.Event, renamed.Aggregate)
+	assert.ErrorIs(t, err, errForbidden)
+
+	// The vetoed event does not reach the underlying EventStore.
+	events, err := underlying.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+}
+
+func Test_HooksMiddleware_InspectsAndReplacesReadResults(t *testing.T) {
+	ctx := context.Background()
+	errUnexpected := errors.New("unexpected event")
+	var inspected []pkg.Event
+	eventStore := pkg.ChainEventStore(pkg.NewEventStoreOnMemory(), pkg.HooksMiddleware(pkg.EventStoreHooks{
+		AfterGetEventsByIdSinceSeqNr: func(_ context.Context, _ pkg.AggregateId, events []pkg.Event, err error) error {
+			inspected = append(inspected, events...)
+			for _, event := range events {
+				if event.GetTypeName() == "UserAccountNameChanged" {
+					return errUnexpected
+				}
+			}
+			return err
+		},
+	}))
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+
+	renamed, err := initial.Rename("test2")
+	require.Nil(t, err)
+	require.Nil(t, eventStore.PersistEvent(ctx, renamed.Event, initial.Version))
+	_, err = eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	assert.ErrorIs(t, err, errUnexpected)
+	assert.Len(t, inspected, 3)
+}
+
+func Test_HooksMiddleware_PassesThroughEventTypeReader(t *testing.T) {
+	ctx := context.Background()
+	eventStore := pkg.ChainEventStore(pkg.NewEventStoreOnMemory(), pkg.HooksMiddleware(pkg.EventStoreHooks{}))
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+
+	reader, ok := eventStore.(pkg.EventTypeReader)
+	require.True(t, ok)
+	events, err := reader.GetEventsByTypeNameAndOccurredAt(ctx, userAccountCreated.GetTypeName(), 0, math.MaxUint64)
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+}
+
+func Test_ChainEventStore_Conformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T, _ pkg.EventConverter, _ pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		eventStore, err := pkg.NewEventStoreOnMemoryWithOptions(options...)
+		require.Nil(t, err)
+		return pkg.ChainEventStore(eventStore,
+			pkg.TracingMiddleware(nil),
+			pkg.HooksMiddleware(pkg.EventStoreHooks{}))
+	}, eventstoretest.WithoutSerialization())
+}
+
+func Test_HooksMiddleware_VetoesLimitedAndTypeNameReads(t *testing.T) {
+	ctx := context.Background()
+	errForbidden := errors.New("forbidden")
+	underlying := pkg.NewEventStoreOnMemory()
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	require.Nil(t, underlying.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+
+	var inspected []pkg.Event
+	eventStore := pkg.ChainEventStore(underlying, pkg.HooksMiddleware(pkg.EventStoreHooks{
+		BeforeRead: func(context.Context, pkg.AggregateId) error {
+			return errForbidden
+		},
+		BeforeReadByTypeName: func(context.Context, string, uint64, uint64) error {
+			return errForbidden
+		},
+	}))
+	_, err := eventStore.(pkg.LimitedEventReader).GetEventsByIdSinceSeqNrWithLimit(ctx, &id, 0, 1)
+	assert.ErrorIs(t, err, errForbidden)
+	_, err = eventStore.(pkg.EventTypeReader).GetEventsByTypeNameAndOccurredAt(ctx, userAccountCreated.GetTypeName(), 0, math.MaxUint64)
+	assert.ErrorIs(t, err, errForbidden)
+
+	// The events read through the AggregateEventFeed are vetoed too.
+	_, err = pkg.NewAggregateEventFeed(eventStore, &id).ReadEvents(ctx, "", 1)
+	assert.ErrorIs(t, err, errForbidden)
+
+	eventStore = pkg.ChainEventStore(underlying, pkg.HooksMiddleware(pkg.EventStoreHooks{
+		AfterGetEventsByIdSinceSeqNr: func(_ context.Context, _ pkg.AggregateId, events []pkg.Event, err error) error {
+			inspected = append(inspected, events...)
+			return err
+		},
+		AfterGetEventsByTypeNameAndOccurredAt: func(_ context.Context, _ string, events []pkg.Event, err error) error {
+			inspected = append(inspected, events...)
+			return err
+		},
+	}))
+	_, err = eventStore.(pkg.LimitedEventReader).GetEventsByIdSinceSeqNrWithLimit(ctx, &id, 0, 1)
+	require.Nil(t, err)
+	_, err = eventStore.(pkg.EventTypeReader).GetEventsByTypeNameAndOccurredAt(ctx, userAccountCreated.GetTypeName(), 0, math.MaxUint64)
+	require.Nil(t, err)
+	assert.Len(t, inspected, 2)
+}
+
+func Test_Decorators_ForwardBatchAggregateReader(t *testing.T) {
+	ctx := context.Background()
+	underlying := pkg.NewEventStoreOnMemory()
+	id1 := newUserAccountId("1")
+	current := persistRenames(t, ctx, underlying, id1, "test2")
+	renamed, err := current.Rename("test3")
+	require.Nil(t, err)
+	require.Nil(t, underlying.PersistEvent(ctx, renamed.Event, current.Version))
+	id2 := newUserAccountId("2")
+
+	caching, err := pkg.NewCachingEventStore(underlying, 16, time.Minute)
+	require.Nil(t, err)
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+	errForbidden := errors.New("forbidden")
+	hooked := pkg.ChainEventStore(underlying, pkg.HooksMiddleware(pkg.EventStoreHooks{
+		BeforeRead: func(_ context.Context, aggregateId pkg.AggregateId) error {
+			if aggregateId.AsString() == id2.AsString() {
+				return errForbidden
+			}
+			return nil
+		},
+	}))
+	eventStores := map[string]pkg.EventStore{
+		"caching":    caching,
+		"tracing":    pkg.NewTracingEventStore(underlying, nil),
+		"publishing": pkg.NewPublishingEventStore(underlying, eventBus),
+		"hooked":     hooked,
+	}
+	for name, eventStore := range eventStores {
+		t.Run(name, func(t *testing.T) {
+			reader, ok := eventStore.(pkg.BatchAggregateReader)
+			require.True(t, ok)
+			results, err := reader.GetLatestSnapshotsByIds(ctx, []pkg.AggregateId{&id1, &id2, &id1})
+			require.Nil(t, err)
+			require.Len(t, results, 3)
+			for _, i := range []int{0, 2} {
+				require.Nil(t, results[i].Err)
+				assert.Equal(t, id1.AsString(), results[i].AggregateId.AsString())
+				assert.Equal(t, "test2", results[i].Snapshot.Aggregate().(*userAccount).Name)
+				require.Len(t, results[i].Events, 1)
+				assert.Equal(t, renamed.Event.GetId(), results[i].Events[0].GetId())
+			}
+			if name == "hooked" {
+				assert.ErrorIs(t, results[1].Err, errForbidden)
+			} else {
+				require.Nil(t, results[1].Err)
+				assert.True(t, results[1].Snapshot.Empty())
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/bolt"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+	"go.etcd.io/bbolt"
+)
+
+func openBoltEventStore(t *testing.T, path string, options ...pkg.EventStoreOption) *bolt.EventStore {
+	eventStore, err := bolt.NewEventStore(path, 4, userAccountEventConverter, userAccountSnapshotConverter, options...)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = eventStore.Close()
+	})
+	return eventStore
+}
+
+func Test_EventStoreOnBolt_WriteAndRead(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "event_store.db")
+	eventStore := openBoltEventStore(t, path)
+
+	id := newUserAccountId("1")
+	var names []string
+	for i := 0; i < 11; i++ {
+		names = append(names, fmt.Sprintf("name%d", i))
+	}
+	current := persistRenames(t, ctx, eventStore, id, names...)
+	// An aggregate whose skeys share the prefix of the first one.
+	persistRenames(t, ctx, eventStore, newUserAccountId("1-1"), "other")
+	require.Nil(t, eventStore.Close())
+
+	eventStore = openBoltEventStore(t, path)
+	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	require.True(t, snapshotResult.Present())
+	assert.Equal(t, current.GetVersion(), snapshotResult.Aggregate().GetVersion())
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	require.Len(t, events, 12)
+	for i, event := range events {
+		assert.Equal(t, uint64(i+1), event.GetSeqNr())
+	}
+
+	events, err = eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 11)
+	require.Nil(t, err)
+	assert.Len(t, events, 2)
+
+	created, err := eventStore.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountCreated", 0, ^uint64(0))
+	require.Nil(t, err)
+	require.Len(t, created, 2)
+	for _, event := range created {
+		assert.Equal(t, "UserAccountCreated", event.GetTypeName())
+	}
+}
+
+func Test_EventStoreOnBolt_RejectsExistingKeptSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "event_store.db")
+	eventStore := openBoltEventStore(t, path, pkg.WithKeepSnapshot(true))
+
+	id := newUserAccountId("1")
+	initial := persistRenames(t, ctx, eventStore, id)
+	result, err := initial.Rename("a")
+	require.Nil(t, err)
+	// The snapshot of the initial seqNr is already kept.
+	err = eventStore.PersistEventAndSnapshot(ctx, result.Event, initial)
+	var optimisticLockError *pkg.OptimisticLockError
+	assert.True(t, errors.As(err, &optimisticLockError), "%v", err)
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+}
+
+func Test_EventStoreOnBolt_KeepSnapshotCount(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "event_store.db")
+	eventStore := openBoltEventStore(t, path,
+		pkg.WithKeepSnapshot(true),
+		pkg.WithKeepSnapshotCount(2))
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a", "b", "c")
+
+	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	assert.Equal(t, "c", snapshotResult.Aggregate().(*userAccount).Name)
+	assert.Equal(t, uint64(4), snapshotResult.Aggregate().GetVersion())
+	require.Nil(t, eventStore.Close())
+
+	db, err := bbolt.Open(path, 0o600, nil)
+	require.Nil(t, err)
+	defer db.Close()
+	count := 0
+	err = db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("snapshot")).ForEachBucket(func(pkey []byte) error {
+			count += tx.Bucket([]byte("snapshot")).Bucket(pkey).Stats().KeyN
+			return nil
+		})
+	})
+	require.Nil(t, err)
+	// The latest snapshot and the two kept snapshots.
+	assert.Equal(t, 3, count)
+}
+
+func Test_EventStoreOnBolt_Conformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		path := filepath.Join(t.TempDir(), "event_store.db")
+		eventStore, err := bolt.NewEventStore(path, 4, eventConverter, snapshotConverter, options...)
+		require.Nil(t, err)
+		t.Cleanup(func() {
+			_ = eventStore.Close()
+		})
+		return eventStore
+	})
+}
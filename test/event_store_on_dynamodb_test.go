@@ -2,14 +2,18 @@ package test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
-	"time"
 
 	"github.com/szks-repo/event-store-adapter-go/pkg"
 	"github.com/szks-repo/event-store-adapter-go/pkg/common"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
@@ -39,10 +43,7 @@ func Test_EventStoreOnDynamoDB_NewWithValidParameters(t *testing.T) {
 	}
 }
 
-func Test_EventStoreOnDynamoDB_WriteAndRead(t *testing.T) {
-	// Given
-	ctx := context.Background()
-
+func runLocalStackContainer(t *testing.T, ctx context.Context) *localstack.LocalStackContainer {
 	container, err := localstack.RunContainer(
 		ctx,
 		testcontainers.CustomizeRequest(testcontainers.GenericContainerRequest{
@@ -58,67 +59,27 @@ func Test_EventStoreOnDynamoDB_WriteAndRead(t *testing.T) {
 			},
 		}),
 	)
-	assert.NotNil(t, container)
 	require.Nil(t, err)
+	require.NotNil(t, container)
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Fatalf("failed to terminate container: %s", err.Error())
+		}
+	})
+	return container
+}
+
+func Test_EventStoreOnDynamoDB_GetEventsByTypeNameAndOccurredAt(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
 
 	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
-	assert.NotNil(t, dynamodbClient)
 	require.Nil(t, err)
-
-	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	err = common.CreateJournalTableWithTypeIndex(t, ctx, dynamodbClient, "journal", "journal-aid-index", "journal-type-index")
 	require.Nil(t, err)
-
 	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
 	require.Nil(t, err)
 
-	// When
-	snapshotConverter := func(m map[string]interface{}) (pkg.Aggregate, error) {
-		idMap, ok := m["Id"].(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("Id is not a map")
-		}
-		value, ok := idMap["Value"].(string)
-		if !ok {
-			return nil, fmt.Errorf("Value is not a float64")
-		}
-		userAccountId := newUserAccountId(value)
-		result, _ := newUserAccount(userAccountId, m["Name"].(string))
-		return result, nil
-	}
-
-	eventConverter := func(m map[string]interface{}) (pkg.Event, error) {
-		aggregateMap, ok := m["AggregateId"].(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("AggregateId is not a map")
-		}
-		aggregateId, ok := aggregateMap["Value"].(string)
-		if !ok {
-			return nil, fmt.Errorf("Value is not a float64")
-		}
-		switch m["TypeName"].(string) {
-		case "UserAccountCreated":
-			userAccountId := newUserAccountId(aggregateId)
-			return newUserAccountCreated(
-				m["Id"].(string),
-				&userAccountId,
-				uint64(m["SeqNr"].(float64)),
-				m["Name"].(string),
-				uint64(m["OccurredAt"].(float64)),
-			), nil
-		case "UserAccountNameChanged":
-			userAccountId := newUserAccountId(aggregateId)
-			return newUserAccountNameChanged(
-				m["Id"].(string),
-				&userAccountId,
-				uint64(m["SeqNr"].(float64)),
-				m["Name"].(string),
-				uint64(m["OccurredAt"].(float64)),
-			), nil
-		default:
-			return nil, fmt.Errorf("unknown event type")
-		}
-	}
-
 	eventStore, err := pkg.NewEventStoreOnDynamoDB(
 		dynamodbClient,
 		"journal",
@@ -126,150 +87,487 @@ func Test_EventStoreOnDynamoDB_WriteAndRead(t *testing.T) {
 		"journal-aid-index",
 		"snapshot-aid-index",
 		1,
-		eventConverter,
-		snapshotConverter,
-		pkg.WithKeepSnapshot(true),
-		pkg.WithDeleteTtl(1*time.Second))
-	require.NotNil(t, eventStore)
+		userAccountEventConverter,
+		userAccountSnapshotConverter,
+		pkg.WithJournalTypeIndexName("journal-type-index"))
 	require.Nil(t, err)
 
-	userAccountId1 := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+	require.Nil(t, err)
 
-	initial, userAccountCreated := newUserAccount(userAccountId1, "test")
-	require.NotNil(t, initial)
-	require.NotNil(t, userAccountCreated)
-	t.Logf("initial: %v", initial)
-	t.Logf("userAccountCreated: %v", userAccountCreated)
+	reader, ok := eventStore.(pkg.EventTypeReader)
+	require.True(t, ok)
 
-	err = eventStore.PersistEventAndSnapshot(
-		ctx,
-		userAccountCreated,
-		initial,
-	)
+	events, err := reader.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", 0, math.MaxUint64)
 	require.Nil(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, updated.Event.GetId(), events[0].GetId())
 
-	updated, err := initial.Rename("test2")
-	require.NotNil(t, updated)
+	events, err = reader.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", 0, updated.Event.GetOccurredAt()-1)
 	require.Nil(t, err)
-	t.Logf("updated: %v", updated)
+	assert.Empty(t, events)
+}
 
-	err = eventStore.PersistEvent(
-		ctx,
-		updated.Event,
-		updated.Aggregate.Version,
-	)
+func Test_EventStoreOnDynamoDB_Conformance(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
 	require.Nil(t, err)
 
-	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &userAccountId1)
-	require.NotNil(t, snapshotResult)
+	// Every store gets its own tables, as the container is shared by the cases.
+	tableCount := 0
+	snapshotTableNames := make(map[pkg.EventStore]string)
+	eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		tableCount++
+		journalTableName := fmt.Sprintf("journal-%d", tableCount)
+		snapshotTableName := fmt.Sprintf("snapshot-%d", tableCount)
+		err := common.CreateJournalTable(t, ctx, dynamodbClient, journalTableName, "journal-aid-index")
+		require.Nil(t, err)
+		err = common.CreateSnapshotTable(t, ctx, dynamodbClient, snapshotTableName, "snapshot-aid-index")
+		require.Nil(t, err)
+
+		eventStore, err := pkg.NewEventStoreOnDynamoDB(
+			dynamodbClient,
+			journalTableName,
+			snapshotTableName,
+			"journal-aid-index",
+			"snapshot-aid-index",
+			32,
+			eventConverter,
+			snapshotConverter,
+			options...)
+		require.Nil(t, err)
+		snapshotTableNames[eventStore] = snapshotTableName
+		return eventStore
+	},
+		eventstoretest.WithKeptSnapshotCounter(func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int {
+			output, err := dynamodbClient.Query(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(snapshotTableNames[eventStore]),
+				IndexName:              aws.String("snapshot-aid-index"),
+				KeyConditionExpression: aws.String("#aid = :aid AND #seq_nr > :seq_nr"),
+				ExpressionAttributeNames: map[string]string{
+					"#aid":    "aid",
+					"#seq_nr": "seq_nr",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":aid":    &types.AttributeValueMemberS{Value: aggregateId.AsString()},
+					":seq_nr": &types.AttributeValueMemberN{Value: "0"},
+				},
+			})
+			require.Nil(t, err)
+			return int(output.Count)
+		}),
+		eventstoretest.WithRacingIOErrors())
+}
+
+func Test_EventStoreOnDynamoDB_GetLatestSnapshotsByIds(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
 	require.Nil(t, err)
-	t.Logf("snapshotResult: %v", snapshotResult)
 
-	userAccount1, ok := snapshotResult.Aggregate().(*userAccount)
-	require.NotNil(t, userAccount1)
-	require.NotNil(t, ok)
-	t.Logf("UserAccount: %v", userAccount1)
+	eventStore, err := pkg.NewEventStoreOnDynamoDB(
+		dynamodbClient,
+		"journal",
+		"snapshot",
+		"journal-aid-index",
+		"snapshot-aid-index",
+		4,
+		userAccountEventConverter,
+		userAccountSnapshotConverter,
+		pkg.WithBatchLoadConcurrency(2))
+	require.Nil(t, err)
 
-	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &userAccountId1, userAccount1.GetSeqNr()+1)
-	require.NotNil(t, events)
+	// id1 has an event after its snapshot, id2 has none and id3 does not exist.
+	id1, id2, id3 := newUserAccountId("1"), newUserAccountId("2"), newUserAccountId("3")
+	initial, userAccountCreated := newUserAccount(id1, "test1")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+	renamed, err := initial.Rename("test1-renamed")
 	require.Nil(t, err)
-	t.Logf("Events: %v", events)
+	require.Nil(t, eventStore.PersistEvent(ctx, renamed.Event, initial.Version))
+	persistRenames(t, ctx, eventStore, id2, "test2")
 
-	actual := replayUserAccount(events, snapshotResult.Aggregate().(*userAccount))
-	require.NotNil(t, actual)
-	t.Logf("Actual: %v", actual)
+	reader, ok := eventStore.(pkg.BatchAggregateReader)
+	require.True(t, ok)
+	results, err := reader.GetLatestSnapshotsByIds(ctx, []pkg.AggregateId{&id1, &id2, &id3, &id1})
+	require.Nil(t, err)
+	require.Len(t, results, 4)
+	for _, result := range results {
+		require.Nil(t, result.Err)
+	}
 
-	expect, _ := newUserAccount(userAccountId1, "test2")
-	require.NotNil(t, expect)
+	assert.Equal(t, id1.AsString(), results[0].AggregateId.AsString())
+	loaded1 := replayUserAccount(results[0].Events, results[0].Snapshot.Aggregate().(*userAccount))
+	assert.Equal(t, "test1-renamed", loaded1.Name)
+	assert.Equal(t, uint64(2), results[0].Snapshot.Aggregate().GetVersion())
 
-	// Then
-	assert.True(t, actual.Equals(expect))
+	assert.Equal(t, "test2", results[1].Snapshot.Aggregate().(*userAccount).Name)
+	assert.Empty(t, results[1].Events)
 
-	defer func() {
-		if err := container.Terminate(ctx); err != nil {
-			t.Fatalf("failed to terminate container: %s", err.Error())
-		}
-	}()
+	assert.True(t, results[2].Snapshot.Empty())
+
+	assert.Equal(t, results[0].Snapshot.Aggregate().GetSeqNr(), results[3].Snapshot.Aggregate().GetSeqNr())
+	assert.Len(t, results[3].Events, 1)
 }
 
-// Persists an event and a snapshot for a user account
-func Test_EventStoreOnDynamoDB_PersistsEventAndSnapshot(t *testing.T) {
+func Test_EventStoreOnDynamoDB_ConsistentRead(t *testing.T) {
 	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
 
-	container, err := localstack.RunContainer(
-		ctx,
-		testcontainers.CustomizeRequest(testcontainers.GenericContainerRequest{
-			ContainerRequest: testcontainers.ContainerRequest{
-				Image: "localstack/localstack:2.1.0",
-				Env: map[string]string{
-					"SERVICES":              "dynamodb",
-					"DEFAULT_REGION":        "us-east-1",
-					"EAGER_SERVICE_LOADING": "1",
-					"DYNAMODB_SHARED_DB":    "1",
-					"DYNAMODB_IN_MEMORY":    "1",
-				},
-			},
-		}),
-	)
-	assert.NotNil(t, container)
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
 	require.Nil(t, err)
 
-	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
-	assert.NotNil(t, dynamodbClient)
+	newEventStore := func(options ...pkg.EventStoreOption) pkg.EventStore {
+		eventStore, err := pkg.NewEventStoreOnDynamoDB(
+			dynamodbClient,
+			"journal",
+			"snapshot",
+			"journal-aid-index",
+			"snapshot-aid-index",
+			1,
+			userAccountEventConverter,
+			userAccountSnapshotConverter,
+			options...)
+		require.Nil(t, err)
+		return eventStore
+	}
+
+	// With a single shard, the events of id1 share the pkey with those of the ids whose skeys it prefixes.
+	eventStore := newEventStore()
+	id1, id10, id1x := newUserAccountId("1"), newUserAccountId("10"), newUserAccountId("1-2")
+	persistRenames(t, ctx, eventStore, id10, "test10")
+	persistRenames(t, ctx, eventStore, id1x, "test1x")
+	current := persistRenames(t, ctx, eventStore, id1, "a", "b", "c", "d", "e", "f", "g", "h", "i", "j")
+	renamed, err := current.Rename("k")
 	require.Nil(t, err)
+	require.Nil(t, eventStore.PersistEvent(ctx, renamed.Event, current.Version))
+
+	assertLoaded := func(ctx context.Context, eventStore pkg.EventStore) {
+		result, err := eventStore.GetLatestSnapshotById(ctx, &id1)
+		require.Nil(t, err)
+		snapshot := result.Aggregate().(*userAccount)
+		assert.Equal(t, "j", snapshot.Name)
+		assert.Equal(t, current.Version+1, snapshot.Version)
+
+		events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id1, 2)
+		require.Nil(t, err)
+		require.Len(t, events, 11)
+		for i, event := range events {
+			assert.Equal(t, id1.AsString(), event.GetAggregateId().AsString())
+			assert.Equal(t, uint64(i+2), event.GetSeqNr())
+		}
+	}
+	assertLoaded(pkg.ContextWithConsistentRead(ctx, true), eventStore)
+	assertLoaded(ctx, newEventStore(pkg.WithConsistentRead(true)))
 
+	missing := newUserAccountId("missing")
+	result, err := eventStore.GetLatestSnapshotById(pkg.ContextWithConsistentRead(ctx, true), &missing)
+	require.Nil(t, err)
+	assert.True(t, result.Empty())
+}
+
+func Test_MigrateToSortableSkeys(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
 	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
 	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
+	require.Nil(t, err)
+
+	newEventStore := func(options ...pkg.EventStoreOption) pkg.EventStore {
+		eventStore, err := pkg.NewEventStoreOnDynamoDB(
+			dynamodbClient,
+			"journal",
+			"snapshot",
+			"journal-aid-index",
+			"snapshot-aid-index",
+			1,
+			userAccountEventConverter,
+			userAccountSnapshotConverter,
+			options...)
+		require.Nil(t, err)
+		return eventStore
+	}
+
+	id := newUserAccountId("1")
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
+	persistRenames(t, ctx, newEventStore(), id, names...)
+
+	result, err := pkg.MigrateToSortableSkeys(ctx, dynamodbClient, "journal", true, nil)
+	require.Nil(t, err)
+	assert.Equal(t, pkg.SkeyMigrationResult{Scanned: 12, Migrated: 12}, *result)
+
+	for _, tableName := range []string{"journal", "snapshot"} {
+		_, err := pkg.MigrateToSortableSkeys(ctx, dynamodbClient, tableName, false, nil)
+		require.Nil(t, err)
+	}
+	result, err = pkg.MigrateToSortableSkeys(ctx, dynamodbClient, "journal", false, nil)
+	require.Nil(t, err)
+	assert.Equal(t, pkg.SkeyMigrationResult{Scanned: 12, Skipped: 12}, *result)
 
+	// The migrated store reads the events by an skey range, and keeps writing with the sortable skeys.
+	eventStore := newEventStore(pkg.WithSortableKeyResolver(), pkg.WithConsistentRead(true))
+	snapshot, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	current := snapshot.Aggregate().(*userAccount)
+	assert.Equal(t, "k", current.Name)
+	renamed, err := current.Rename("l")
+	require.Nil(t, err)
+	require.Nil(t, eventStore.PersistEvent(ctx, renamed.Event, current.Version))
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 1)
+	require.Nil(t, err)
+	require.Len(t, events, 13)
+	for i, event := range events {
+		assert.Equal(t, uint64(i+1), event.GetSeqNr())
+	}
+}
+
+func Test_Resharder_ReshardsOnline(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
 	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
 	require.Nil(t, err)
 
-	snapshotConverter := func(m map[string]interface{}) (pkg.Aggregate, error) {
-		idMap, ok := m["Id"].(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("Id is not a map")
-		}
-		value, ok := idMap["Value"].(string)
-		if !ok {
-			return nil, fmt.Errorf("Value is not a float64")
+	newEventStore := func(shardCount uint64) (pkg.EventStore, error) {
+		return pkg.NewEventStoreOnDynamoDB(
+			dynamodbClient,
+			"journal",
+			"snapshot",
+			"journal-aid-index",
+			"snapshot-aid-index",
+			shardCount,
+			userAccountEventConverter,
+			userAccountSnapshotConverter,
+			pkg.WithShardLayoutCheck(ctx))
+	}
+	assertNames := func(eventStore pkg.EventStore, names map[userAccountId]string) {
+		for id, name := range names {
+			id := id
+			result, err := eventStore.GetLatestSnapshotById(ctx, &id)
+			require.Nil(t, err)
+			events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, result.Aggregate().GetSeqNr()+1)
+			require.Nil(t, err)
+			assert.Equal(t, name, replayUserAccount(events, result.Aggregate().(*userAccount)).Name)
 		}
-		userAccountId := newUserAccountId(value)
-		result, _ := newUserAccount(userAccountId, m["Name"].(string))
-		return result, nil
 	}
 
-	eventConverter := func(m map[string]interface{}) (pkg.Event, error) {
-		aggregateMap, ok := m["AggregateId"].(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("AggregateId is not a map")
-		}
-		aggregateId, ok := aggregateMap["Value"].(string)
-		if !ok {
-			return nil, fmt.Errorf("Value is not a float64")
-		}
-		switch m["TypeName"].(string) {
-		case "UserAccountCreated":
-			userAccountId := newUserAccountId(aggregateId)
-			return newUserAccountCreated(
-				m["Id"].(string),
-				&userAccountId,
-				uint64(m["SeqNr"].(float64)),
-				m["Name"].(string),
-				uint64(m["OccurredAt"].(float64)),
-			), nil
-		case "UserAccountNameChanged":
-			userAccountId := newUserAccountId(aggregateId)
-			return newUserAccountNameChanged(
-				m["Id"].(string),
-				&userAccountId,
-				uint64(m["SeqNr"].(float64)),
-				m["Name"].(string),
-				uint64(m["OccurredAt"].(float64)),
-			), nil
-		default:
-			return nil, fmt.Errorf("unknown event type")
+	// The first store records the shard layout, and a store with another shard count refuses to start.
+	eventStore, err := newEventStore(2)
+	require.Nil(t, err)
+	_, err = newEventStore(3)
+	assert.NotNil(t, err)
+
+	names := make(map[userAccountId]string)
+	for i := 0; i < 6; i++ {
+		id := newUserAccountId(fmt.Sprintf("%d", i))
+		names[id] = fmt.Sprintf("name-%d", i)
+		persistRenames(t, ctx, eventStore, id, names[id])
+	}
+
+	resharder, err := pkg.NewResharder(dynamodbClient, "journal", "snapshot", pkg.NewCheckpointStoreOnMemory())
+	require.Nil(t, err)
+	require.Nil(t, resharder.Begin(ctx, 4))
+	assert.NotNil(t, resharder.Begin(ctx, 8))
+	_, err = newEventStore(4)
+	assert.NotNil(t, err)
+
+	// A restarted store reads from both shard layouts and writes to the next one.
+	reshardingStore, err := newEventStore(2)
+	require.Nil(t, err)
+	assertNames(reshardingStore, names)
+	id0 := newUserAccountId("0")
+	result, err := reshardingStore.GetLatestSnapshotById(ctx, &id0)
+	require.Nil(t, err)
+	current := result.Aggregate().(*userAccount)
+	renamed, err := current.Rename("renamed-0")
+	require.Nil(t, err)
+	require.Nil(t, reshardingStore.PersistEvent(ctx, renamed.Event, current.Version))
+	names[id0] = "renamed-0"
+	id6 := newUserAccountId("6")
+	persistRenames(t, ctx, reshardingStore, id6, "name-6")
+	names[id6] = "name-6"
+
+	progress, err := resharder.Copy(ctx)
+	require.Nil(t, err)
+	// The aggregate written by the resharding store may be scanned in both shard layouts.
+	assert.GreaterOrEqual(t, progress.Scanned, 7)
+	progress, err = resharder.Copy(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 0, progress.Scanned)
+	assertNames(reshardingStore, names)
+
+	_, err = resharder.Cutover(ctx)
+	require.Nil(t, err)
+	layout, err := resharder.ShardLayout(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, pkg.ShardLayout{ShardCount: 4}, *layout)
+
+	// The stores with the old shard count refuse to start, and those with the new one read the items through the aid index.
+	_, err = newEventStore(2)
+	assert.NotNil(t, err)
+	reshardedStore, err := newEventStore(4)
+	require.Nil(t, err)
+	assertNames(reshardedStore, names)
+	events, err := reshardedStore.GetEventsByIdSinceSeqNr(ctx, &id0, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 3)
+}
+
+func Test_Resharder_FencesStaleStores(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
+	require.Nil(t, err)
+
+	newEventStore := func(shardCount uint64) (pkg.EventStore, error) {
+		return pkg.NewEventStoreOnDynamoDB(
+			dynamodbClient,
+			"journal",
+			"snapshot",
+			"journal-aid-index",
+			"snapshot-aid-index",
+			shardCount,
+			userAccountEventConverter,
+			userAccountSnapshotConverter,
+			pkg.WithShardLayoutCheck(ctx))
+	}
+	staleStore, err := newEventStore(2)
+	require.Nil(t, err)
+	id := newUserAccountId("1")
+	current := persistRenames(t, ctx, staleStore, id, "name-1")
+
+	resharder, err := pkg.NewResharder(dynamodbClient, "journal", "snapshot", pkg.NewCheckpointStoreOnMemory())
+	require.Nil(t, err)
+	require.Nil(t, resharder.Begin(ctx, 4))
+	_, err = resharder.Copy(ctx)
+	require.Nil(t, err)
+
+	// The store not restarted after Begin fails to write instead of updating the copied items.
+	renamed, err := current.Rename("name-2")
+	require.Nil(t, err)
+	err = staleStore.PersistEventAndSnapshot(ctx, renamed.Event, renamed.Aggregate)
+	var ioError *pkg.IOError
+	assert.True(t, errors.As(err, &ioError))
+
+	// A snapshot updated after it was copied, as by a write racing with Begin, replaces its copy on the cutover.
+	keyResolver := &pkg.DefaultKeyResolver{}
+	_, err = dynamodbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("snapshot"),
+		Key: map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: keyResolver.ResolvePkey(&id, 2)},
+			"skey": &types.AttributeValueMemberS{Value: keyResolver.ResolveSkey(&id, 0)},
+		},
+		UpdateExpression:          aws.String("SET #version = #version + :one"),
+		ExpressionAttributeNames:  map[string]string{"#version": "version"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+	})
+	require.Nil(t, err)
+	_, err = resharder.Cutover(ctx)
+	require.Nil(t, err)
+
+	reshardedStore, err := newEventStore(4)
+	require.Nil(t, err)
+	result, err := reshardedStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	assert.Equal(t, current.Version+1, result.Aggregate().GetVersion())
+	events, err := reshardedStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 2)
+
+	// The stale store fails to write after the cutover as well.
+	err = staleStore.PersistEventAndSnapshot(ctx, renamed.Event, renamed.Aggregate)
+	assert.True(t, errors.As(err, &ioError))
+}
+
+func Test_TenantEventStoreOnDynamoDB(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	for _, prefix := range []string{"shared", "dedicated"} {
+		err = common.CreateJournalTable(t, ctx, dynamodbClient, prefix+"-journal", "journal-aid-index")
+		require.Nil(t, err)
+		err = common.CreateSnapshotTable(t, ctx, dynamodbClient, prefix+"-snapshot", "snapshot-aid-index")
+		require.Nil(t, err)
+	}
+
+	eventStore, err := pkg.NewTenantEventStoreOnDynamoDB(
+		dynamodbClient,
+		func(tenantId string) (string, string) {
+			if tenantId == "dedicated" {
+				return "dedicated-journal", "dedicated-snapshot"
+			}
+			return "shared-journal", "shared-snapshot"
+		},
+		"journal-aid-index",
+		"snapshot-aid-index",
+		1,
+		userAccountEventConverter,
+		userAccountSnapshotConverter)
+	require.Nil(t, err)
+
+	id := newUserAccountId("1")
+	for _, tenantId := range []string{"a", "b", "dedicated"} {
+		persistRenames(t, pkg.ContextWithTenantId(ctx, tenantId), eventStore, id, "test-"+tenantId)
+	}
+	for _, tenantId := range []string{"a", "b", "dedicated"} {
+		loaded := loadUserAccount(t, pkg.ContextWithTenantId(ctx, tenantId), eventStore, id)
+		assert.Equal(t, "test-"+tenantId, loaded.Name)
+		assert.Equal(t, uint64(2), loaded.Version)
+	}
+
+	aids := func(tableName string) []string {
+		result, err := dynamodbClient.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(tableName), ConsistentRead: aws.Bool(true)})
+		require.Nil(t, err)
+		var aids []string
+		for _, item := range result.Items {
+			aids = append(aids, item["aid"].(*types.AttributeValueMemberS).Value)
 		}
+		return aids
 	}
+	assert.ElementsMatch(t, []string{"a#UserAccountId-1", "a#UserAccountId-1", "b#UserAccountId-1", "b#UserAccountId-1"}, aids("shared-journal"))
+	assert.ElementsMatch(t, []string{"dedicated#UserAccountId-1", "dedicated#UserAccountId-1"}, aids("dedicated-journal"))
+}
+
+func Test_EventStoreOnDynamoDB_HashChain(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
+	require.Nil(t, err)
 
 	eventStore, err := pkg.NewEventStoreOnDynamoDB(
 		dynamodbClient,
@@ -278,29 +576,62 @@ func Test_EventStoreOnDynamoDB_PersistsEventAndSnapshot(t *testing.T) {
 		"journal-aid-index",
 		"snapshot-aid-index",
 		1,
-		eventConverter,
-		snapshotConverter,
-		pkg.WithKeepSnapshot(true),
-		pkg.WithDeleteTtl(1*time.Second))
-	require.NotNil(t, eventStore)
+		userAccountEventConverter,
+		userAccountSnapshotConverter,
+		pkg.WithHashChain())
 	require.Nil(t, err)
+	verifier := eventStore.(pkg.HashChainVerifier)
 
-	userAccountId1 := newUserAccountId("1")
-
-	initial, userAccountCreated := newUserAccount(userAccountId1, "test")
-	require.NotNil(t, initial)
-	require.NotNil(t, userAccountCreated)
+	id1, id2 := newUserAccountId("1"), newUserAccountId("2")
+	current := persistRenames(t, ctx, eventStore, id1, "a", "b")
+	renamed, err := current.Rename("c")
+	require.Nil(t, err)
+	require.Nil(t, eventStore.PersistEvent(ctx, renamed.Event, current.Version))
+	persistRenames(t, ctx, eventStore, id2, "a", "b")
 
-	err = eventStore.PersistEventAndSnapshot(
-		ctx,
-		userAccountCreated,
-		initial,
-	)
+	verification, err := verifier.VerifyHashChain(ctx, &id1)
 	require.Nil(t, err)
+	assert.True(t, verification.Intact(), verification.Reason)
+	assert.Equal(t, 4, verification.Verified)
 
-	defer func() {
-		if err := container.Terminate(ctx); err != nil {
-			t.Fatalf("failed to terminate container: %s", err.Error())
+	// A stale version is rejected before the chain is read.
+	stale, err := current.Rename("d")
+	require.Nil(t, err)
+	var optimisticLockError *pkg.OptimisticLockError
+	assert.ErrorAs(t, eventStore.PersistEvent(ctx, stale.Event, current.Version), &optimisticLockError)
+
+	journalKey := func(id userAccountId, seqNr uint64) map[string]types.AttributeValue {
+		resolver := &pkg.DefaultKeyResolver{}
+		return map[string]types.AttributeValue{
+			"pkey": &types.AttributeValueMemberS{Value: resolver.ResolvePkey(&id, 1)},
+			"skey": &types.AttributeValueMemberS{Value: resolver.ResolveSkey(&id, seqNr)},
 		}
-	}()
+	}
+
+	_, err = dynamodbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("journal"),
+		Key:                       journalKey(id1, 2),
+		UpdateExpression:          aws.String("SET #payload = :payload"),
+		ExpressionAttributeNames:  map[string]string{"#payload": "payload"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":payload": &types.AttributeValueMemberB{Value: []byte(`{}`)}},
+	})
+	require.Nil(t, err)
+	verification, err = verifier.VerifyHashChain(ctx, &id1)
+	require.Nil(t, err)
+	assert.False(t, verification.Intact())
+	assert.Equal(t, uint64(2), verification.BrokenSeqNr)
+	assert.Equal(t, 1, verification.Verified)
+
+	_, err = dynamodbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String("journal"), Key: journalKey(id2, 3)})
+	require.Nil(t, err)
+	verification, err = verifier.VerifyHashChain(ctx, &id2)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(3), verification.BrokenSeqNr)
+	assert.Equal(t, 2, verification.Verified)
+
+	missing := newUserAccountId("3")
+	verification, err = verifier.VerifyHashChain(ctx, &missing)
+	require.Nil(t, err)
+	assert.True(t, verification.Intact())
+	assert.Equal(t, 0, verification.Verified)
 }
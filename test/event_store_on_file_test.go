@@ -0,0 +1,234 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+)
+
+func openFileEventStore(t *testing.T, dir string, segmentSize int64, options ...pkg.EventStoreOption) *pkg.EventStoreOnFile {
+	eventStore, err := pkg.NewEventStoreOnFile(dir, 4, segmentSize, userAccountEventConverter, userAccountSnapshotConverter, options...)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = eventStore.Close()
+	})
+	return eventStore
+}
+
+// persistRenames persists the created event and a rename event per name, and returns the last aggregate.
+func persistRenames(t *testing.T, ctx context.Context, eventStore pkg.EventStore, id userAccountId, names ...string) *userAccount {
+	current, userAccountCreated := newUserAccount(id, "test")
+	err := eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, current)
+	require.Nil(t, err)
+	for _, name := range names {
+		result, err := current.Rename(name)
+		require.Nil(t, err)
+		err = eventStore.PersistEventAndSnapshot(ctx, result.Event, result.Aggregate)
+		require.Nil(t, err)
+		result.Aggregate.Version++
+		current = result.Aggregate
+	}
+	return current
+}
+
+func segmentPaths(t *testing.T, dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, "journal", "*", "*.log"))
+	require.Nil(t, err)
+	return paths
+}
+
+func Test_EventStoreOnFile_WriteAndReadAfterReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	eventStore := openFileEventStore(t, dir, 512)
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a", "b", "c", "d")
+	latest, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	updated, err := latest.Aggregate().(*userAccount).Rename("e")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, latest.Aggregate().GetVersion())
+	require.Nil(t, err)
+	require.Nil(t, eventStore.Close())
+	assert.Greater(t, len(segmentPaths(t, dir)), 1)
+
+	eventStore = openFileEventStore(t, dir, 512)
+	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	require.True(t, snapshotResult.Present())
+	snapshot := snapshotResult.Aggregate().(*userAccount)
+	assert.Equal(t, uint64(6), snapshot.GetVersion())
+	assert.Equal(t, "d", snapshot.Name)
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, snapshot.GetSeqNr()+1)
+	require.Nil(t, err)
+	actual := replayUserAccount(events, snapshot)
+	assert.Equal(t, "e", actual.Name)
+
+	renamed, err := eventStore.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", 0, ^uint64(0))
+	require.Nil(t, err)
+	assert.Len(t, renamed, 5)
+}
+
+func Test_EventStoreOnFile_TruncatesTornRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	eventStore := openFileEventStore(t, dir, 1<<20)
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a")
+	require.Nil(t, eventStore.Close())
+
+	paths := segmentPaths(t, dir)
+	require.Len(t, paths, 1)
+	info, err := os.Stat(paths[0])
+	require.Nil(t, err)
+	file, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	require.Nil(t, err)
+	_, err = file.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	eventStore = openFileEventStore(t, dir, 1<<20)
+	truncated, err := os.Stat(paths[0])
+	require.Nil(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 2)
+}
+
+func Test_EventStoreOnFile_TruncatesCorruptedLastRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	eventStore := openFileEventStore(t, dir, 1<<20)
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a")
+	require.Nil(t, eventStore.Close())
+
+	paths := segmentPaths(t, dir)
+	require.Len(t, paths, 1)
+	data, err := os.ReadFile(paths[0])
+	require.Nil(t, err)
+	data[len(data)-2] ^= 0xff
+	require.Nil(t, os.WriteFile(paths[0], data, 0o644))
+
+	eventStore = openFileEventStore(t, dir, 1<<20)
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 1)
+}
+
+func Test_EventStoreOnFile_RejectsCorruptedSegment(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	eventStore := openFileEventStore(t, dir, 256)
+	persistRenames(t, ctx, eventStore, newUserAccountId("1"), "a", "b", "c")
+	require.Nil(t, eventStore.Close())
+
+	paths := segmentPaths(t, dir)
+	require.Greater(t, len(paths), 1)
+	data, err := os.ReadFile(paths[0])
+	require.Nil(t, err)
+	data[len(data)-2] ^= 0xff
+	require.Nil(t, os.WriteFile(paths[0], data, 0o644))
+
+	_, err = pkg.NewEventStoreOnFile(dir, 4, 256, userAccountEventConverter, userAccountSnapshotConverter)
+	var ioError *pkg.IOError
+	assert.True(t, errors.As(err, &ioError))
+
+	// A corrupted record followed by durable records is not truncated from the last segment either.
+	dir = t.TempDir()
+	eventStore = openFileEventStore(t, dir, 1<<20)
+	persistRenames(t, ctx, eventStore, newUserAccountId("1"), "a", "b")
+	require.Nil(t, eventStore.Close())
+
+	paths = segmentPaths(t, dir)
+	require.Len(t, paths, 1)
+	data, err = os.ReadFile(paths[0])
+	require.Nil(t, err)
+	data[10] ^= 0xff
+	require.Nil(t, os.WriteFile(paths[0], data, 0o644))
+
+	_, err = pkg.NewEventStoreOnFile(dir, 4, 1<<20, userAccountEventConverter, userAccountSnapshotConverter)
+	assert.True(t, errors.As(err, &ioError))
+	info, err := os.Stat(paths[0])
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(data)), info.Size())
+}
+
+func Test_EventStoreOnFile_RepairsSnapshotFromLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	eventStore := openFileEventStore(t, dir, 1<<20)
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a")
+	require.Nil(t, eventStore.Close())
+
+	snapshotPaths, err := filepath.Glob(filepath.Join(dir, "snapshot", "*", "*.snapshot"))
+	require.Nil(t, err)
+	require.Len(t, snapshotPaths, 1)
+	require.Nil(t, os.Remove(snapshotPaths[0]))
+
+	eventStore = openFileEventStore(t, dir, 1<<20)
+	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	assert.Equal(t, "a", snapshotResult.Aggregate().(*userAccount).Name)
+	assert.Equal(t, uint64(2), snapshotResult.Aggregate().GetVersion())
+}
+
+func Test_EventStoreOnFile_Conformance(t *testing.T) {
+	dirs := make(map[pkg.EventStore]string)
+	eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		dir := t.TempDir()
+		eventStore, err := pkg.NewEventStoreOnFile(dir, 4, 1024, eventConverter, snapshotConverter, options...)
+		require.Nil(t, err)
+		t.Cleanup(func() {
+			_ = eventStore.Close()
+		})
+		dirs[eventStore] = dir
+		return eventStore
+	},
+		eventstoretest.WithKeptSnapshotCounter(func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int {
+			paths, err := filepath.Glob(filepath.Join(dirs[eventStore], "snapshot", url.PathEscape(aggregateId.AsString()), "*.snapshot"))
+			require.Nil(t, err)
+			// Excludes the latest snapshot, whose file number is 0.
+			return len(paths) - 1
+		}))
+}
+
+func Test_EventStoreOnFile_RejectsOperationsAfterClose(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	eventStore := openFileEventStore(t, dir, 1<<20)
+	id := newUserAccountId("1")
+	current := persistRenames(t, ctx, eventStore, id, "a")
+	require.Nil(t, eventStore.Close())
+
+	var ioError *pkg.IOError
+	renamed, err := current.Rename("b")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, renamed.Event, current.Version)
+	assert.True(t, errors.As(err, &ioError))
+	_, err = eventStore.GetLatestSnapshotById(ctx, &id)
+	assert.True(t, errors.As(err, &ioError))
+	_, err = eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	assert.True(t, errors.As(err, &ioError))
+	_, err = eventStore.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", 0, ^uint64(0))
+	assert.True(t, errors.As(err, &ioError))
+	assert.Nil(t, eventStore.Close())
+
+	// The rejected append is not written over the records of the first segment.
+	eventStore = openFileEventStore(t, dir, 1<<20)
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 2)
+}
@@ -1,82 +1,215 @@
 package test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/bolt"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+	"github.com/szks-repo/event-store-adapter-go/pkg/sqlite"
 )
 
-func Test_EventStoreOnMemory_WriteAndRead(t *testing.T) {
-	// Given
+func Test_EventStoreOnMemory_GetEventsByTypeNameAndOccurredAt(t *testing.T) {
+	ctx := context.Background()
 	eventStore := pkg.NewEventStoreOnMemory()
-	require.NotNil(t, eventStore)
-
-	userAccountId1 := newUserAccountId("1")
-
-	initial, userAccountCreated := newUserAccount(userAccountId1, "test")
-	require.NotNil(t, initial)
-	require.NotNil(t, userAccountCreated)
-	t.Logf("initial: %v", initial)
-	t.Logf("userAccountCreated: %v", userAccountCreated)
 
-	ctx := context.Background()
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
 	err := eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
 	require.Nil(t, err)
-
 	updated, err := initial.Rename("test2")
-	require.NotNil(t, updated)
 	require.Nil(t, err)
-	t.Logf("updated: %v", updated)
-
-	err = eventStore.PersistEvent(ctx, updated.Event, updated.Aggregate.Version)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
 	require.Nil(t, err)
 
-	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &userAccountId1)
-	require.NotNil(t, snapshotResult)
+	other, otherCreated := newUserAccount(newUserAccountId("2"), "other")
+	err = eventStore.PersistEventAndSnapshot(ctx, otherCreated, other)
 	require.Nil(t, err)
-	t.Logf("snapshotResult: %v", snapshotResult)
 
-	userAccount1, ok := snapshotResult.Aggregate().(*userAccount)
-	require.NotNil(t, userAccount1)
-	require.NotNil(t, ok)
-	t.Logf("UserAccount: %v", userAccount1)
+	reader, ok := eventStore.(pkg.EventTypeReader)
+	require.True(t, ok)
+
+	events, err := reader.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountCreated", 0, math.MaxUint64)
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, userAccountCreated.GetId(), events[0].GetId())
+	assert.Equal(t, otherCreated.GetId(), events[1].GetId())
 
-	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &userAccountId1, userAccount1.GetSeqNr()+1)
-	require.NotNil(t, events)
+	events, err = reader.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", updated.Event.GetOccurredAt(), updated.Event.GetOccurredAt())
 	require.Nil(t, err)
-	t.Logf("Events: %v", events)
+	require.Len(t, events, 1)
+	assert.Equal(t, updated.Event.GetId(), events[0].GetId())
+}
 
-	actual := replayUserAccount(events, snapshotResult.Aggregate().(*userAccount))
-	require.NotNil(t, actual)
-	t.Logf("Actual: %v", actual)
+func Test_EventStoreOnMemory_ConcurrentWritersOfDifferentAggregates(t *testing.T) {
+	ctx := context.Background()
+	eventStore := pkg.NewEventStoreOnMemory()
 
-	expect, _ := newUserAccount(userAccountId1, "test2")
-	require.NotNil(t, expect)
+	const writers = 16
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := newUserAccountId(fmt.Sprintf("%d", i))
+			initial, userAccountCreated := newUserAccount(id, "test")
+			if errs[i] = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial); errs[i] != nil {
+				return
+			}
+			updated, err := initial.Rename("test2")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+}
 
-	// Then
-	assert.True(t, actual.Equals(expect))
+func Test_EventStoreOnMemory_DeleteTtl(t *testing.T) {
+	ctx := context.Background()
+	eventStore, err := pkg.NewEventStoreOnMemoryWithOptions(
+		pkg.WithKeepSnapshot(true),
+		pkg.WithKeepSnapshotCount(1),
+		pkg.WithDeleteTtl(time.Hour))
+	require.Nil(t, err)
 
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a", "b")
+
+	// The excess snapshots are expiring but not yet deleted.
+	assert.Equal(t, []uint64{1, 2, 3}, eventStore.(*pkg.EventStoreOnMemory).GetKeptSnapshotSeqNrsById(&id))
 }
 
-// Persists an event and a snapshot for a user account
-func Test_EventStoreOnMemory_PersistsEventAndSnapshot(t *testing.T) {
+func Test_EventStoreOnMemory_DumpAndLoad(t *testing.T) {
 	ctx := context.Background()
-	eventStore := pkg.NewEventStoreOnMemory()
-	require.NotNil(t, eventStore)
+	eventStore, err := pkg.NewEventStoreOnMemoryWithOptions(
+		pkg.WithKeepSnapshot(true),
+		pkg.WithKeepSnapshotCount(2))
+	require.Nil(t, err)
+
+	id1 := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id1, "a", "b", "c")
+	id2 := newUserAccountId("2")
+	persistRenames(t, ctx, eventStore, id2, "d")
 
-	userAccountId1 := newUserAccountId("1")
+	path := filepath.Join(t.TempDir(), "dump.json")
+	require.Nil(t, eventStore.(*pkg.EventStoreOnMemory).DumpToFile(path))
 
-	initial, userAccountCreated := newUserAccount(userAccountId1, "test")
-	require.NotNil(t, initial)
-	require.NotNil(t, userAccountCreated)
+	loaded, err := pkg.NewEventStoreOnMemoryWithOptions(
+		pkg.WithKeepSnapshot(true),
+		pkg.WithKeepSnapshotCount(2))
+	require.Nil(t, err)
+	err = loaded.(*pkg.EventStoreOnMemory).LoadFromFile(path, userAccountEventConverter, userAccountSnapshotConverter)
+	require.Nil(t, err)
+
+	snapshotResult, err := loaded.GetLatestSnapshotById(ctx, &id1)
+	require.Nil(t, err)
+	assert.Equal(t, "c", snapshotResult.Aggregate().(*userAccount).Name)
+	assert.Equal(t, uint64(4), snapshotResult.Aggregate().GetVersion())
+	events, err := loaded.GetEventsByIdSinceSeqNr(ctx, &id1, 0)
+	require.Nil(t, err)
+	require.Len(t, events, 4)
+	for i, event := range events {
+		assert.Equal(t, uint64(i+1), event.GetSeqNr())
+	}
+	assert.Equal(t, []uint64{3, 4}, loaded.(*pkg.EventStoreOnMemory).GetKeptSnapshotSeqNrsById(&id1))
+	snapshotResult, err = loaded.GetLatestSnapshotById(ctx, &id2)
+	require.Nil(t, err)
+	assert.Equal(t, "d", snapshotResult.Aggregate().(*userAccount).Name)
+
+	// Once loaded through the converters, dumping and loading the contents produces the same bytes.
+	var dumped, redumped bytes.Buffer
+	require.Nil(t, loaded.(*pkg.EventStoreOnMemory).Dump(&dumped))
+	reloaded := pkg.NewEventStoreOnMemory().(*pkg.EventStoreOnMemory)
+	err = reloaded.Load(bytes.NewReader(dumped.Bytes()), userAccountEventConverter, userAccountSnapshotConverter)
+	require.Nil(t, err)
+	require.Nil(t, reloaded.Dump(&redumped))
+	assert.Equal(t, dumped.String(), redumped.String())
+
+	// The loaded store accepts the next write.
+	result, err := snapshotResult.Aggregate().(*userAccount).Rename("e")
+	require.Nil(t, err)
+	assert.Nil(t, loaded.PersistEvent(ctx, result.Event, snapshotResult.Aggregate().GetVersion()))
+}
 
-	err := eventStore.PersistEventAndSnapshot(
-		ctx,
-		userAccountCreated,
-		initial,
-	)
+func Test_EventStoreOnMemory_LoadRejectsInvalidDump(t *testing.T) {
+	ctx := context.Background()
+	eventStore := pkg.NewEventStoreOnMemory()
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a")
+
+	for _, dump := range []string{
+		`{"format":`,
+		`{"format":2,"aggregates":[]}`,
+		`{"format":1,"aggregates":[{"aid":"UserAccount-2","version":1,"events":[{"seq_nr":1,"payload":"e30="}]}]}`,
+	} {
+		err := eventStore.(*pkg.EventStoreOnMemory).Load(strings.NewReader(dump), userAccountEventConverter, userAccountSnapshotConverter)
+		var deserializationError *pkg.DeserializationError
+		assert.True(t, errors.As(err, &deserializationError), dump)
+	}
+
+	// The contents are left unchanged.
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
 	require.Nil(t, err)
+	assert.Len(t, events, 2)
+}
+
+func Test_EventStoreOnMemory_Conformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T, _ pkg.EventConverter, _ pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		eventStore, err := pkg.NewEventStoreOnMemoryWithOptions(options...)
+		require.Nil(t, err)
+		return eventStore
+	},
+		eventstoretest.WithoutSerialization(),
+		eventstoretest.WithKeptSnapshotCounter(func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int {
+			return len(eventStore.(*pkg.EventStoreOnMemory).GetKeptSnapshotSeqNrsById(aggregateId))
+		}))
+}
+
+func Test_EventStores_RejectDynamoDBOnlyOptions(t *testing.T) {
+	ctx := context.Background()
+	factories := map[string]func(options ...pkg.EventStoreOption) (pkg.EventStore, error){
+		"memory": pkg.NewEventStoreOnMemoryWithOptions,
+		"file": func(options ...pkg.EventStoreOption) (pkg.EventStore, error) {
+			return pkg.NewEventStoreOnFile(t.TempDir(), 4, 1<<20, userAccountEventConverter, userAccountSnapshotConverter, options...)
+		},
+		"sqlite": func(options ...pkg.EventStoreOption) (pkg.EventStore, error) {
+			return sqlite.NewEventStore(ctx, filepath.Join(t.TempDir(), "event_store.db"), userAccountEventConverter, userAccountSnapshotConverter, options...)
+		},
+		"bolt": func(options ...pkg.EventStoreOption) (pkg.EventStore, error) {
+			return bolt.NewEventStore(filepath.Join(t.TempDir(), "event_store.db"), 4, userAccountEventConverter, userAccountSnapshotConverter, options...)
+		},
+	}
+	options := map[string]pkg.EventStoreOption{
+		"WithHashChain":        pkg.WithHashChain(),
+		"WithConsistentRead":   pkg.WithConsistentRead(true),
+		"WithShardLayoutCheck": pkg.WithShardLayoutCheck(ctx),
+		"WithOutboxTableName":  pkg.WithOutboxTableName("outbox"),
+	}
+	for storeName, factory := range factories {
+		for optionName, option := range options {
+			t.Run(storeName+"/"+optionName, func(t *testing.T) {
+				_, err := factory(option)
+				require.NotNil(t, err)
+				assert.Contains(t, err.Error(), optionName)
+			})
+		}
+	}
 }
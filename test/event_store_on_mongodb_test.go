@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+	"github.com/szks-repo/event-store-adapter-go/pkg/mongodb"
+	tcmongodb "github.com/testcontainers/testcontainers-go/modules/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// openMongoDB returns a fresh database of a single-node replica set.
+//
+// The replica set at MONGODB_URI is used if it is set, such as a local mongod started with --replSet;
+// otherwise a container is started.
+func openMongoDB(t *testing.T, ctx context.Context) *mongo.Database {
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		container, err := tcmongodb.Run(ctx, "mongo:7", tcmongodb.WithReplicaSet("rs0"))
+		require.Nil(t, err)
+		t.Cleanup(func() {
+			if err := container.Terminate(ctx); err != nil {
+				t.Fatalf("failed to terminate container: %s", err.Error())
+			}
+		})
+		uri, err = container.ConnectionString(ctx)
+		require.Nil(t, err)
+		uri += "/?directConnection=true"
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	require.Nil(t, err)
+	database := client.Database("event_store_" + bson.NewObjectID().Hex())
+	t.Cleanup(func() {
+		_ = database.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return database
+}
+
+func newMongoDBEventStore(t *testing.T, ctx context.Context, database *mongo.Database, options ...pkg.EventStoreOption) *mongodb.EventStore {
+	eventStore, err := mongodb.NewEventStore(database, "journal", "snapshot", 1, userAccountEventConverter, userAccountSnapshotConverter, options...)
+	require.Nil(t, err)
+	err = eventStore.EnsureIndexes(ctx)
+	require.Nil(t, err)
+	return eventStore
+}
+
+func Test_EventStoreOnMongoDB_DeleteTtlSetsExpireAt(t *testing.T) {
+	ctx := context.Background()
+	database := openMongoDB(t, ctx)
+	eventStore := newMongoDBEventStore(t, ctx, database,
+		pkg.WithKeepSnapshot(true),
+		pkg.WithKeepSnapshotCount(2),
+		pkg.WithDeleteTtl(time.Hour))
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "a", "b", "c")
+
+	count, err := database.Collection("snapshot").CountDocuments(ctx, bson.D{
+		{Key: "aid", Value: id.AsString()},
+		{Key: "expire_at", Value: bson.D{{Key: "$exists", Value: true}}},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func Test_EventStoreOnMongoDB_Conformance(t *testing.T) {
+	ctx := context.Background()
+	database := openMongoDB(t, ctx)
+
+	// Every store gets its own collections, as the database is shared by the cases.
+	collectionCount := 0
+	snapshotCollectionNames := make(map[pkg.EventStore]string)
+	eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		collectionCount++
+		snapshotCollectionName := fmt.Sprintf("snapshot_%d", collectionCount)
+		eventStore, err := mongodb.NewEventStore(database, fmt.Sprintf("journal_%d", collectionCount), snapshotCollectionName, 1, eventConverter, snapshotConverter, options...)
+		require.Nil(t, err)
+		err = eventStore.EnsureIndexes(ctx)
+		require.Nil(t, err)
+		snapshotCollectionNames[eventStore] = snapshotCollectionName
+		return eventStore
+	},
+		eventstoretest.WithKeptSnapshotCounter(func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int {
+			count, err := database.Collection(snapshotCollectionNames[eventStore]).CountDocuments(ctx, bson.D{
+				{Key: "aid", Value: aggregateId.AsString()},
+				{Key: "seq_nr", Value: bson.D{{Key: "$gt", Value: 0}}},
+			})
+			require.Nil(t, err)
+			return int(count)
+		}))
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/common"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+	"github.com/szks-repo/event-store-adapter-go/pkg/postgres"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func openPostgres(t *testing.T, ctx context.Context) *sql.DB {
+	container, err := tcpostgres.Run(ctx,
+		"postgres:16-alpine",
+		tcpostgres.WithDatabase("event_store"),
+		tcpostgres.WithUsername("postgres"),
+		tcpostgres.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30*time.Second)),
+	)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Fatalf("failed to terminate container: %s", err.Error())
+		}
+	})
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	require.Nil(t, err)
+	db, err := sql.Open("pgx", dsn)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func Test_EventStoreOnPostgres_Conformance(t *testing.T) {
+	ctx := context.Background()
+	db := openPostgres(t, ctx)
+
+	// Every store gets its own tables, as the database is shared by the cases.
+	tableCount := 0
+	snapshotTableNames := make(map[pkg.EventStore]string)
+	eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		tableCount++
+		journalTableName := fmt.Sprintf("journal_%d", tableCount)
+		snapshotTableName := fmt.Sprintf("snapshot_%d", tableCount)
+		err := common.CreatePostgresTables(t, ctx, db, journalTableName, snapshotTableName)
+		require.Nil(t, err)
+
+		eventStore, err := postgres.NewEventStore(db, journalTableName, snapshotTableName, 4, eventConverter, snapshotConverter, options...)
+		require.Nil(t, err)
+		snapshotTableNames[eventStore] = snapshotTableName
+		return eventStore
+	},
+		eventstoretest.WithKeptSnapshotCounter(func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int {
+			var count int
+			query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE aid = $1 AND seq_nr > 0", snapshotTableNames[eventStore])
+			err := db.QueryRowContext(ctx, query, aggregateId.AsString()).Scan(&count)
+			require.Nil(t, err)
+			return count
+		}))
+}
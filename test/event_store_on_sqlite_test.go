@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/eventstoretest"
+	"github.com/szks-repo/event-store-adapter-go/pkg/sqlite"
+)
+
+func openSQLite(t *testing.T, ctx context.Context, path string, options ...pkg.EventStoreOption) *sqlite.EventStore {
+	eventStore, err := sqlite.NewEventStore(ctx, path, userAccountEventConverter, userAccountSnapshotConverter, options...)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = eventStore.Close()
+	})
+	return eventStore
+}
+
+func Test_EventStoreOnSQLite_WriteAndRead(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "event_store.db")
+	eventStore := openSQLite(t, ctx, path)
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	err := eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+	require.Nil(t, err)
+	require.Nil(t, eventStore.Close())
+
+	// Reopening the file must not apply the migrations again.
+	eventStore = openSQLite(t, ctx, path)
+	snapshotResult, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	require.True(t, snapshotResult.Present())
+	snapshot := snapshotResult.Aggregate().(*userAccount)
+	assert.Equal(t, uint64(2), snapshot.GetVersion())
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctx, &id, snapshot.GetSeqNr()+1)
+	require.Nil(t, err)
+	actual := replayUserAccount(events, snapshot)
+	assert.Equal(t, "test2", actual.Name)
+
+	renamed, err := eventStore.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", 0, ^uint64(0))
+	require.Nil(t, err)
+	require.Len(t, renamed, 1)
+	assert.Equal(t, updated.Event.GetId(), renamed[0].GetId())
+
+	limited, err := eventStore.GetEventsByIdSinceSeqNrWithLimit(ctx, &id, 0, 1)
+	require.Nil(t, err)
+	require.Len(t, limited, 1)
+	assert.Equal(t, userAccountCreated.GetId(), limited[0].GetId())
+}
+
+func Test_EventStoreOnSQLite_Conformance(t *testing.T) {
+	paths := make(map[pkg.EventStore]string)
+	eventstoretest.Run(t, func(t *testing.T, eventConverter pkg.EventConverter, snapshotConverter pkg.AggregateConverter, options ...pkg.EventStoreOption) pkg.EventStore {
+		path := filepath.Join(t.TempDir(), "event_store.db")
+		eventStore, err := sqlite.NewEventStore(context.Background(), path, eventConverter, snapshotConverter, options...)
+		require.Nil(t, err)
+		t.Cleanup(func() {
+			_ = eventStore.Close()
+		})
+		paths[eventStore] = path
+		return eventStore
+	},
+		eventstoretest.WithKeptSnapshotCounter(func(t *testing.T, eventStore pkg.EventStore, aggregateId pkg.AggregateId) int {
+			db, err := sql.Open("sqlite", paths[eventStore])
+			require.Nil(t, err)
+			defer db.Close()
+			var count int
+			err = db.QueryRow("SELECT COUNT(*) FROM snapshot WHERE aid = $1 AND seq_nr > 0", aggregateId.AsString()).Scan(&count)
+			require.Nil(t, err)
+			return count
+		}))
+}
+
+func Test_EventStoreOnSQLite_EscapesPath(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "a?b#c%20d")
+	require.Nil(t, os.Mkdir(dir, 0o755))
+	path := filepath.Join(dir, "event_store.db")
+	eventStore := openSQLite(t, ctx, path)
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	err := eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+// tenantUserAccountId is a userAccountId belonging to a tenant.
+type tenantUserAccountId struct {
+	userAccountId
+	TenantId string
+}
+
+func (id *tenantUserAccountId) GetTenantId() string {
+	return id.TenantId
+}
+
+func assertTenantIsolationError(t *testing.T, err error) {
+	var tenantIsolationError *pkg.TenantIsolationError
+	assert.True(t, errors.As(err, &tenantIsolationError), "%v", err)
+}
+
+func Test_TenantEventStore_IsolatesTenants(t *testing.T) {
+	memory := pkg.NewEventStoreOnMemory()
+	eventStore, err := pkg.NewTenantEventStore(memory)
+	require.Nil(t, err)
+	ctxA := pkg.ContextWithTenantId(context.Background(), "a")
+	ctxB := pkg.ContextWithTenantId(context.Background(), "b")
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctxA, eventStore, id, "test-a")
+	persistRenames(t, ctxB, eventStore, id, "test-b1", "test-b2")
+
+	loadedA := loadUserAccount(t, ctxA, eventStore, id)
+	assert.Equal(t, "test-a", loadedA.Name)
+	assert.Equal(t, uint64(2), loadedA.Version)
+	loadedB := loadUserAccount(t, ctxB, eventStore, id)
+	assert.Equal(t, "test-b2", loadedB.Name)
+	assert.Equal(t, uint64(3), loadedB.Version)
+
+	events, err := eventStore.GetEventsByIdSinceSeqNr(ctxA, &id, 0)
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, "UserAccountId-1", event.GetAggregateId().AsString())
+	}
+
+	// The aggregates are stored under the tenant-prefixed ids.
+	result, err := memory.GetLatestSnapshotById(context.Background(), &id)
+	require.Nil(t, err)
+	assert.True(t, result.Empty())
+	result, err = eventStore.GetLatestSnapshotById(pkg.ContextWithTenantId(context.Background(), "c"), &id)
+	require.Nil(t, err)
+	assert.True(t, result.Empty())
+}
+
+func Test_TenantEventStore_GetEventsByTypeNameIsScopedToTenant(t *testing.T) {
+	eventStore, err := pkg.NewTenantEventStore(pkg.NewEventStoreOnMemory())
+	require.Nil(t, err)
+	ctxA := pkg.ContextWithTenantId(context.Background(), "a")
+	ctxB := pkg.ContextWithTenantId(context.Background(), "b")
+
+	persistRenames(t, ctxA, eventStore, newUserAccountId("1"), "test-a")
+	persistRenames(t, ctxB, eventStore, newUserAccountId("2"), "test-b1", "test-b2")
+
+	events, err := eventStore.GetEventsByTypeNameAndOccurredAt(ctxB, "UserAccountNameChanged", 0, ^uint64(0))
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, "UserAccountNameChanged", event.GetTypeName())
+		assert.Equal(t, "UserAccountId-2", event.GetAggregateId().AsString())
+	}
+}
+
+func Test_TenantEventStore_TakesTenantFromAggregateId(t *testing.T) {
+	eventStore, err := pkg.NewTenantEventStore(pkg.NewEventStoreOnMemory())
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	id := newUserAccountId("1")
+	persistRenames(t, pkg.ContextWithTenantId(ctx, "a"), eventStore, id, "test-a")
+
+	tenantId := &tenantUserAccountId{userAccountId: id, TenantId: "a"}
+	result, err := eventStore.GetLatestSnapshotById(ctx, tenantId)
+	require.Nil(t, err)
+	assert.Equal(t, "test-a", result.Aggregate().(*userAccount).Name)
+	result, err = eventStore.GetLatestSnapshotById(pkg.ContextWithTenantId(ctx, "a"), tenantId)
+	require.Nil(t, err)
+	assert.True(t, result.Present())
+}
+
+func Test_TenantEventStore_RejectsCrossTenantAccess(t *testing.T) {
+	eventStore, err := pkg.NewTenantEventStore(pkg.NewEventStoreOnMemory())
+	require.Nil(t, err)
+	ctxB := pkg.ContextWithTenantId(context.Background(), "b")
+
+	tenantId := &tenantUserAccountId{userAccountId: newUserAccountId("1"), TenantId: "a"}
+	_, err = eventStore.GetLatestSnapshotById(ctxB, tenantId)
+	assertTenantIsolationError(t, err)
+	_, err = eventStore.GetEventsByIdSinceSeqNr(ctxB, tenantId, 0)
+	assertTenantIsolationError(t, err)
+
+	aggregate, created := newUserAccount(newUserAccountId("1"), "test")
+	created.AggregateId = tenantId
+	err = eventStore.PersistEventAndSnapshot(ctxB, created, aggregate)
+	assertTenantIsolationError(t, err)
+}
+
+func Test_TenantEventStore_RequiresTenant(t *testing.T) {
+	eventStore, err := pkg.NewTenantEventStore(pkg.NewEventStoreOnMemory())
+	require.Nil(t, err)
+	ctx := context.Background()
+	id := newUserAccountId("1")
+
+	_, err = eventStore.GetLatestSnapshotById(ctx, &id)
+	assertTenantIsolationError(t, err)
+	_, err = eventStore.GetEventsByTypeNameAndOccurredAt(ctx, "UserAccountNameChanged", 0, ^uint64(0))
+	assertTenantIsolationError(t, err)
+	aggregate, created := newUserAccount(id, "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, created, aggregate)
+	assertTenantIsolationError(t, err)
+
+	_, err = eventStore.GetLatestSnapshotById(pkg.ContextWithTenantId(ctx, ""), &id)
+	assertTenantIsolationError(t, err)
+	_, err = eventStore.GetLatestSnapshotById(pkg.ContextWithTenantId(ctx, "a#b"), &id)
+	assertTenantIsolationError(t, err)
+}
+
+func Test_TenantEventStore_ResolvesEventStoreOfTenant(t *testing.T) {
+	eventStores := map[string]pkg.EventStore{
+		"a": pkg.NewEventStoreOnMemory(),
+		"b": pkg.NewEventStoreOnMemory(),
+	}
+	eventStore, err := pkg.NewTenantEventStoreWithResolver(func(tenantId string) (pkg.EventStore, error) {
+		eventStore, ok := eventStores[tenantId]
+		if !ok {
+			return nil, errors.New("unknown tenant")
+		}
+		return eventStore, nil
+	})
+	require.Nil(t, err)
+	ctxA := pkg.ContextWithTenantId(context.Background(), "a")
+
+	id := newUserAccountId("1")
+	persistRenames(t, ctxA, eventStore, id, "test-a")
+
+	events, err := eventStores["a"].GetEventsByIdSinceSeqNr(context.Background(), &tenantPrefixedId{userAccountId: id, prefix: "a#"}, 0)
+	require.Nil(t, err)
+	assert.Len(t, events, 2)
+	events, err = eventStores["b"].GetEventsByIdSinceSeqNr(context.Background(), &tenantPrefixedId{userAccountId: id, prefix: "b#"}, 0)
+	require.Nil(t, err)
+	assert.Empty(t, events)
+
+	_, err = eventStore.GetLatestSnapshotById(pkg.ContextWithTenantId(context.Background(), "c"), &id)
+	assert.EqualError(t, err, "unknown tenant")
+}
+
+// tenantPrefixedId is a userAccountId as a TenantEventStore stores it.
+type tenantPrefixedId struct {
+	userAccountId
+	prefix string
+}
+
+func (id *tenantPrefixedId) GetTypeName() string {
+	return id.prefix + id.userAccountId.GetTypeName()
+}
+
+func (id *tenantPrefixedId) AsString() string {
+	return id.prefix + id.userAccountId.AsString()
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	result := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		result[kv.Key] = kv.Value
+	}
+	return result
+}
+
+func Test_TracingEventStore_CreatesSpans(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	eventStore := pkg.NewTracingEventStore(pkg.NewEventStoreOnMemory(), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	require.Nil(t, eventStore.PersistEvent(ctx, updated.Event, initial.Version))
+	_, err = eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	_, err = eventStore.GetEventsByIdSinceSeqNr(ctx, &id, 0)
+	require.Nil(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	assert.Equal(t, "EventStore.PersistEventAndSnapshot", spans[0].Name())
+	assert.Equal(t, "EventStore.PersistEvent", spans[1].Name())
+	assert.Equal(t, "EventStore.GetLatestSnapshotById", spans[2].Name())
+	assert.Equal(t, "EventStore.GetEventsByIdSinceSeqNr", spans[3].Name())
+
+	attributes := spanAttributes(spans[1])
+	assert.Equal(t, id.AsString(), attributes["event_store.aggregate.id"].AsString())
+	assert.Equal(t, id.GetTypeName(), attributes["event_store.aggregate.type"].AsString())
+	assert.Equal(t, "UserAccountNameChanged", attributes["event_store.event.type"].AsString())
+	assert.Equal(t, int64(2), attributes["event_store.seq_nr"].AsInt64())
+	assert.Equal(t, int64(1), attributes["event_store.version"].AsInt64())
+	assert.Equal(t, "ok", attributes["event_store.outcome"].AsString())
+
+	attributes = spanAttributes(spans[2])
+	assert.Equal(t, int64(1), attributes["event_store.item_count"].AsInt64())
+	assert.Equal(t, int64(2), attributes["event_store.version"].AsInt64())
+	attributes = spanAttributes(spans[3])
+	assert.Equal(t, int64(2), attributes["event_store.item_count"].AsInt64())
+}
+
+func Test_TracingEventStore_RecordsConflict(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	eventStore := pkg.NewTracingEventStore(pkg.NewEventStoreOnMemory(), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	require.Nil(t, eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial))
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	require.NotNil(t, eventStore.PersistEvent(ctx, updated.Event, initial.Version+1))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "conflict", spanAttributes(spans[1])["event_store.outcome"].AsString())
+	require.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+}
+
+func Test_TracingEventStore_PropagatesContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "parent")
+	eventStore := pkg.NewTracingEventStore(pkg.NewEventStoreOnMemory(), tracerProvider)
+
+	id := newUserAccountId("1")
+	_, err := eventStore.GetLatestSnapshotById(ctx, &id)
+	require.Nil(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, int64(0), spanAttributes(spans[0])["event_store.item_count"].AsInt64())
+}
@@ -0,0 +1,26 @@
+package test
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+func Test_SortableKeyResolver_OrdersSkeysBySeqNr(t *testing.T) {
+	keyResolver := &pkg.SortableKeyResolver{}
+	id := newUserAccountId("1")
+	seqNrs := []uint64{0, 1, 2, 9, 10, 11, 100, math.MaxUint64}
+	skeys := make([]string, 0, len(seqNrs))
+	for _, seqNr := range seqNrs {
+		skey := keyResolver.ResolveSkey(&id, seqNr)
+		assert.True(t, strings.HasPrefix(skey, keyResolver.ResolveSkeyPrefix(&id)))
+		skeys = append(skeys, skey)
+	}
+	assert.True(t, sort.StringsAreSorted(skeys))
+	assert.Equal(t, "UserAccountId-1-00000000000000000010", keyResolver.ResolveSkey(&id, 10))
+	assert.Equal(t, (&pkg.DefaultKeyResolver{}).ResolvePkey(&id, 32), keyResolver.ResolvePkey(&id, 32))
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/common"
+)
+
+type outboxPublisherFunc func(ctx context.Context, message pkg.OutboxMessage) error
+
+func (f outboxPublisherFunc) Publish(ctx context.Context, message pkg.OutboxMessage) error {
+	return f(ctx, message)
+}
+
+func Test_OutboxRelay_PublishesEventsWrittenWithTheJournal(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
+	require.Nil(t, err)
+	err = common.CreateOutboxTable(t, ctx, dynamodbClient, "outbox", "outbox-status-index")
+	require.Nil(t, err)
+
+	eventStore, err := pkg.NewEventStoreOnDynamoDB(
+		dynamodbClient,
+		"journal",
+		"snapshot",
+		"journal-aid-index",
+		"snapshot-aid-index",
+		1,
+		userAccountEventConverter,
+		userAccountSnapshotConverter,
+		pkg.WithOutboxTableName("outbox"))
+	require.Nil(t, err)
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+	require.Nil(t, err)
+
+	var published []string
+	relay, err := pkg.NewOutboxRelay(dynamodbClient, "outbox", "outbox-status-index", outboxPublisherFunc(func(_ context.Context, message pkg.OutboxMessage) error {
+		published = append(published, message.Id)
+		return nil
+	}))
+	require.Nil(t, err)
+
+	delivered, err := relay.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.ElementsMatch(t, []string{userAccountCreated.GetId(), updated.Event.GetId()}, published)
+
+	delivered, err = relay.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+}
+
+func Test_OutboxRelay_DeadLettersAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
+	require.Nil(t, err)
+	err = common.CreateOutboxTable(t, ctx, dynamodbClient, "outbox", "outbox-status-index")
+	require.Nil(t, err)
+
+	eventStore, err := pkg.NewEventStoreOnDynamoDB(
+		dynamodbClient,
+		"journal",
+		"snapshot",
+		"journal-aid-index",
+		"snapshot-aid-index",
+		1,
+		userAccountEventConverter,
+		userAccountSnapshotConverter,
+		pkg.WithOutboxTableName("outbox"))
+	require.Nil(t, err)
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+
+	attempts := 0
+	var deadLettered []pkg.OutboxMessage
+	relay, err := pkg.NewOutboxRelay(dynamodbClient, "outbox", "outbox-status-index",
+		outboxPublisherFunc(func(context.Context, pkg.OutboxMessage) error {
+			attempts++
+			return errors.New("broker unavailable")
+		}),
+		pkg.WithOutboxMaxAttempts(2),
+		pkg.WithOutboxRetryBackoff(0),
+		pkg.WithOutboxDeadLetterHandler(func(_ context.Context, message pkg.OutboxMessage, _ error) {
+			deadLettered = append(deadLettered, message)
+		}))
+	require.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = relay.Poll(ctx)
+		require.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 2, attempts)
+	require.Len(t, deadLettered, 1)
+	assert.Equal(t, userAccountCreated.GetId(), deadLettered[0].Id)
+	assert.Equal(t, uint32(2), deadLettered[0].Attempts)
+}
+
+func Test_OutboxRelay_HoldsLaterEventsOfAggregateWhileEarlierIsPending(t *testing.T) {
+	ctx := context.Background()
+	container := runLocalStackContainer(t, ctx)
+
+	dynamodbClient, err := common.CreateDynamoDBClient(t, ctx, container)
+	require.Nil(t, err)
+	err = common.CreateJournalTable(t, ctx, dynamodbClient, "journal", "journal-aid-index")
+	require.Nil(t, err)
+	err = common.CreateSnapshotTable(t, ctx, dynamodbClient, "snapshot", "snapshot-aid-index")
+	require.Nil(t, err)
+	err = common.CreateOutboxTable(t, ctx, dynamodbClient, "outbox", "outbox-status-index")
+	require.Nil(t, err)
+
+	eventStore, err := pkg.NewEventStoreOnDynamoDB(
+		dynamodbClient,
+		"journal",
+		"snapshot",
+		"journal-aid-index",
+		"snapshot-aid-index",
+		1,
+		userAccountEventConverter,
+		userAccountSnapshotConverter,
+		pkg.WithOutboxTableName("outbox"))
+	require.Nil(t, err)
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+	require.Nil(t, err)
+
+	var published []string
+	relay, err := pkg.NewOutboxRelay(dynamodbClient, "outbox", "outbox-status-index",
+		outboxPublisherFunc(func(_ context.Context, message pkg.OutboxMessage) error {
+			if message.Id == userAccountCreated.GetId() {
+				return errors.New("broker unavailable")
+			}
+			published = append(published, message.Id)
+			return nil
+		}),
+		pkg.WithOutboxRetryBackoff(time.Hour))
+	require.Nil(t, err)
+
+	delivered, err := relay.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+	delivered, err = relay.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Empty(t, published)
+}
@@ -0,0 +1,232 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+type userAccountNamesProjection struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func newUserAccountNamesProjection() *userAccountNamesProjection {
+	return &userAccountNamesProjection{names: make(map[string]string)}
+}
+
+func (p *userAccountNamesProjection) GetName() string {
+	return "user-account-names"
+}
+
+func (p *userAccountNamesProjection) Handle(_ context.Context, event pkg.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch e := event.(type) {
+	case *userAccountCreated:
+		p.names[e.AggregateId.AsString()] = e.Name
+	case *userAccountNameChanged:
+		p.names[e.AggregateId.AsString()] = e.Name
+	}
+	return nil
+}
+
+func (p *userAccountNamesProjection) Reset(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.names = make(map[string]string)
+	return nil
+}
+
+func (p *userAccountNamesProjection) get(aid string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.names[aid]
+}
+
+// exhaustedSignalingFeed closes exhausted when the wrapped feed first returns no events.
+type exhaustedSignalingFeed struct {
+	pkg.EventFeed
+	once      sync.Once
+	exhausted chan struct{}
+}
+
+func (f *exhaustedSignalingFeed) ReadEvents(ctx context.Context, checkpoint string, limit int) ([]pkg.Event, error) {
+	events, err := f.EventFeed.ReadEvents(ctx, checkpoint, limit)
+	if err == nil && len(events) == 0 {
+		f.once.Do(func() { close(f.exhausted) })
+	}
+	return events, err
+}
+
+func Test_ProjectionRunner_CatchUpAndRebuild(t *testing.T) {
+	ctx := context.Background()
+	eventStore := pkg.NewEventStoreOnMemory()
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	id := newUserAccountId("1")
+	initial, userAccountCreated := newUserAccount(id, "test")
+	err := eventStore.PersistEventAndSnapshot(ctx, userAccountCreated, initial)
+	require.Nil(t, err)
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated.Event, initial.Version)
+	require.Nil(t, err)
+
+	projection := newUserAccountNamesProjection()
+	runner, err := pkg.NewProjectionRunner(projection, pkg.NewAggregateEventFeed(eventStore, &id), checkpointStore, pkg.WithProjectionBatchSize(1))
+	require.Nil(t, err)
+
+	err = runner.CatchUp(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, "test2", projection.get(id.AsString()))
+	checkpoint, err := checkpointStore.GetCheckpoint(ctx, projection.GetName())
+	require.Nil(t, err)
+	assert.Equal(t, "00000000000000000002", checkpoint)
+
+	projection.names[id.AsString()] = "stale"
+	err = runner.CatchUp(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, "stale", projection.get(id.AsString()))
+
+	err = runner.Rebuild(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, "test2", projection.get(id.AsString()))
+}
+
+func Test_ProjectionRunner_EventTypeFeedWithLiveSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eventBus, err := pkg.NewEventBus()
+	require.Nil(t, err)
+	memory := pkg.NewEventStoreOnMemory()
+	eventStore := pkg.NewPublishingEventStore(memory, eventBus)
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	id1 := newUserAccountId("1")
+	initial1, created1 := newUserAccount(id1, "test")
+	err = eventStore.PersistEventAndSnapshot(ctx, created1, initial1)
+	require.Nil(t, err)
+
+	projection := newUserAccountNamesProjection()
+	feed := &exhaustedSignalingFeed{
+		EventFeed: pkg.NewEventTypeFeed(memory.(pkg.EventTypeReader), "UserAccountCreated", "UserAccountNameChanged"),
+		exhausted: make(chan struct{}),
+	}
+	runner, err := pkg.NewProjectionRunner(projection, feed, checkpointStore, pkg.WithLiveEventSource(pkg.NewEventBusLiveSource(eventBus, 16)))
+	require.Nil(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.Run(ctx)
+	}()
+
+	<-feed.exhausted
+	assert.Equal(t, "test", projection.get(id1.AsString()))
+
+	id2 := newUserAccountId("2")
+	initial2, created2 := newUserAccount(id2, "other")
+	err = eventStore.PersistEventAndSnapshot(ctx, created2, initial2)
+	require.Nil(t, err)
+	updated1, err := initial1.Rename("test2")
+	require.Nil(t, err)
+	err = eventStore.PersistEvent(ctx, updated1.Event, initial1.Version)
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		return projection.get(id1.AsString()) == "test2" && projection.get(id2.AsString()) == "other"
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// failingOnceProjection fails to handle the first event of the aggregate id.
+type failingOnceProjection struct {
+	*userAccountNamesProjection
+	failAid string
+	failed  bool
+	handled []string
+}
+
+func (p *failingOnceProjection) Handle(ctx context.Context, event pkg.Event) error {
+	if !p.failed && event.GetAggregateId().AsString() == p.failAid {
+		p.failed = true
+		return errors.New("handler failed")
+	}
+	p.handled = append(p.handled, event.GetId())
+	return p.userAccountNamesProjection.Handle(ctx, event)
+}
+
+func Test_ProjectionRunner_EventTypeFeedResumesWithinSharedOccurredAt(t *testing.T) {
+	ctx := context.Background()
+	memory := pkg.NewEventStoreOnMemory()
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	id1 := newUserAccountId("1")
+	initial1, created1 := newUserAccount(id1, "test")
+	created1.OccurredAt = 1000
+	err := memory.PersistEventAndSnapshot(ctx, created1, initial1)
+	require.Nil(t, err)
+	id2 := newUserAccountId("2")
+	initial2, created2 := newUserAccount(id2, "other")
+	created2.OccurredAt = 1000
+	err = memory.PersistEventAndSnapshot(ctx, created2, initial2)
+	require.Nil(t, err)
+
+	projection := &failingOnceProjection{userAccountNamesProjection: newUserAccountNamesProjection(), failAid: id2.AsString()}
+	feed := pkg.NewEventTypeFeed(memory.(pkg.EventTypeReader), "UserAccountCreated")
+	runner, err := pkg.NewProjectionRunner(projection, feed, checkpointStore, pkg.WithProjectionBatchSize(1))
+	require.Nil(t, err)
+
+	err = runner.CatchUp(ctx)
+	require.NotNil(t, err)
+	assert.Equal(t, "test", projection.get(id1.AsString()))
+
+	err = runner.CatchUp(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, "other", projection.get(id2.AsString()))
+	assert.Equal(t, []string{created1.GetId(), created2.GetId()}, projection.handled)
+}
+
+func Test_AggregateEventFeed_AppliesLimit(t *testing.T) {
+	ctx := context.Background()
+	eventStore := pkg.NewEventStoreOnMemory()
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "test2", "test3")
+
+	feed := pkg.NewAggregateEventFeed(eventStore, &id)
+	events, err := feed.ReadEvents(ctx, "", 2)
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	events, err = feed.ReadEvents(ctx, feed.CheckpointOf(events[1]), 2)
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, uint64(3), events[0].GetSeqNr())
+}
+
+func Test_ProjectionRunner_CatchUpThroughDecoratedEventStore(t *testing.T) {
+	ctx := context.Background()
+	// EventStoreOnFile is not a LimitedEventReader, so the decorator truncates the events itself.
+	eventStore := pkg.NewTracingEventStore(openFileEventStore(t, t.TempDir(), 1<<20), nil)
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+	id := newUserAccountId("1")
+	persistRenames(t, ctx, eventStore, id, "test2", "test3")
+
+	projection := newUserAccountNamesProjection()
+	runner, err := pkg.NewProjectionRunner(projection, pkg.NewAggregateEventFeed(eventStore, &id), checkpointStore, pkg.WithProjectionBatchSize(2))
+	require.Nil(t, err)
+
+	err = runner.CatchUp(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, "test3", projection.get(id.AsString()))
+	checkpoint, err := checkpointStore.GetCheckpoint(ctx, projection.GetName())
+	require.Nil(t, err)
+	assert.Equal(t, "00000000000000000003", checkpoint)
+}
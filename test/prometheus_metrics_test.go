@@ -0,0 +1,67 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+	"github.com/szks-repo/event-store-adapter-go/pkg/prometheusmetrics"
+)
+
+func Test_PrometheusMetrics_RecordsOperations(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := prometheusmetrics.NewMetrics(registry, "test")
+	require.Nil(t, err)
+
+	metrics.ObserveRead("GetLatestSnapshotById", pkg.OutcomeOk, time.Millisecond)
+	metrics.ObserveAppend("PersistEvent", pkg.OutcomeOk, time.Millisecond)
+	metrics.ObserveAppend("PersistEvent", pkg.OutcomeConflict, time.Millisecond)
+	metrics.AddRetries("TransactWriteItems", 2)
+	metrics.ObservePayloadSize(pkg.PayloadKindEvent, 128)
+	metrics.ObserveEventsReplayed(3)
+	metrics.AddSnapshotsPurged(2)
+	metrics.AddConsumedCapacity("Query", "journal", 0.5)
+
+	count, err := testutil.GatherAndCount(registry,
+		"test_event_store_reads_total",
+		"test_event_store_appends_total",
+		"test_event_store_optimistic_lock_conflicts_total",
+		"test_event_store_retries_total",
+		"test_event_store_snapshots_purged_total",
+		"test_event_store_consumed_capacity_units_total")
+	require.Nil(t, err)
+	// The appends have two series, ok and conflict.
+	assert.Equal(t, 7, count)
+
+	families, err := registry.Gather()
+	require.Nil(t, err)
+	for _, family := range families {
+		switch family.GetName() {
+		case "test_event_store_optimistic_lock_conflicts_total":
+			assert.Equal(t, 1.0, family.GetMetric()[0].GetCounter().GetValue())
+		case "test_event_store_retries_total":
+			assert.Equal(t, 2.0, family.GetMetric()[0].GetCounter().GetValue())
+		case "test_event_store_events_replayed":
+			assert.Equal(t, uint64(1), family.GetMetric()[0].GetHistogram().GetSampleCount())
+		}
+	}
+}
+
+func Test_PrometheusMetrics_RejectsDuplicateRegistration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	_, err := prometheusmetrics.NewMetrics(registry, "test")
+	require.Nil(t, err)
+	_, err = prometheusmetrics.NewMetrics(registry, "test")
+	assert.NotNil(t, err)
+}
+
+func Test_EventStoreOnDynamoDB_WithMetricsRejectsNil(t *testing.T) {
+	_, err := pkg.NewEventStoreOnDynamoDB(&dynamodb.Client{}, "journal", "snapshot", "journal-aid-index", "snapshot-aid-index", 1,
+		userAccountEventConverter, userAccountSnapshotConverter, pkg.WithMetrics(nil))
+	assert.NotNil(t, err)
+}
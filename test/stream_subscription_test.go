@@ -0,0 +1,185 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/szks-repo/event-store-adapter-go/pkg"
+)
+
+func Test_StreamSubscription_DispatchesAndCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	source := pkg.NewStreamSourceOnMemory()
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	_, err = source.AppendEvent("shard-1", userAccountCreated)
+	require.Nil(t, err)
+	source.Append("shard-1", pkg.StreamRecord{EventName: pkg.StreamEventNameModify})
+	last, err := source.AppendEvent("shard-1", updated.Event)
+	require.Nil(t, err)
+
+	subscription, err := pkg.NewStreamSubscription("projection", source, checkpointStore, userAccountEventConverter)
+	require.Nil(t, err)
+	var received []pkg.Event
+	subscription.AddHandler(func(_ context.Context, event pkg.Event) error {
+		received = append(received, event)
+		return nil
+	})
+
+	err = subscription.Poll(ctx)
+	require.Nil(t, err)
+	require.Len(t, received, 2)
+	assert.Equal(t, userAccountCreated.GetId(), received[0].GetId())
+	assert.Equal(t, updated.Event.GetId(), received[1].GetId())
+
+	checkpoint, err := checkpointStore.GetCheckpoint(ctx, "projection/shard-1")
+	require.Nil(t, err)
+	assert.Equal(t, last.SequenceNumber, checkpoint)
+
+	err = subscription.Poll(ctx)
+	require.Nil(t, err)
+	assert.Len(t, received, 2)
+}
+
+func Test_StreamSubscription_RedeliversAfterHandlerError(t *testing.T) {
+	ctx := context.Background()
+	source := pkg.NewStreamSourceOnMemory()
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	first, err := source.AppendEvent("shard-1", userAccountCreated)
+	require.Nil(t, err)
+	_, err = source.AppendEvent("shard-1", updated.Event)
+	require.Nil(t, err)
+
+	subscription, err := pkg.NewStreamSubscription("projection", source, checkpointStore, userAccountEventConverter)
+	require.Nil(t, err)
+	fail := true
+	var received []string
+	subscription.AddHandler(func(_ context.Context, event pkg.Event) error {
+		if fail && !event.IsCreated() {
+			return errors.New("handler failed")
+		}
+		received = append(received, event.GetId())
+		return nil
+	})
+
+	err = subscription.Poll(ctx)
+	require.NotNil(t, err)
+	checkpoint, err := checkpointStore.GetCheckpoint(ctx, "projection/shard-1")
+	require.Nil(t, err)
+	assert.Equal(t, first.SequenceNumber, checkpoint)
+
+	fail = false
+	err = subscription.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []string{userAccountCreated.GetId(), updated.Event.GetId()}, received)
+}
+
+func Test_StreamSubscription_ReadsParentShardBeforeChildren(t *testing.T) {
+	ctx := context.Background()
+	source := pkg.NewStreamSourceOnMemory()
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	initial, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	updated, err := initial.Rename("test2")
+	require.Nil(t, err)
+	// The child shard is listed before its parent.
+	_, err = source.AppendEvent("shard-2", userAccountCreated)
+	require.Nil(t, err)
+	source.SplitShard("shard-2", "shard-1")
+	_, err = source.AppendEvent("shard-1", updated.Event)
+	require.Nil(t, err)
+
+	subscription, err := pkg.NewStreamSubscription("projection", source, checkpointStore, userAccountEventConverter)
+	require.Nil(t, err)
+	fail := true
+	var received []string
+	subscription.AddHandler(func(_ context.Context, event pkg.Event) error {
+		if fail && event.IsCreated() {
+			return errors.New("handler failed")
+		}
+		received = append(received, event.GetId())
+		return nil
+	})
+
+	err = subscription.Poll(ctx)
+	require.NotNil(t, err)
+	assert.Empty(t, received)
+
+	fail = false
+	err = subscription.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []string{userAccountCreated.GetId(), updated.Event.GetId()}, received)
+
+	err = subscription.Poll(ctx)
+	require.Nil(t, err)
+	assert.Len(t, received, 2)
+}
+
+func Test_StreamSubscription_SkipsCopiedRecords(t *testing.T) {
+	ctx := context.Background()
+	source := pkg.NewStreamSourceOnMemory()
+	checkpointStore := pkg.NewCheckpointStoreOnMemory()
+
+	_, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	original, err := source.AppendEvent("shard-1", userAccountCreated)
+	require.Nil(t, err)
+	original.Copied = true
+	copied := source.Append("shard-1", original)
+
+	subscription, err := pkg.NewStreamSubscription("projection", source, checkpointStore, userAccountEventConverter)
+	require.Nil(t, err)
+	var received []string
+	subscription.AddHandler(func(_ context.Context, event pkg.Event) error {
+		received = append(received, event.GetId())
+		return nil
+	})
+
+	err = subscription.Poll(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []string{userAccountCreated.GetId()}, received)
+	checkpoint, err := checkpointStore.GetCheckpoint(ctx, "projection/shard-1")
+	require.Nil(t, err)
+	assert.Equal(t, copied.SequenceNumber, checkpoint)
+}
+
+func Test_StreamSubscription_RunReportsPollErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	source := pkg.NewStreamSourceOnMemory()
+	_, userAccountCreated := newUserAccount(newUserAccountId("1"), "test")
+	_, err := source.AppendEvent("shard-1", userAccountCreated)
+	require.Nil(t, err)
+
+	errHandler := errors.New("handler failed")
+	var reported []error
+	subscription, err := pkg.NewStreamSubscription("projection", source, pkg.NewCheckpointStoreOnMemory(), userAccountEventConverter,
+		pkg.WithStreamPollInterval(time.Millisecond),
+		pkg.WithStreamErrorHandler(func(_ context.Context, err error) {
+			reported = append(reported, err)
+			if len(reported) == 2 {
+				cancel()
+			}
+		}))
+	require.Nil(t, err)
+	subscription.AddHandler(func(context.Context, pkg.Event) error {
+		return errHandler
+	})
+
+	err = subscription.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.Len(t, reported, 2)
+	for _, err := range reported {
+		assert.ErrorIs(t, err, errHandler)
+	}
+}
@@ -1,8 +1,12 @@
 package test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/szks-repo/event-store-adapter-go/pkg"
@@ -174,3 +178,28 @@ func Test_Repository_OnMemory_StoreAndFindById(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, "test2", actual2.Name)
 }
+
+func Test_UserAccountRepository_LogsConflictsAndReplays(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repository := pkg.NewUserAccountRepository(pkg.NewEventStoreOnMemory(), pkg.WithUserAccountRepositoryLogger(logger))
+
+	id := pkg.NewUserAccountId("1")
+	userAccount, userAccountCreated := pkg.NewUserAccount(id, "test")
+	require.Nil(t, repository.StoreEventAndSnapshot(ctx, userAccountCreated, userAccount))
+	require.NotNil(t, repository.StoreEventAndSnapshot(ctx, userAccountCreated, userAccount))
+	_, err := repository.FindById(ctx, &id)
+	require.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var conflict, replay map[string]any
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &conflict))
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &replay))
+	assert.Equal(t, "INFO", conflict["level"])
+	assert.Equal(t, "failed to store the event", conflict["msg"])
+	assert.Equal(t, id.AsString(), conflict["aid"])
+	assert.Equal(t, "DEBUG", replay["level"])
+	assert.Equal(t, float64(0), replay["events"])
+}
@@ -123,3 +123,49 @@ func newULID() ulid.ULID {
 	entropy := ulid.Monotonic(rand.New(rand.NewSource(t.UnixNano())), 0)
 	return ulid.MustNew(ulid.Timestamp(t), entropy)
 }
+
+func userAccountEventConverter(m map[string]any) (esag.Event, error) {
+	aggregateMap, ok := m["AggregateId"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("AggregateId is not a map")
+	}
+	aggregateId, ok := aggregateMap["Value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Value is not a string")
+	}
+	userAccountId := newUserAccountId(aggregateId)
+	switch m["TypeName"].(string) {
+	case "UserAccountCreated":
+		return newUserAccountCreated(
+			m["Id"].(string),
+			&userAccountId,
+			uint64(m["SeqNr"].(float64)),
+			m["Name"].(string),
+			uint64(m["OccurredAt"].(float64)),
+		), nil
+	case "UserAccountNameChanged":
+		return newUserAccountNameChanged(
+			m["Id"].(string),
+			&userAccountId,
+			uint64(m["SeqNr"].(float64)),
+			m["Name"].(string),
+			uint64(m["OccurredAt"].(float64)),
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown event type")
+	}
+}
+
+func userAccountSnapshotConverter(m map[string]any) (esag.Aggregate, error) {
+	idMap, ok := m["Id"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("Id is not a map")
+	}
+	value, ok := idMap["Value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Value is not a string")
+	}
+	result, _ := newUserAccount(newUserAccountId(value), m["Name"].(string))
+	result.SeqNr = uint64(m["SeqNr"].(float64))
+	return result, nil
+}
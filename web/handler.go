@@ -3,7 +3,7 @@ package web
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -20,12 +20,11 @@ type jsonDto[E pkg.Event, A pkg.Aggregate] struct {
 }
 
 func (h *handler) CreateUserAccountHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("CreateUserAccountHandler")
-
 	userAccountId := pkg.NewUserAccountId(fmt.Sprintf("usr_%d", time.Now().Unix()))
 	userAccount, userAccountCreated := pkg.NewUserAccount(userAccountId, "Tom")
 
 	if err := h.userAccountRepository.StoreEventAndSnapshot(r.Context(), userAccountCreated, userAccount); err != nil {
+		loggerFrom(r.Context()).ErrorContext(r.Context(), "failed to handle the request", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -44,23 +43,24 @@ func (h *handler) CreateUserAccountHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *handler) UpdateUserAccountHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("UpdateUserAccountHandler")
-
 	userAccountIdFromQueryString := r.FormValue("userAccountId")
 
 	userAccount, err := h.userAccountRepository.FindById(r.Context(), pkg.NewUserAccountId(userAccountIdFromQueryString))
 	if err != nil {
+		loggerFrom(r.Context()).ErrorContext(r.Context(), "failed to handle the request", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	result, err := userAccount.Rename("Jerry")
 	if err != nil {
+		loggerFrom(r.Context()).ErrorContext(r.Context(), "failed to handle the request", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	if err := h.userAccountRepository.StoreEventAndSnapshot(r.Context(), result.Event, result.Aggregate); err != nil {
+		loggerFrom(r.Context()).ErrorContext(r.Context(), "failed to handle the request", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -79,12 +79,11 @@ func (h *handler) UpdateUserAccountHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *handler) GetUserAccountHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("GetUserAccountHandler")
-
 	userAccountIdFromQueryString := r.FormValue("userAccountId")
 
 	userAccount, err := h.userAccountRepository.FindById(r.Context(), pkg.NewUserAccountId(userAccountIdFromQueryString))
 	if err != nil {
+		loggerFrom(r.Context()).ErrorContext(r.Context(), "failed to handle the request", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -102,15 +101,11 @@ func (h *handler) GetUserAccountHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *handler) ListUserAccountHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("ListUserAccountHandler")
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ListUserAccountHandler"))
 }
 
 func (h *handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("IndexHandler")
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`<html>
 <head>
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// requestIdHeader is the header carrying the request id, which is generated if the request has none.
+const requestIdHeader = "X-Request-Id"
+
+type loggerKey struct{}
+
+// loggerFrom returns the logger of the request, which carries its request id.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestLog assigns a request id to the request and logs it when the handler completes.
+func withRequestLog(logger *slog.Logger, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == "" {
+			requestId = ulid.MustNew(ulid.Timestamp(start), rand.Reader).String()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+
+		requestLogger := logger.With(slog.String("request_id", requestId))
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r.WithContext(context.WithValue(r.Context(), loggerKey{}, requestLogger)))
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		requestLogger.LogAttrs(r.Context(), level, "request completed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Duration("duration", time.Since(start)))
+	}
+}
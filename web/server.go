@@ -1,22 +1,30 @@
 package web
 
 import (
+	"log/slog"
 	"net/http"
 
 	"github.com/szks-repo/event-store-adapter-go/pkg"
 )
 
+// NewServer returns the server of the handlers, which log each request with its request id to the logger.
+//
+// If logger is nil, slog.Default() is used.
 func NewServer(
 	userAccountRepository pkg.UserAccountRepository,
+	logger *slog.Logger,
 ) http.Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
 	handler := &handler{
 		userAccountRepository: userAccountRepository,
 	}
 
-	http.HandleFunc("/", handler.IndexHandler)
-	http.HandleFunc("/userAccounts/get", handler.GetUserAccountHandler)
-	http.HandleFunc("/userAccounts/create", handler.CreateUserAccountHandler)
-	http.HandleFunc("/userAccounts/update", handler.UpdateUserAccountHandler)
+	http.HandleFunc("/", withRequestLog(logger, handler.IndexHandler))
+	http.HandleFunc("/userAccounts/get", withRequestLog(logger, handler.GetUserAccountHandler))
+	http.HandleFunc("/userAccounts/create", withRequestLog(logger, handler.CreateUserAccountHandler))
+	http.HandleFunc("/userAccounts/update", withRequestLog(logger, handler.UpdateUserAccountHandler))
 
 	srv := http.Server{
 		Addr:    ":3000",